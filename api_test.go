@@ -0,0 +1,173 @@
+package s3fs
+
+import (
+	"io/fs"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
+	"github.com/jarxorg/wfs"
+	"github.com/jarxorg/wfs/memfs"
+)
+
+// countAPI is the S3API on s3fake that counts the requests and the succeeded
+// requests of each operation, and the maximum number of the concurrent
+// requests. The latency and the errors are injected by the faults of s3fake.
+type countAPI struct {
+	*s3fake.API
+	// before is called with the input before each request. If before returns
+	// an error then the request fails with the error.
+	before func(op string, input interface{}) error
+	// after is called with the input and the output of each succeeded request.
+	after       func(op string, input, output interface{})
+	mutex       sync.Mutex
+	calls       map[string]int
+	succeeded   map[string]int
+	inflight    int
+	maxInflight int
+}
+
+var _ S3API = (*countAPI)(nil)
+
+func newCountAPI(fsys fs.FS) *countAPI {
+	return &countAPI{
+		API:       s3fake.New(fsys),
+		calls:     map[string]int{},
+		succeeded: map[string]int{},
+	}
+}
+
+// newCountFSTesting returns the S3FS of "bucket" that contains the files, and
+// its countAPI.
+func newCountFSTesting(t *testing.T, files map[string][]byte) (*S3FS, *countAPI) {
+	memFsys := memfs.New()
+	if err := memFsys.MkdirAll("bucket", fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	for name, data := range files {
+		if _, err := wfs.WriteFile(memFsys, "bucket/"+name, data, fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := newCountAPI(memFsys)
+	return NewWithAPI("bucket", api), api
+}
+
+// count returns the number of the requests of the operation.
+func (m *countAPI) count(op string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.calls[op]
+}
+
+// countSucceeded returns the number of the succeeded requests of the
+// operation.
+func (m *countAPI) countSucceeded(op string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.succeeded[op]
+}
+
+// maxConcurrency returns the maximum number of the concurrent requests.
+func (m *countAPI) maxConcurrency() int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.maxInflight
+}
+
+// reset resets the counts.
+func (m *countAPI) reset() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.calls = map[string]int{}
+	m.succeeded = map[string]int{}
+	m.maxInflight = m.inflight
+}
+
+func (m *countAPI) enter(op string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.calls[op]++
+	m.inflight++
+	m.maxInflight = max(m.maxInflight, m.inflight)
+}
+
+func (m *countAPI) exit(op string, err error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.inflight--
+	if err == nil {
+		m.succeeded[op]++
+	}
+}
+
+// countCall counts the request of the operation and calls it.
+func countCall[I, O any](m *countAPI, op string, fn func(aws.Context, I, ...request.Option) (O, error), ctx aws.Context, input I, opts []request.Option) (output O, err error) {
+	m.enter(op)
+	defer func() { m.exit(op, err) }()
+	if m.before != nil {
+		if err := m.before(op, input); err != nil {
+			return output, err
+		}
+	}
+	output, err = fn(ctx, input, opts...)
+	if err == nil && m.after != nil {
+		m.after(op, input, output)
+	}
+	return output, err
+}
+
+func (m *countAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return countCall(m, "GetObject", m.API.GetObjectWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return countCall(m, "HeadObject", m.API.HeadObjectWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return countCall(m, "PutObject", m.API.PutObjectWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	return countCall(m, "ListObjectsV2", m.API.ListObjectsV2WithContext, ctx, input, opts)
+}
+
+func (m *countAPI) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	return countCall(m, "ListObjectVersions", m.API.ListObjectVersionsWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	return countCall(m, "DeleteObject", m.API.DeleteObjectWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	return countCall(m, "DeleteObjects", m.API.DeleteObjectsWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	return countCall(m, "CreateMultipartUpload", m.API.CreateMultipartUploadWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	return countCall(m, "UploadPart", m.API.UploadPartWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	return countCall(m, "CompleteMultipartUpload", m.API.CompleteMultipartUploadWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	return countCall(m, "CopyObject", m.API.CopyObjectWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	return countCall(m, "UploadPartCopy", m.API.UploadPartCopyWithContext, ctx, input, opts)
+}
+
+func (m *countAPI) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	return countCall(m, "AbortMultipartUpload", m.API.AbortMultipartUploadWithContext, ctx, input, opts)
+}
@@ -0,0 +1,361 @@
+package s3fs
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// DiskCache is a read-through cache of the object bodies on the local disk.
+// The bodies are stored by the bucket, the key and the ETag, and the least
+// recently used bodies are evicted when the total size exceeds the maximum
+// size. The index of the cache is kept in memory, so the bodies that are
+// stored by the other processes are not used. DiskCache is safe for
+// concurrent use and can be shared by the filesystems.
+type DiskCache struct {
+	// TTL is the duration that the cached body is used without validation.
+	// If TTL is 0 then the cached body is validated by the conditional GET
+	// with IfNoneMatch on every open.
+	TTL     time.Duration
+	dir     string
+	maxSize int64
+	mutex   sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+	size    int64
+	calls   map[string]*cacheCall
+	gen     uint64
+	now     func() time.Time
+}
+
+// cacheEntry represents a cached body of an object.
+type cacheEntry struct {
+	key       string
+	etag      string
+	file      string
+	size      int64
+	modTime   time.Time
+	object    *ObjectInfo
+	validated time.Time
+}
+
+// cacheCall represents an in-flight download of an object. The readers of
+// the same object wait for the download.
+type cacheCall struct {
+	done  chan struct{}
+	ctx   context.Context
+	gen   uint64
+	entry *cacheEntry
+	err   error
+}
+
+// NewDiskCache returns a DiskCache that stores the bodies in dir. If maxSize
+// is greater than 0 then the total size of the bodies is limited to maxSize
+// bytes and the larger objects are not cached.
+func NewDiskCache(dir string, maxSize int64) (*DiskCache, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{
+		dir:     dir,
+		maxSize: maxSize,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+		calls:   map[string]*cacheCall{},
+		now:     time.Now,
+	}, nil
+}
+
+// Size returns the total size of the cached bodies.
+func (c *DiskCache) Size() int64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.size
+}
+
+// Clear removes all cached bodies.
+func (c *DiskCache) Clear() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	var firstErr error
+	for c.lru.Len() > 0 {
+		if err := c.removeElement(c.lru.Back()); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// get returns the entry of the key and marks it as recently used.
+func (c *DiskCache) get(key string) *cacheEntry {
+	el, ok := c.entries[key]
+	if !ok {
+		return nil
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*cacheEntry)
+}
+
+// removeElement removes the entry and its body. The caller must hold the
+// mutex.
+func (c *DiskCache) removeElement(el *list.Element) error {
+	e := c.dropElement(el)
+	if err := os.Remove(e.file); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// dropElement removes the entry from the index and keeps its body. The
+// caller must hold the mutex.
+func (c *DiskCache) dropElement(el *list.Element) *cacheEntry {
+	e := el.Value.(*cacheEntry)
+	c.lru.Remove(el)
+	delete(c.entries, e.key)
+	c.size -= e.size
+	return e
+}
+
+// remove removes the entry if it is still cached.
+func (c *DiskCache) remove(e *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if el, ok := c.entries[e.key]; ok && el.Value == e {
+		c.removeElement(el)
+	}
+}
+
+// add adds the entry and evicts the least recently used entries. If the
+// cache is invalidated since gen then the entry is validated on the next open.
+func (c *DiskCache) add(e *cacheEntry, gen uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.gen != gen {
+		e.validated = time.Time{}
+	}
+	if el, ok := c.entries[e.key]; ok {
+		if el.Value.(*cacheEntry).file == e.file {
+			// NOTE: The body of the same ETag is stored onto the same file.
+			c.dropElement(el)
+		} else {
+			c.removeElement(el)
+		}
+	}
+	c.entries[e.key] = c.lru.PushFront(e)
+	c.size += e.size
+	for c.maxSize > 0 && c.size > c.maxSize && c.lru.Len() > 1 {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// invalidate removes the body of the key that is written or removed. If all
+// is true then the bodies under the key as the prefix are also removed.
+func (c *DiskCache) invalidate(key string, all bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.gen++
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*cacheEntry)
+		if e.key == key || (all && strings.HasPrefix(e.key, key)) {
+			c.removeElement(el)
+		}
+		el = next
+	}
+}
+
+// validated marks the entry as validated now.
+func (c *DiskCache) validated(e *cacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e.validated = c.now()
+}
+
+// open opens the named file of the filesystem through the cache.
+func (c *DiskCache) open(fsys *S3FS, name string) (fs.File, error) {
+	key := path.Join(fsys.bucket, fsys.key(name))
+	for {
+		c.mutex.Lock()
+		e := c.get(key)
+		if e != nil && c.TTL > 0 && c.now().Sub(e.validated) < c.TTL {
+			c.mutex.Unlock()
+			f, err := e.open(name)
+			if os.IsNotExist(err) {
+				// NOTE: The body is evicted by the other reader.
+				c.remove(e)
+				continue
+			}
+			return f, err
+		}
+		if call, ok := c.calls[key]; ok {
+			c.mutex.Unlock()
+			<-call.done
+			if call.err != nil && call.ctx.Err() != nil && fsys.context().Err() == nil {
+				// NOTE: The download is canceled by the context of the other
+				// reader, so download it again by the context of this reader.
+				continue
+			}
+			if call.err != nil {
+				return nil, call.err
+			}
+			if call.entry == nil {
+				// NOTE: The object is too large to cache.
+				return fsys.getFile(name)
+			}
+			f, err := call.entry.open(name)
+			if os.IsNotExist(err) {
+				continue
+			}
+			return f, err
+		}
+		call := &cacheCall{done: make(chan struct{}), ctx: fsys.context(), gen: c.gen}
+		c.calls[key] = call
+		c.mutex.Unlock()
+
+		f, err := c.fetch(fsys, name, key, e, call)
+
+		c.mutex.Lock()
+		delete(c.calls, key)
+		c.mutex.Unlock()
+		close(call.done)
+		return f, err
+	}
+}
+
+// fetch gets the object by the conditional GET if the entry is cached, and
+// stores the body.
+func (c *DiskCache) fetch(fsys *S3FS, name, key string, e *cacheEntry, call *cacheCall) (fs.File, error) {
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(fsys.bucket),
+		Key:    aws.String(fsys.key(name)),
+	}
+	if e != nil {
+		input.IfNoneMatch = aws.String(e.etag)
+	}
+	output, err := fsys.client().GetObjectWithContext(fsys.context(), input)
+	if err != nil {
+		if e != nil && isNotModified(err) {
+			c.validated(e)
+			call.entry = e
+			return e.open(name)
+		}
+		if e != nil && isS3NoSuchKey(err) {
+			c.remove(e)
+		}
+		call.err = toPathError(err, "Open", name)
+		return nil, call.err
+	}
+	if c.maxSize > 0 && aws.Int64Value(output.ContentLength) > c.maxSize {
+		return newS3File(fsys, name, output), nil
+	}
+	defer output.Body.Close()
+
+	e, err = c.store(fsys, name, key, output, call.gen)
+	if err != nil {
+		call.err = toPathError(err, "Open", name)
+		return nil, call.err
+	}
+	call.entry = e
+	return e.open(name)
+}
+
+// store writes the body of the object to the disk and adds the entry.
+func (c *DiskCache) store(fsys *S3FS, name, key string, output *s3.GetObjectOutput, gen uint64) (*cacheEntry, error) {
+	etag := aws.StringValue(output.ETag)
+	sum := sha256.Sum256([]byte(key + "\x00" + etag))
+	file := filepath.Join(c.dir, hex.EncodeToString(sum[:]))
+
+	tmp, err := os.CreateTemp(c.dir, ".tmp-*")
+	if err != nil {
+		return nil, err
+	}
+	size, err := io.Copy(tmp, output.Body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), file)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	e := &cacheEntry{
+		key:       key,
+		etag:      etag,
+		file:      file,
+		size:      size,
+		modTime:   aws.TimeValue(output.LastModified),
+		object:    newGetObjectInfo(fsys.bucket, fsys.key(name), output),
+		validated: c.now(),
+	}
+	c.add(e, gen)
+	return e, nil
+}
+
+// open opens the cached body as the named file.
+func (e *cacheEntry) open(name string) (*cachedFile, error) {
+	f, err := os.Open(e.file)
+	if err != nil {
+		return nil, err
+	}
+	return &cachedFile{
+		content: &content{
+			name:    path.Base(name),
+			size:    e.size,
+			modTime: e.modTime,
+			object:  e.object,
+		},
+		file: f,
+	}, nil
+}
+
+// cachedFile is a file of the cached body.
+type cachedFile struct {
+	*content
+	file *os.File
+}
+
+var (
+	_ fs.File     = (*cachedFile)(nil)
+	_ fs.FileInfo = (*cachedFile)(nil)
+	_ io.Seeker   = (*cachedFile)(nil)
+	_ io.ReaderAt = (*cachedFile)(nil)
+)
+
+// Read reads bytes from this file.
+func (f *cachedFile) Read(p []byte) (int, error) {
+	return f.file.Read(p)
+}
+
+// Seek sets the offset for the next Read.
+func (f *cachedFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+// ReadAt reads len(p) bytes from the specified offset.
+func (f *cachedFile) ReadAt(p []byte, off int64) (int, error) {
+	return f.file.ReadAt(p, off)
+}
+
+// Stat returns the fs.FileInfo of this file.
+func (f *cachedFile) Stat() (fs.FileInfo, error) {
+	return f, nil
+}
+
+// Close closes the cached body.
+func (f *cachedFile) Close() error {
+	return f.file.Close()
+}
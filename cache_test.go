@@ -0,0 +1,340 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
+)
+
+func newDiskCacheFSTesting(t *testing.T, maxSize int64) (*S3FS, *countAPI) {
+	fsys, api := newCountFSTesting(t, map[string][]byte{
+		"a.txt":     []byte("aaaa"),
+		"b.txt":     []byte("bbbb"),
+		"c.txt":     []byte("cccc"),
+		"large.txt": []byte("large object"),
+	})
+	cache, err := NewDiskCache(t.TempDir(), maxSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys.DiskCache = cache
+	return fsys, api
+}
+
+func TestDiskCache(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 0)
+
+	for i := 0; i < 3; i++ {
+		got, err := fsys.ReadFile("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "aaaa" {
+			t.Errorf("Error ReadFile got %s; want %s", got, "aaaa")
+		}
+	}
+	if n := api.count("GetObject"); n != 3 {
+		t.Errorf("Error GetObject requests %d; want %d", n, 3)
+	}
+	if n := api.countSucceeded("GetObject"); n != 1 {
+		t.Errorf("Error downloads %d; want %d", n, 1)
+	}
+	if got := fsys.DiskCache.Size(); got != 4 {
+		t.Errorf("Error Size got %d; want %d", got, 4)
+	}
+
+	// NOTE: The object is modified by the other writer.
+	if _, err := NewWithAPI("bucket", api.API).WriteFile("a.txt", []byte("modified"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "modified" {
+		t.Errorf("Error ReadFile got %s; want %s", got, "modified")
+	}
+	if got := fsys.DiskCache.Size(); got != 8 {
+		t.Errorf("Error Size got %d; want %d", got, 8)
+	}
+
+	if err := fsys.DiskCache.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.DiskCache.Size(); got != 0 {
+		t.Errorf("Error Size got %d; want %d", got, 0)
+	}
+	if entries, err := os.ReadDir(fsys.DiskCache.dir); err != nil || len(entries) != 0 {
+		t.Errorf("Error Clear files %v, %v; want empty", entries, err)
+	}
+}
+
+func TestDiskCache_File(t *testing.T) {
+	fsys, _ := newDiskCacheFSTesting(t, 0)
+	for i := 0; i < 2; i++ {
+		f, err := fsys.Open("b.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := f.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name() != "b.txt" || info.Size() != 4 || info.IsDir() {
+			t.Errorf("Error Stat got %s %d %v; want %s %d %v", info.Name(), info.Size(), info.IsDir(), "b.txt", 4, false)
+		}
+		if o := info.Sys().(*ObjectInfo); o.Key != "b.txt" || o.ETag == "" {
+			t.Errorf("Error ObjectInfo got %s %s", o.Key, o.ETag)
+		}
+		p := make([]byte, 2)
+		if _, err := f.(io.ReaderAt).ReadAt(p, 2); err != nil {
+			t.Fatal(err)
+		}
+		if string(p) != "bb" {
+			t.Errorf("Error ReadAt got %s; want %s", p, "bb")
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDiskCache_TTL(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 0)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys.DiskCache.now = func() time.Time { return now }
+	fsys.DiskCache.TTL = time.Minute
+
+	for i := 0; i < 3; i++ {
+		if _, err := fsys.ReadFile("a.txt"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := api.count("GetObject"); n != 1 {
+		t.Errorf("Error GetObject requests %d; want %d", n, 1)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := fsys.ReadFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.count("GetObject"); n != 2 {
+		t.Errorf("Error GetObject requests %d; want %d", n, 2)
+	}
+	if n := api.countSucceeded("GetObject"); n != 1 {
+		t.Errorf("Error downloads %d; want %d", n, 1)
+	}
+}
+
+func TestDiskCache_Invalidate(t *testing.T) {
+	fsys, _ := newDiskCacheFSTesting(t, 0)
+	fsys.DiskCache.TTL = time.Minute
+
+	if _, err := fsys.ReadFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.WriteFile("a.txt", []byte("new!"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fsys.ReadFile("a.txt"); err != nil || string(got) != "new!" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "new!")
+	}
+
+	if err := fsys.RemoveFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadFile("a.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error ReadFile error got %v; want %v", err, fs.ErrNotExist)
+	}
+
+	for _, name := range []string{"b.txt", "c.txt"} {
+		if _, err := fsys.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fsys.RemoveAll("."); err != nil {
+		t.Fatal(err)
+	}
+	if got := fsys.DiskCache.Size(); got != 0 {
+		t.Errorf("Error Size got %d; want %d", got, 0)
+	}
+	if entries, err := os.ReadDir(fsys.DiskCache.dir); err != nil || len(entries) != 0 {
+		t.Errorf("Error ReadDir got %d entries, %v; want no entries", len(entries), err)
+	}
+}
+
+func TestDiskCache_SameETag(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 0)
+	// NOTE: The backend ignores IfNoneMatch, so the body of the same ETag is
+	// downloaded again onto the cached file.
+	api.before = func(op string, input interface{}) error {
+		if input, ok := input.(*s3.GetObjectInput); ok {
+			input.IfNoneMatch = nil
+		}
+		return nil
+	}
+	for i := 0; i < 3; i++ {
+		got, err := fsys.ReadFile("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "aaaa" {
+			t.Errorf("Error ReadFile got %s; want %s", got, "aaaa")
+		}
+	}
+	if n := api.countSucceeded("GetObject"); n != 3 {
+		t.Errorf("Error downloads %d; want %d", n, 3)
+	}
+	if size := fsys.DiskCache.Size(); size != 4 {
+		t.Errorf("Error Size got %d; want %d", size, 4)
+	}
+}
+
+func TestDiskCache_Evict(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 8)
+
+	for _, name := range []string{"a.txt", "b.txt", "a.txt", "c.txt"} {
+		if _, err := fsys.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fsys.DiskCache.Size(); got != 8 {
+		t.Errorf("Error Size got %d; want %d", got, 8)
+	}
+
+	// NOTE: b.txt is the least recently used.
+	api.reset()
+	for _, name := range []string{"a.txt", "c.txt"} {
+		if _, err := fsys.ReadFile(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := api.countSucceeded("GetObject"); n != 0 {
+		t.Errorf("Error downloads %d; want %d", n, 0)
+	}
+	if _, err := fsys.ReadFile("b.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.countSucceeded("GetObject"); n != 1 {
+		t.Errorf("Error downloads %d; want %d", n, 1)
+	}
+
+	// NOTE: The larger object than the max size is not cached.
+	api.reset()
+	for i := 0; i < 2; i++ {
+		got, err := fsys.ReadFile("large.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "large object" {
+			t.Errorf("Error ReadFile got %s; want %s", got, "large object")
+		}
+	}
+	if n := api.countSucceeded("GetObject"); n != 2 {
+		t.Errorf("Error downloads %d; want %d", n, 2)
+	}
+	if got := fsys.DiskCache.Size(); got != 8 {
+		t.Errorf("Error Size got %d; want %d", got, 8)
+	}
+}
+
+func TestDiskCache_Concurrent(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 0)
+	api.InjectFault(s3fake.Fault{Op: "GetObject", Latency: 50 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := fsys.ReadFile("c.txt")
+			if err == nil && !bytes.Equal(got, []byte("cccc")) {
+				err = errors.New("unexpected body " + string(got))
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := api.countSucceeded("GetObject"); n != 1 {
+		t.Errorf("Error downloads %d; want %d", n, 1)
+	}
+}
+
+func TestDiskCache_CanceledLeader(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 0)
+	api.InjectFault(s3fake.Fault{Op: "GetObject", Key: "c.txt", Latency: time.Second, Times: 1})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	leaderErr := make(chan error, 1)
+	go func() {
+		_, err := fsys.WithContext(ctx).ReadFile("c.txt")
+		leaderErr <- err
+	}()
+	// NOTE: Wait until the leader starts the download.
+	for api.count("GetObject") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	got, err := fsys.ReadFile("c.txt")
+	if err != nil || string(got) != "cccc" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "cccc")
+	}
+	if err := <-leaderErr; err == nil {
+		t.Errorf("Error ReadFile of the canceled leader got no error")
+	}
+}
+
+func TestDiskCache_NotExist(t *testing.T) {
+	fsys, api := newDiskCacheFSTesting(t, 0)
+	if _, err := fsys.ReadFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := NewWithAPI("bucket", api.API).RemoveFile("a.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.ReadFile("a.txt"); !isNotExist(err) {
+		t.Errorf("Error ReadFile error got %v; want %v", err, fs.ErrNotExist)
+	}
+	if got := fsys.DiskCache.Size(); got != 0 {
+		t.Errorf("Error Size got %d; want %d", got, 0)
+	}
+}
+
+func TestIsNotModified(t *testing.T) {
+	fsys, _ := newDiskCacheFSTesting(t, 0)
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, _ := f.Stat()
+
+	_, err = fsys.api.GetObjectWithContext(fsys.context(), &s3.GetObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("a.txt"),
+		IfNoneMatch: aws.String(info.Sys().(*ObjectInfo).ETag),
+	})
+	if !isNotModified(err) {
+		t.Errorf("Error isNotModified(%v) got false; want true", err)
+	}
+	if isNotModified(errors.New("test")) {
+		t.Errorf("Error isNotModified got true; want false")
+	}
+}
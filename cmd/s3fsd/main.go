@@ -0,0 +1,38 @@
+// Command s3fsd serves a local directory with the S3 REST API.
+//
+// Each directory at the root directory is served as a bucket.
+//
+//	s3fsd -root ./data -addr :9000 -access-key AKID -secret-key SECRET
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+
+	"github.com/jarxorg/s3fs"
+	"github.com/jarxorg/wfs/osfs"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "the address to listen on")
+	root := flag.String("root", ".", "the root directory to serve")
+	domain := flag.String("domain", "", "the domain of the virtual-hosted-style requests such as s3.localhost")
+	accessKey := flag.String("access-key", "", "the access key ID to verify the signatures of the requests")
+	secretKey := flag.String("secret-key", "", "the secret access key to verify the signatures of the requests")
+	versioning := flag.Bool("versioning", false, "enable versioning of all buckets in memory")
+	flag.Parse()
+
+	h := s3fs.NewHandler(osfs.New(*root))
+	h.Domain = *domain
+	if *accessKey != "" {
+		h.Credentials = map[string]string{*accessKey: *secretKey}
+	}
+	if *versioning {
+		if err := h.EnableVersioning(); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("serving %s on %s", *root, *addr)
+	log.Fatal(http.ListenAndServe(*addr, h))
+}
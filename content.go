@@ -14,6 +14,7 @@ type content struct {
 	isDir   bool
 	size    int64
 	modTime time.Time
+	object  *ObjectInfo
 }
 
 var (
@@ -28,11 +29,36 @@ func newDirContent(prefix string) *content {
 	}
 }
 
-func newFileContent(o *s3.Object) *content {
+func newFileContent(name, bucket string, o *s3.Object) *content {
 	return &content{
-		name:    path.Base(aws.StringValue(o.Key)),
+		name:    path.Base(name),
 		size:    aws.Int64Value(o.Size),
 		modTime: aws.TimeValue(o.LastModified),
+		object:  newObjectInfo(bucket, o),
+	}
+}
+
+func newHeadContent(bucket, key string, o *s3.HeadObjectOutput) *content {
+	return &content{
+		name:    path.Base(key),
+		size:    aws.Int64Value(o.ContentLength),
+		modTime: aws.TimeValue(o.LastModified),
+		object:  newHeadObjectInfo(bucket, key, o),
+	}
+}
+
+func newVersionContent(bucket string, v *ObjectVersion) *content {
+	return &content{
+		name:    path.Base(v.Key),
+		size:    v.Size,
+		modTime: v.LastModified,
+		object: &ObjectInfo{
+			Bucket:       bucket,
+			Key:          v.Key,
+			ETag:         v.ETag,
+			VersionID:    v.VersionID,
+			StorageClass: v.StorageClass,
+		},
 	}
 }
 
@@ -60,8 +86,12 @@ func (c *content) IsDir() bool {
 	return c.isDir
 }
 
+// Sys returns *ObjectInfo if this content is a file otherwise nil.
 func (c *content) Sys() interface{} {
-	return nil
+	if c.object == nil {
+		return nil
+	}
+	return c.object
 }
 
 func (c *content) Type() fs.FileMode {
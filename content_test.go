@@ -2,6 +2,7 @@ package s3fs
 
 import (
 	"io/fs"
+	"reflect"
 	"testing"
 	"time"
 
@@ -51,16 +52,18 @@ func TestNewDirContent(t *testing.T) {
 
 func TestNewFileContent(t *testing.T) {
 	o := &s3.Object{
-		Key:          aws.String("file"),
+		ETag:         aws.String(`"etag"`),
+		Key:          aws.String("dir/file"),
 		Size:         aws.Int64(123),
 		LastModified: aws.Time(time.Now()),
+		StorageClass: aws.String(s3.ObjectStorageClassGlacier),
 	}
 
 	var got fs.FileInfo
-	got = newFileContent(o)
+	got = newFileContent("dir/file", "bucket", o)
 
-	if name := got.Name(); name != aws.StringValue(o.Key) {
-		t.Errorf("Error Name %s; want %s", name, aws.StringValue(o.Key))
+	if name := got.Name(); name != "file" {
+		t.Errorf("Error Name %s; want %s", name, "file")
 	}
 	if size := got.Size(); size != aws.Int64Value(o.Size) {
 		t.Errorf("Error Size %d; want %d", size, aws.Int64Value(o.Size))
@@ -74,7 +77,13 @@ func TestNewFileContent(t *testing.T) {
 	if isDir := got.IsDir(); isDir {
 		t.Errorf("Error IsDir %v; want false", isDir)
 	}
-	if sys := got.Sys(); sys != nil {
-		t.Errorf("Error Sys %v; want nil", sys)
+	wantSys := &ObjectInfo{
+		Bucket:       "bucket",
+		Key:          "dir/file",
+		ETag:         `"etag"`,
+		StorageClass: s3.ObjectStorageClassGlacier,
+	}
+	if sys := got.Sys(); !reflect.DeepEqual(sys, wantSys) {
+		t.Errorf("Error Sys %v; want %v", sys, wantSys)
 	}
 }
@@ -0,0 +1,187 @@
+package s3fs
+
+import (
+	"io/fs"
+	"net/url"
+	"strings"
+	"syscall"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxCopyObjectSize is the maximum size of an object that can be copied by
+// a single CopyObject. Larger objects are copied by UploadPartCopy.
+var maxCopyObjectSize = int64(5 * 1024 * 1024 * 1024)
+
+// copySource returns the URL-encoded CopySource of the specified key.
+func copySource(bucket, key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return url.PathEscape(bucket) + "/" + strings.Join(segments, "/")
+}
+
+// copyObject copies the object of srcKey to dstKey on the server side.
+func (fsys *S3FS) copyObject(srcKey, dstKey string, size int64) error {
+	return fsys.copyObjectVersion(srcKey, "", dstKey, size)
+}
+
+// copyObjectVersion copies the specified version of the object of srcKey to
+// dstKey on the server side. If versionID is empty then the latest version
+// is copied.
+func (fsys *S3FS) copyObjectVersion(srcKey, versionID, dstKey string, size int64) error {
+	defer fsys.invalidate(dstKey)
+	source := copySourceVersion(fsys.bucket, srcKey, versionID)
+	if size <= maxCopyObjectSize {
+		input := &s3.CopyObjectInput{
+			Bucket:     aws.String(fsys.bucket),
+			Key:        aws.String(dstKey),
+			CopySource: aws.String(source),
+		}
+		_, err := fsys.client().CopyObjectWithContext(fsys.context(), input)
+		return err
+	}
+
+	partSize := fsys.partSize()
+	if minPartSize := (size + maxUploadParts - 1) / maxUploadParts; partSize < minPartSize {
+		partSize = minPartSize
+	}
+	// NOTE: UploadPartCopy does not copy the metadata of the source object.
+	head, err := fsys.client().HeadObjectWithContext(fsys.context(), &s3.HeadObjectInput{
+		Bucket:    aws.String(fsys.bucket),
+		Key:       aws.String(srcKey),
+		VersionId: stringPtr(versionID),
+	})
+	if err != nil {
+		return err
+	}
+	opts := objectWriteOptions(newHeadObjectInfo(fsys.bucket, srcKey, head))
+	u, err := newMultipartUpload(fsys, dstKey, opts)
+	if err != nil {
+		return err
+	}
+	for start := int64(0); start < size; start += partSize {
+		end := start + partSize
+		if end > size {
+			end = size
+		}
+		u.uploadCopy(source, start, end-1)
+	}
+	_, err = u.complete()
+	return err
+}
+
+// listObjects calls fn with each page of the objects under the prefix.
+func (fsys *S3FS) listObjects(prefix string, fn func(objects []*s3.Object) error) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(fsys.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(fsys.ListBufferSize)),
+	}
+	for {
+		if err := fsys.context().Err(); err != nil {
+			return err
+		}
+		output, err := fsys.listObjectsV2(input)
+		if err != nil {
+			return err
+		}
+		if len(output.Contents) > 0 {
+			if err := fn(output.Contents); err != nil {
+				return err
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) || output.NextContinuationToken == nil {
+			return nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// copy copies src to dst. If remove is true then src is removed after copying.
+func (fsys *S3FS) copy(op, src, dst string, remove bool) error {
+	if !fs.ValidPath(src) {
+		return toPathError(fs.ErrInvalid, op, src)
+	}
+	if !fs.ValidPath(dst) {
+		return toPathError(fs.ErrInvalid, op, dst)
+	}
+	srcKey, dstKey := fsys.key(src), fsys.key(dst)
+	if srcKey == dstKey {
+		return nil
+	}
+
+	info, err := fsys.statFile(src)
+	if err == nil {
+		if err := fsys.copyObject(srcKey, dstKey, info.Size()); err != nil {
+			return toPathError(err, op, src)
+		}
+		if remove {
+			return fsys.RemoveFile(src)
+		}
+		return nil
+	}
+	if !isNotExist(err) {
+		return toPathError(err, op, src)
+	}
+
+	srcPrefix, dstPrefix := fsys.prefix(src), fsys.prefix(dst)
+	if strings.HasPrefix(dstPrefix, srcPrefix) {
+		return toPathError(syscall.EINVAL, op, dst)
+	}
+	if remove {
+		defer fsys.invalidateAll(srcPrefix)
+	}
+	found := false
+	err = fsys.listObjects(srcPrefix, func(objects []*s3.Object) error {
+		found = true
+		var ids []*s3.ObjectIdentifier
+		for _, o := range objects {
+			// NOTE: The keys under the prefix are copied as is, so the
+			// invalid keys and the directory markers are kept.
+			key := aws.StringValue(o.Key)
+			dstObjectKey := dstPrefix + strings.TrimPrefix(key, srcPrefix)
+			if dstObjectKey == "" {
+				// NOTE: The root has no directory marker.
+				continue
+			}
+			if err := fsys.copyObject(key, dstObjectKey, aws.Int64Value(o.Size)); err != nil {
+				return err
+			}
+			ids = append(ids, &s3.ObjectIdentifier{Key: o.Key})
+		}
+		if !remove {
+			return nil
+		}
+		keyErrors, err := fsys.deleteObjects(ids)
+		if err != nil {
+			return err
+		}
+		if len(keyErrors) > 0 {
+			return &RemoveAllError{Errors: keyErrors}
+		}
+		return nil
+	})
+	if err != nil {
+		return toPathError(err, op, src)
+	}
+	if !found {
+		return toPathError(fs.ErrNotExist, op, src)
+	}
+	return nil
+}
+
+// Copy copies src to dst on the server side by CopyObject. If src is a
+// directory then all files under src are copied. Objects larger than 5 GiB
+// are copied in parts by UploadPartCopy.
+func (fsys *S3FS) Copy(src, dst string) error {
+	return fsys.copy("Copy", src, dst, false)
+}
+
+// Rename renames (moves) oldname to newname. Rename copies the files on the
+// server side and then removes the old files.
+func (fsys *S3FS) Rename(oldname, newname string) error {
+	return fsys.copy("Rename", oldname, newname, true)
+}
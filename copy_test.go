@@ -0,0 +1,153 @@
+package s3fs
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestCopySource(t *testing.T) {
+	got := copySource("bucket", "dir 0/file+1.txt")
+	want := "bucket/dir%200/file+1.txt"
+	if got != want {
+		t.Errorf("Error copySource got %s; want %s", got, want)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	want, err := fsys.ReadFile("file0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Copy("file0.txt", "copy/file0.txt"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("copy/file0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("Error Copy got %s; want %s", got, want)
+	}
+	if _, err := fsys.Stat("file0.txt"); err != nil {
+		t.Errorf("Error Stat source after Copy: %v", err)
+	}
+}
+
+func TestCopy_Dir(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	fsys.ListBufferSize = 2
+	if err := fsys.Copy("dir0", "dir1"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"file01.txt", "file02.txt", "file03.txt"} {
+		want, err := fsys.ReadFile("dir0/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := fsys.ReadFile("dir1/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != string(want) {
+			t.Errorf("Error Copy %s got %s; want %s", name, got, want)
+		}
+	}
+}
+
+func TestCopy_Multipart(t *testing.T) {
+	defer func(size int64) { maxCopyObjectSize = size }(maxCopyObjectSize)
+	maxCopyObjectSize = 4
+
+	api := newMockFSS3APITesting(t)
+	fsys := NewWithAPI("testdata", api)
+	fsys.PartSize = 3
+	fsys.minPartSize = 1
+	want := strings.Repeat("0123456789", 2)
+	if _, err := fsys.WriteFile("large.txt", []byte(want), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Copy("large.txt", "large-copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("large-copy.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Error Copy got %s; want %s", got, want)
+	}
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+}
+
+func TestCopy_Errors(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	tests := []struct {
+		src, dst string
+		want     error
+	}{
+		{src: "not-found", dst: "dst", want: fs.ErrNotExist},
+		{src: "../file0.txt", dst: "dst", want: fs.ErrInvalid},
+		{src: "file0.txt", dst: "/dst", want: fs.ErrInvalid},
+		{src: "dir0", dst: "dir0/sub", want: syscall.EINVAL},
+	}
+	for _, test := range tests {
+		if err := fsys.Copy(test.src, test.dst); !errors.Is(err, test.want) {
+			t.Errorf("Error Copy(%s, %s) error got %v; want %v", test.src, test.dst, err, test.want)
+		}
+	}
+}
+
+func TestRename(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	want, err := fsys.ReadFile("file0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Rename("file0.txt", "renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("renamed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("Error Rename got %s; want %s", got, want)
+	}
+	if _, err := fsys.Stat("file0.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat after Rename got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestRename_Dir(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	fsys.ListBufferSize = 2
+	if err := fsys.Rename("dir0", "moved/dir0"); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := fsys.ReadDir("moved/dir0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 {
+		t.Errorf("Error ReadDir after Rename got %d entries; want 3", len(entries))
+	}
+	if _, err := fsys.Stat("dir0"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat after Rename got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestRename_DirV2(t *testing.T) {
+	fsys, _ := newV2FSTesting(t)
+	if err := fsys.Rename("dir0", "dir1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("dir1/file01.txt"); err != nil {
+		t.Errorf("Error Stat after Rename: %v", err)
+	}
+}
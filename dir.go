@@ -3,7 +3,9 @@ package s3fs
 import (
 	"io"
 	"io/fs"
+	"path"
 	"sort"
+	"strings"
 	"syscall"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -14,19 +16,20 @@ type s3Dir struct {
 	*content
 	fsys   *S3FS
 	prefix string
-	after  string
+	token  *string
 	eof    bool
 	cache  []fs.DirEntry
+	// marker is true if the directory marker is listed.
+	marker bool
 }
 
 var _ fs.ReadDirFile = (*s3Dir)(nil)
 
-func newS3Dir(fsys *S3FS, prefix string) *s3Dir {
-	prefix = normalizePrefix(fsys.key(prefix))
+func newS3Dir(fsys *S3FS, name string) *s3Dir {
 	return &s3Dir{
-		content: newDirContent(prefix),
+		content: newDirContent(path.Join(fsys.dir, name)),
 		fsys:    fsys,
-		prefix:  prefix,
+		prefix:  fsys.prefix(name),
 	}
 }
 
@@ -88,40 +91,66 @@ func (d *s3Dir) list(n int) ([]fs.DirEntry, error) {
 	if d.eof {
 		return nil, io.EOF
 	}
+	if err := d.fsys.context().Err(); err != nil {
+		return nil, &fs.PathError{Op: "ReadDir", Path: d.prefix, Err: err}
+	}
 	input := &s3.ListObjectsV2Input{
-		Bucket:     aws.String(d.fsys.bucket),
-		Prefix:     aws.String(d.prefix),
-		Delimiter:  aws.String("/"),
-		MaxKeys:    aws.Int64(int64(n)),
-		StartAfter: aws.String(d.after),
+		Bucket:            aws.String(d.fsys.bucket),
+		Prefix:            aws.String(d.prefix),
+		Delimiter:         aws.String("/"),
+		MaxKeys:           aws.Int64(int64(n)),
+		ContinuationToken: d.token,
 	}
-	output, err := d.fsys.api.ListObjectsV2(input)
+	output, err := d.fsys.listDir(input)
 	if err != nil {
 		return nil, err
 	}
 
 	for _, p := range output.CommonPrefixes {
-		entries = append(entries, newDirContent(*p.Prefix))
-		d.after = *p.Prefix
+		prefix := aws.StringValue(p.Prefix)
+		rel := strings.TrimSuffix(strings.TrimPrefix(prefix, d.prefix), "/")
+		if ok, err := d.fsys.checkKey(prefix, rel); !ok {
+			if err != nil {
+				return nil, &fs.PathError{Op: "ReadDir", Path: d.prefix, Err: err}
+			}
+			continue
+		}
+		entries = append(entries, newDirContent(d.fsys.toName(rel)))
 	}
 	for _, o := range output.Contents {
-		entries = append(entries, newFileContent(o))
-		d.after = *o.Key
+		key := aws.StringValue(o.Key)
+		if key == d.prefix {
+			// NOTE: The directory marker is not listed as a file.
+			d.marker = true
+			continue
+		}
+		rel := strings.TrimPrefix(key, d.prefix)
+		if ok, err := d.fsys.checkKey(key, rel); !ok {
+			if err != nil {
+				return nil, &fs.PathError{Op: "ReadDir", Path: d.prefix, Err: err}
+			}
+			continue
+		}
+		entries = append(entries, newFileContent(d.fsys.toName(rel), d.fsys.bucket, o))
+	}
+	d.token = output.NextContinuationToken
+	d.eof = !aws.BoolValue(output.IsTruncated) || d.token == nil
+	if len(entries) == 0 && !d.eof {
+		return d.list(n)
 	}
-	d.eof = !*output.IsTruncated
 
 	return entries, nil
 }
 
 // Open called by S3FS.Open(name string).
-// Open calls d.list(n), if the results is empty then returns a PathError
-// otherwise sets the results as d.cache.
+// Open calls d.list(n), if the results is empty and the directory marker is
+// not found then returns a PathError otherwise sets the results as d.cache.
 func (d *s3Dir) open(n int) (*s3Dir, error) {
 	entries, err := d.list(n)
 	if err != nil {
 		return nil, err
 	}
-	if len(entries) == 0 {
+	if len(entries) == 0 && !d.marker {
 		return nil, &fs.PathError{Op: "Open", Path: d.prefix, Err: fs.ErrNotExist}
 	}
 	d.cache = entries
@@ -0,0 +1,102 @@
+package s3fs
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// newLargeDirFSTesting returns the S3FS that has n directories and n files in
+// "large" and a file in each directory.
+func newLargeDirFSTesting(t *testing.T, n int) *S3FS {
+	files := map[string][]byte{}
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("large/dir%04d/file.txt", i)] = []byte("test")
+		files[fmt.Sprintf("large/file%04d.txt", i)] = []byte("test")
+	}
+	fsys, api := newCountFSTesting(t, files)
+	// NOTE: The listings are paginated by ContinuationToken, not StartAfter.
+	api.before = func(op string, input interface{}) error {
+		if input, ok := input.(*s3.ListObjectsV2Input); ok && aws.StringValue(input.StartAfter) != "" {
+			t.Errorf("Error ListObjectsV2 StartAfter %s; want ContinuationToken", aws.StringValue(input.StartAfter))
+		}
+		return nil
+	}
+	fsys.ListBufferSize = 300
+	return fsys
+}
+
+func TestReadDir_Large(t *testing.T) {
+	n := 1500
+	fsys := newLargeDirFSTesting(t, n)
+
+	entries, err := fs.ReadDir(fsys, "large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(entries), n*2; got != want {
+		t.Fatalf("Error ReadDir got %d entries; want %d", got, want)
+	}
+	for i, e := range entries {
+		want := fmt.Sprintf("dir%04d", i)
+		if i >= n {
+			want = fmt.Sprintf("file%04d.txt", i-n)
+		}
+		if e.Name() != want {
+			t.Fatalf("Error ReadDir entries[%d] %s; want %s", i, e.Name(), want)
+		}
+	}
+
+	f, err := fsys.Open("large")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seen := map[string]bool{}
+	for {
+		entries, err := f.(fs.ReadDirFile).ReadDir(7)
+		for _, e := range entries {
+			if seen[e.Name()] {
+				t.Fatalf("Error ReadDir duplicated %s", e.Name())
+			}
+			seen[e.Name()] = true
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := len(seen), n*2; got != want {
+		t.Errorf("Error ReadDir(7) got %d entries; want %d", got, want)
+	}
+}
+
+func TestGlob_Large(t *testing.T) {
+	n := 1500
+	fsys := newLargeDirFSTesting(t, n)
+
+	tests := []struct {
+		pattern string
+		want    int
+	}{
+		{pattern: "large/dir*", want: n},
+		{pattern: "large/file*", want: n},
+		{pattern: "large/dir*/file.txt", want: n},
+		{pattern: "large/dir14*/*", want: 100},
+	}
+	for _, test := range tests {
+		matches, err := fsys.Glob(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(matches) != test.want {
+			t.Errorf("Error Glob(%s) got %d matches; want %d", test.pattern, len(matches), test.want)
+		}
+	}
+}
@@ -2,9 +2,11 @@ package s3fs
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"io/fs"
 	"path"
+	"runtime"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/s3"
@@ -13,28 +15,158 @@ import (
 
 type s3File struct {
 	*content
-	buf io.ReadCloser
+	fsys      *S3FS
+	key       string
+	versionID string
+	buf       io.ReadCloser
+	pre       *prefetcher
+	offset    int64
+	closed    bool
 }
 
 var (
 	_ fs.File     = (*s3File)(nil)
 	_ fs.FileInfo = (*s3File)(nil)
+	_ io.Seeker   = (*s3File)(nil)
+	_ io.ReaderAt = (*s3File)(nil)
 )
 
-func newS3File(key string, o *s3.GetObjectOutput) *s3File {
-	return &s3File{
+func newS3File(fsys *S3FS, key string, o *s3.GetObjectOutput) *s3File {
+	f := &s3File{
 		content: &content{
 			name:    path.Base(key),
 			size:    aws.Int64Value(o.ContentLength),
 			modTime: aws.TimeValue(o.LastModified),
+			object:  newGetObjectInfo(fsys.bucket, fsys.key(key), o),
 		},
-		buf: o.Body,
+		fsys: fsys,
+		key:  key,
 	}
+	f.buf = f.resumable(o.Body, 0, f.size)
+	return f
 }
 
-// Read reads bytes from this file.
+// getRange gets the object body from the specified offset. If end is negative
+// then the body is read to the end of the object. If etag is not empty then
+// the body is got only if the object has the ETag.
+func (f *s3File) getRange(start, end int64, etag string) (io.ReadCloser, error) {
+	rng := fmt.Sprintf("bytes=%d-", start)
+	if end >= 0 {
+		rng = fmt.Sprintf("bytes=%d-%d", start, end)
+	}
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(f.fsys.bucket),
+		Key:       aws.String(f.fsys.key(f.key)),
+		Range:     aws.String(rng),
+		IfMatch:   stringPtr(etag),
+		VersionId: stringPtr(f.versionID),
+	}
+	output, err := f.fsys.client().GetObjectWithContext(f.fsys.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	return output.Body, nil
+}
+
+// prefetchable reports whether the rest of this file is read by the
+// prefetcher.
+func (f *s3File) prefetchable() bool {
+	return f.fsys.PrefetchConcurrency > 0 && f.size-f.offset > f.fsys.prefetchPartSize()
+}
+
+// Read reads bytes from this file. If S3FS.PrefetchConcurrency is greater
+// than 0 then the large file is read by the ranged GETs in parallel. If
+// S3FS.RetryPolicy is set then the body that fails in the middle is resumed
+// from the current offset.
 func (f *s3File) Read(p []byte) (int, error) {
-	return f.buf.Read(p)
+	if f.closed {
+		return 0, toPathError(fs.ErrClosed, "Read", f.key)
+	}
+	if f.pre == nil && f.prefetchable() {
+		f.pre = newPrefetcher(f, f.offset, f.buf)
+		f.buf = nil
+	}
+	if f.pre != nil {
+		n, err := f.pre.Read(p)
+		f.offset += int64(n)
+		if err != nil && err != io.EOF {
+			err = toPathError(err, "Read", f.key)
+		}
+		return n, err
+	}
+	if f.buf == nil {
+		if f.offset >= f.size {
+			return 0, io.EOF
+		}
+		buf, err := f.getRange(f.offset, -1, "")
+		if err != nil {
+			return 0, toPathError(err, "Read", f.key)
+		}
+		f.buf = f.resumable(buf, f.offset, f.size)
+	}
+	n, err := f.buf.Read(p)
+	f.offset += int64(n)
+	return n, err
+}
+
+// Seek sets the offset for the next Read. The object body is reopened lazily
+// from the new offset on the next Read.
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	if f.closed {
+		return 0, toPathError(fs.ErrClosed, "Seek", f.key)
+	}
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, toPathError(fs.ErrInvalid, "Seek", f.key)
+	}
+	if offset < 0 {
+		return 0, toPathError(fs.ErrInvalid, "Seek", f.key)
+	}
+	if offset != f.offset && f.buf != nil {
+		f.buf.Close()
+		f.buf = nil
+	}
+	if offset != f.offset && f.pre != nil {
+		f.pre.Close()
+		f.pre = nil
+	}
+	f.offset = offset
+	return offset, nil
+}
+
+// ReadAt reads len(p) bytes from the specified offset by a ranged request.
+// ReadAt does not affect the offset of Read and Seek.
+func (f *s3File) ReadAt(p []byte, off int64) (int, error) {
+	if f.closed {
+		return 0, toPathError(fs.ErrClosed, "ReadAt", f.key)
+	}
+	if off < 0 {
+		return 0, toPathError(fs.ErrInvalid, "ReadAt", f.key)
+	}
+	if off >= f.size {
+		return 0, io.EOF
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	end := min(off+int64(len(p)), f.size)
+	body, err := f.getRange(off, end-1, "")
+	if err != nil {
+		return 0, toPathError(err, "ReadAt", f.key)
+	}
+	buf := f.resumable(body, off, end)
+	defer buf.Close()
+
+	n, err := io.ReadFull(buf, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
 }
 
 // Stat returns the fs.FileInfo of this file.
@@ -44,15 +176,27 @@ func (f *s3File) Stat() (fs.FileInfo, error) {
 
 // Close closes streams.
 func (f *s3File) Close() error {
+	if f.closed {
+		return toPathError(fs.ErrClosed, "Close", f.key)
+	}
+	f.closed = true
+	if f.pre != nil {
+		f.pre.Close()
+	}
+	if f.buf == nil {
+		return nil
+	}
 	return f.buf.Close()
 }
 
 type s3WriterFile struct {
 	*content
-	fsys  *S3FS
-	key   string
-	buf   *bytes.Buffer
-	wrote bool
+	fsys   *S3FS
+	key    string
+	buf    *bytes.Buffer
+	wrote  bool
+	opts   *WriteOptions
+	upload *multipartUpload
 }
 
 var (
@@ -60,7 +204,7 @@ var (
 	_ fs.FileInfo    = (*s3WriterFile)(nil)
 )
 
-func newS3WriterFile(fsys *S3FS, key string) *s3WriterFile {
+func newS3WriterFile(fsys *S3FS, key string, opts *WriteOptions) *s3WriterFile {
 	return &s3WriterFile{
 		content: &content{
 			name: path.Base(key),
@@ -68,35 +212,105 @@ func newS3WriterFile(fsys *S3FS, key string) *s3WriterFile {
 		fsys: fsys,
 		key:  key,
 		buf:  new(bytes.Buffer),
+		opts: opts,
 	}
 }
 
 // Write writes the specified bytes to this file.
+// If the written bytes exceed S3FS.PartSize then the bytes are uploaded
+// by multipart upload. If the written bytes need more than 10,000 parts then
+// Write returns ErrTooManyParts.
 func (f *s3WriterFile) Write(p []byte) (int, error) {
 	if f.buf == nil {
 		return 0, toPathError(fs.ErrClosed, "Write", f.key)
 	}
+	if f.upload != nil {
+		if err := f.upload.firstErr(); err != nil {
+			return 0, toPathError(err, "Write", f.key)
+		}
+	}
 	f.wrote = true
-	return f.buf.Write(p)
+	n, err := f.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+	partSize := f.fsys.partSize()
+	for int64(f.buf.Len()) > partSize {
+		if f.upload == nil {
+			upload, err := newMultipartUpload(f.fsys, f.fsys.key(f.key), f.opts)
+			if err != nil {
+				return n, toPathError(err, "Write", f.key)
+			}
+			f.upload = upload
+			runtime.SetFinalizer(f, (*s3WriterFile).discard)
+		}
+		// NOTE: The rest of the bytes need one more part at least.
+		if f.upload.number+1 >= maxUploadParts {
+			f.upload.setErr(ErrTooManyParts)
+			return n, toPathError(ErrTooManyParts, "Write", f.key)
+		}
+		part := make([]byte, partSize)
+		f.buf.Read(part)
+		f.upload.upload(part)
+	}
+	return n, nil
 }
 
-// Close closes streams.
+// discard aborts the multipart upload if the file is discarded without closing.
+func (f *s3WriterFile) discard() {
+	if f.upload != nil {
+		f.upload.abort()
+	}
+}
+
+// Close closes streams. If nothing is written then the object is not written
+// unless the preconditions are specified, so the empty object is written to
+// check them.
 func (f *s3WriterFile) Close() error {
-	if !f.wrote {
+	if !f.wrote && !f.opts.conditional() {
 		return nil
 	}
 	if f.buf == nil {
 		return toPathError(fs.ErrClosed, "Close", f.key)
 	}
+	buf := f.buf
+	f.buf = nil
+	defer f.fsys.invalidate(f.fsys.key(f.key))
+	if f.upload != nil {
+		runtime.SetFinalizer(f, nil)
+		if buf.Len() > 0 {
+			f.upload.upload(buf.Bytes())
+		}
+		output, err := f.upload.complete()
+		if err != nil {
+			return toPathError(f.opts.conditionError(err), "Close", f.key)
+		}
+		f.setObject(output.ETag, output.VersionId)
+		return nil
+	}
 	input := &s3.PutObjectInput{
 		Bucket: aws.String(f.fsys.bucket),
 		Key:    aws.String(f.fsys.key(f.key)),
-		Body:   bytes.NewReader(f.buf.Bytes()),
+		Body:   bytes.NewReader(buf.Bytes()),
+	}
+	f.opts.applyPutObject(input)
+	output, err := f.fsys.client().PutObjectWithContext(f.fsys.context(), input, f.opts.requestOptions()...)
+	if err != nil {
+		return toPathError(f.opts.conditionError(err), "Close", f.key)
+	}
+	f.setObject(output.ETag, output.VersionId)
+	return nil
+}
+
+// setObject sets *ObjectInfo of the written object that Sys of Stat returns,
+// so the ETag can be used as IfMatch of the next write.
+func (f *s3WriterFile) setObject(etag, versionID *string) {
+	f.object = &ObjectInfo{
+		Bucket:    f.fsys.bucket,
+		Key:       f.fsys.key(f.key),
+		ETag:      aws.StringValue(etag),
+		VersionID: aws.StringValue(versionID),
 	}
-	f.buf = nil
-	var err error
-	_, err = f.fsys.api.PutObject(input)
-	return err
 }
 
 // Read reads bytes from this file.
@@ -0,0 +1,126 @@
+package s3fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"testing"
+	"testing/iotest"
+)
+
+func TestS3File_ReadSeekReadAt(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	want, err := fsys.ReadFile("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if err := iotest.TestReader(f, want); err != nil {
+		t.Errorf("Error TestReader: %v", err)
+	}
+}
+
+func TestS3File_Seek(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	want, err := fsys.ReadFile("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	seeker := f.(io.ReadSeeker)
+
+	tests := []struct {
+		offset int64
+		whence int
+		want   int64
+	}{
+		{offset: 2, whence: io.SeekStart, want: 2},
+		{offset: 1, whence: io.SeekCurrent, want: 4},
+		{offset: -1, whence: io.SeekEnd, want: int64(len(want)) - 1},
+	}
+	for _, test := range tests {
+		got, err := seeker.Seek(test.offset, test.whence)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.want {
+			t.Errorf("Error Seek(%d, %d) got %d; want %d", test.offset, test.whence, got, test.want)
+		}
+		p := make([]byte, 1)
+		if _, err := io.ReadFull(seeker, p); err != nil {
+			t.Fatal(err)
+		}
+		if p[0] != want[got] {
+			t.Errorf("Error Read after Seek got %q; want %q", p[0], want[got])
+		}
+	}
+
+	if _, err := seeker.Seek(-1, io.SeekStart); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Error Seek error got %v; want %v", err, fs.ErrInvalid)
+	}
+}
+
+func TestS3File_ReadAt(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	want, err := fsys.ReadFile("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	readerAt := f.(io.ReaderAt)
+
+	p := make([]byte, 3)
+	n, err := readerAt.ReadAt(p, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p[:n]) != string(want[1:4]) {
+		t.Errorf("Error ReadAt got %q; want %q", p[:n], want[1:4])
+	}
+
+	p = make([]byte, len(want))
+	n, err = readerAt.ReadAt(p, 2)
+	if err != io.EOF {
+		t.Errorf("Error ReadAt error got %v; want %v", err, io.EOF)
+	}
+	if string(p[:n]) != string(want[2:]) {
+		t.Errorf("Error ReadAt got %q; want %q", p[:n], want[2:])
+	}
+
+	if _, err := readerAt.ReadAt(p, int64(len(want))); err != io.EOF {
+		t.Errorf("Error ReadAt error got %v; want %v", err, io.EOF)
+	}
+}
+
+func TestS3File_Closed(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	f, err := fsys.Open("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Error Read error got %v; want %v", err, fs.ErrClosed)
+	}
+	if _, err := f.(io.ReaderAt).ReadAt(make([]byte, 1), 0); !errors.Is(err, fs.ErrClosed) {
+		t.Errorf("Error ReadAt error got %v; want %v", err, fs.ErrClosed)
+	}
+}
@@ -1,23 +1,28 @@
 package s3fs
 
 import (
+	"bytes"
+	"context"
 	"io"
 	"io/fs"
 	"path"
-	"sort"
 	"strings"
 	"syscall"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
-	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/jarxorg/wfs"
 )
 
 const (
 	defaultDirOpenBufferSize = 100
 	defaultListBufferSize    = 1000
+	defaultPartSize          = int64(5 * 1024 * 1024)
+	defaultUploadConcurrency = 5
+	defaultRemoveConcurrency = 5
+	defaultPrefetchPartSize  = int64(8 * 1024 * 1024)
+	defaultPrefetchRetries   = 3
 )
 
 // S3FS represents a filesystem on S3 (Amazon Simple Storage Service).
@@ -27,9 +32,72 @@ type S3FS struct {
 	// ListBufferSize is the buffer size for listing objects that is used on
 	// ReadDir, Glob and RemoveAll. (Default 1000)
 	ListBufferSize int
-	api            s3iface.S3API
-	bucket         string
-	dir            string
+	// PartSize is the size of each part of multipart uploads. A file that is
+	// written more than PartSize bytes is uploaded by multipart upload.
+	// PartSize is clamped between 5 MiB and 5 GiB that are the limits of S3.
+	// Multipart upload has at most 10,000 parts, so a file can be written up
+	// to 10,000 times PartSize bytes. (Default 5 MiB)
+	PartSize int64
+	// UploadConcurrency is the number of parts that are uploaded concurrently
+	// on multipart uploads. (Default 5)
+	UploadConcurrency int
+	// RemoveConcurrency is the number of DeleteObjects requests that are sent
+	// concurrently on RemoveAll. (Default 5)
+	RemoveConcurrency int
+	// PrefetchConcurrency is the number of parts that are fetched concurrently
+	// by the ranged GETs on reading files sequentially. If PrefetchConcurrency
+	// is greater than 0 then the files larger than PrefetchPartSize are read
+	// in parallel. (Default 0)
+	PrefetchConcurrency int
+	// PrefetchPartSize is the size of each part that is prefetched.
+	// (Default 8 MiB)
+	PrefetchPartSize int64
+	// PrefetchRetries is the number of retries of each prefetched part. The
+	// parts are retried with the backoff of RetryPolicy, or of the default
+	// RetryPolicy if RetryPolicy is nil. (Default 3)
+	PrefetchRetries int
+	// DirMarkers specifies whether MkdirAll creates the directory markers that
+	// are the empty objects whose keys end with a slash. The markers keep the
+	// empty directories. The markers are recognized as the directories
+	// regardless of DirMarkers.
+	DirMarkers bool
+	// InvalidKeys is the policy for the keys that are not valid as the names
+	// such as "a//b", "/a", "a/../b" and the keys that contain the invalid
+	// UTF-8 bytes. The policy is applied on ReadDir, Glob, WalkDir and
+	// RemoveAll. (Default SkipInvalidKeys)
+	InvalidKeys InvalidKeyPolicy
+	// RemoveAllVersions specifies whether RemoveAll deletes all versions and
+	// delete markers of the objects. Set true on versioned buckets to remove
+	// the objects permanently.
+	RemoveAllVersions bool
+	// RetryPolicy is the policy of retrying the requests to S3 that is
+	// applied on all operations in addition to the retryer of the client.
+	// The files that fail in the middle of reading are resumed from the
+	// current offset. If RetryPolicy is nil then the requests are not retried.
+	RetryPolicy *RetryPolicy
+	// RateLimiter limits the rate and the concurrency of the requests to S3
+	// that are sent by the filesystem and the files, directories and writers
+	// that it creates. If RateLimiter is nil then the requests are not
+	// limited.
+	RateLimiter *RateLimiter
+	// DefaultWriteOptions is the options that are used on writing files.
+	// The options specified on CreateFileWithOptions and WriteFileWithOptions
+	// override the defaults.
+	DefaultWriteOptions *WriteOptions
+	// DiskCache is the cache of the object bodies on the local disk that is
+	// used on Open and ReadFile. If DiskCache is nil then the bodies are not
+	// cached.
+	DiskCache *DiskCache
+	// MetadataCache is the cache of the directory listings and the results of
+	// Stat. If MetadataCache is nil then the results are not cached.
+	MetadataCache *MetadataCache
+	api           S3API
+	bucket        string
+	dir           string
+	ctx           context.Context
+	// minPartSize overrides the minimum part size of S3 to upload the small
+	// parts in the tests. (Default 5 MiB)
+	minPartSize int64
 }
 
 var (
@@ -66,39 +134,112 @@ func NewWithSession(bucket string, sess *session.Session) *S3FS {
 
 // NewWithAPI returns a filesystem for the tree of objects rooted at the specified
 // bucket with the s3 client.
-func NewWithAPI(bucket string, api s3iface.S3API) *S3FS {
+func NewWithAPI(bucket string, api S3API) *S3FS {
 	return &S3FS{
 		DirOpenBufferSize: defaultDirOpenBufferSize,
 		ListBufferSize:    defaultListBufferSize,
+		PartSize:          defaultPartSize,
+		UploadConcurrency: defaultUploadConcurrency,
+		RemoveConcurrency: defaultRemoveConcurrency,
+		PrefetchPartSize:  defaultPrefetchPartSize,
+		PrefetchRetries:   defaultPrefetchRetries,
 		api:               api,
 		bucket:            bucket,
 	}
 }
 
+// WithContext returns a shallow copy of the filesystem that uses the specified
+// context on all requests to S3. The files and directories that are opened by
+// the returned filesystem also use the context.
+func (fsys *S3FS) WithContext(ctx context.Context) *S3FS {
+	if ctx == nil {
+		panic("nil context")
+	}
+	ctxFsys := *fsys
+	ctxFsys.ctx = ctx
+	return &ctxFsys
+}
+
+func (fsys *S3FS) context() context.Context {
+	if fsys.ctx == nil {
+		return context.Background()
+	}
+	return fsys.ctx
+}
+
 func (fsys *S3FS) key(name string) string {
-	return path.Clean(path.Join(fsys.dir, name))
+	key := path.Clean(path.Join(fsys.dir, name))
+	if fsys.InvalidKeys == EscapeInvalidKeys && key != "." {
+		return unescapeKey(key)
+	}
+	return key
+}
+
+// prefix returns the prefix of the keys under the named directory.
+func (fsys *S3FS) prefix(name string) string {
+	if path.Clean(path.Join(fsys.dir, name)) == "." {
+		return ""
+	}
+	return fsys.key(name) + "/"
 }
 
-func (fsys *S3FS) rel(name string) string {
-	return strings.TrimPrefix(name, normalizePrefix(fsys.dir))
+// partSize returns PartSize clamped to the limits of S3.
+func (fsys *S3FS) partSize() int64 {
+	if fsys.PartSize <= 0 {
+		return defaultPartSize
+	}
+	minSize := fsys.minPartSize
+	if minSize <= 0 {
+		minSize = minPartSize
+	}
+	return min(max(fsys.PartSize, minSize), maxPartSize)
 }
 
-func (fsys *S3FS) openFile(name string) (*s3File, error) {
+func (fsys *S3FS) prefetchPartSize() int64 {
+	if fsys.PrefetchPartSize <= 0 {
+		return defaultPrefetchPartSize
+	}
+	return fsys.PrefetchPartSize
+}
+
+func (fsys *S3FS) openFile(name string) (fs.File, error) {
 	if !fs.ValidPath(name) {
 		return nil, toPathError(fs.ErrInvalid, "Open", name)
 	}
 	if name == "." || strings.HasSuffix(name, "/.") {
 		return nil, toPathError(fs.ErrNotExist, "Open", name)
 	}
+	if fsys.DiskCache != nil {
+		return fsys.DiskCache.open(fsys, name)
+	}
+	return fsys.getFile(name)
+}
+
+func (fsys *S3FS) getFile(name string) (*s3File, error) {
 	input := &s3.GetObjectInput{
 		Bucket: aws.String(fsys.bucket),
 		Key:    aws.String(fsys.key(name)),
 	}
-	output, err := fsys.api.GetObject(input)
+	output, err := fsys.client().GetObjectWithContext(fsys.context(), input)
 	if err != nil {
 		return nil, toPathError(err, "Open", name)
 	}
-	return newS3File(name, output), nil
+	return newS3File(fsys, name, output), nil
+}
+
+func (fsys *S3FS) statFile(name string) (*content, error) {
+	if !fs.ValidPath(name) {
+		return nil, toPathError(fs.ErrInvalid, "Stat", name)
+	}
+	if name == "." || strings.HasSuffix(name, "/.") {
+		return nil, toPathError(fs.ErrNotExist, "Stat", name)
+	}
+	info, err := fsys.headContent(fsys.key(name))
+	if err != nil {
+		return nil, toPathError(err, "Stat", name)
+	}
+	info.name = path.Base(name)
+	return info, nil
 }
 
 // Open opens the named file or directory.
@@ -133,11 +274,14 @@ func (fsys *S3FS) ReadFile(name string) ([]byte, error) {
 // Stat returns a FileInfo describing the file. If there is an error, it should be
 // of type *PathError.
 func (fsys *S3FS) Stat(name string) (fs.FileInfo, error) {
-	f, err := fsys.openFile(name)
+	info, err := fsys.statFile(name)
 	if err != nil && isNotExist(err) {
 		return newS3Dir(fsys, name).open(1)
 	}
-	return f, err
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
 }
 
 // Sub returns an FS corresponding to the subtree rooted at dir.
@@ -145,126 +289,90 @@ func (fsys *S3FS) Sub(dir string) (fs.FS, error) {
 	if !fs.ValidPath(dir) {
 		return nil, toPathError(fs.ErrInvalid, "Sub", dir)
 	}
-	subFsys := NewWithAPI(fsys.bucket, fsys.api)
+	subFsys := *fsys
 	subFsys.dir = path.Join(fsys.dir, dir)
-	return subFsys, nil
+	return &subFsys, nil
 }
 
-// Glob returns the names of all files matching pattern, providing an implementation
-// of the top-level Glob function.
-func (fsys *S3FS) Glob(pattern string) ([]string, error) {
-	if pattern == "" || pattern == "*" {
-		entries, err := fsys.ReadDir("")
-		if err != nil {
-			return nil, err
-		}
-		var keys []string
-		for _, entry := range entries {
-			keys = append(keys, entry.Name())
-		}
-		return keys, nil
-	}
-	// NOTE: Validate pattern
-	if _, err := path.Match(pattern, ""); err != nil {
-		return nil, toPathError(err, "Glob", pattern)
+// MkdirAll creates the directory markers of dir and its parents if
+// DirMarkers is true, otherwise MkdirAll does nothing. The specified mode is
+// ignored.
+func (fsys *S3FS) MkdirAll(dir string, mode fs.FileMode) error {
+	if !fs.ValidPath(dir) {
+		return toPathError(fs.ErrInvalid, "MkdirAll", dir)
 	}
-	keys, err := fsys.glob([]string{""}, strings.Split(pattern, "/"), nil)
-	if err != nil {
-		return nil, err
+	if !fsys.DirMarkers {
+		return nil
 	}
-	var matches []string
-	for _, key := range keys {
-		matches = appendIfMatch(matches, key, pattern)
+	var dirs []string
+	for d := dir; d != "."; d = path.Dir(d) {
+		dirs = append(dirs, d)
 	}
-	sort.Strings(matches)
-	return matches, nil
-}
-
-func (fsys *S3FS) glob(dirs, patterns []string, matches []string) ([]string, error) {
-	dirOnly := len(patterns) > 1
-	var subDirs []string
-	for _, dir := range dirs {
-		keys, err := fsys.listForGlob(path.Join(dir, patterns[0]), dirOnly)
-		if err != nil {
-			return nil, err
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if _, err := fsys.statFile(dirs[i]); err == nil {
+			return toPathError(syscall.ENOTDIR, "MkdirAll", dirs[i])
+		} else if !isNotExist(err) {
+			return toPathError(err, "MkdirAll", dir)
 		}
-		for _, key := range keys {
-			if dirOnly {
-				subDirs = append(subDirs, key)
-			}
-			matches = append(matches, key)
+		input := &s3.PutObjectInput{
+			Bucket: aws.String(fsys.bucket),
+			Key:    aws.String(fsys.key(dirs[i]) + "/"),
+			Body:   bytes.NewReader(nil),
 		}
-	}
-	if len(subDirs) > 0 && dirOnly {
-		return fsys.glob(subDirs, patterns[1:], matches)
-	}
-	return matches, nil
-}
-
-func (fsys *S3FS) listForGlob(pattern string, dirOnly bool) ([]string, error) {
-	input := &s3.ListObjectsV2Input{
-		Bucket:    aws.String(fsys.bucket),
-		Prefix:    aws.String(normalizePrefixPattern(fsys.dir, pattern)),
-		MaxKeys:   aws.Int64(int64(fsys.ListBufferSize)),
-		Delimiter: aws.String("/"),
-	}
-	var keys []string
-	for {
-		output, err := fsys.api.ListObjectsV2(input)
+		fsys.DefaultWriteOptions.merge(nil).applyPutObject(input)
+		_, err := fsys.client().PutObjectWithContext(fsys.context(), input)
+		fsys.invalidate(aws.StringValue(input.Key))
 		if err != nil {
-			return nil, toPathError(err, "Glob", pattern)
-		}
-		for _, p := range output.CommonPrefixes {
-			key := strings.TrimRight(fsys.rel(aws.StringValue(p.Prefix)), "/")
-			keys = appendIfMatch(keys, key, pattern)
-		}
-		if dirOnly {
-			return keys, nil
-		}
-		for _, o := range output.Contents {
-			key := fsys.rel(aws.StringValue(o.Key))
-			keys = appendIfMatch(keys, key, pattern)
-			input.StartAfter = o.Key
-		}
-		if !aws.BoolValue(output.IsTruncated) {
-			break
+			return toPathError(err, "MkdirAll", dir)
 		}
 	}
-	return keys, nil
-}
-
-// MkdirAll always do nothing.
-func (fsys *S3FS) MkdirAll(dir string, mode fs.FileMode) error {
 	return nil
 }
 
 // CreateFile creates the named file.
 // The specified mode is ignored.
 func (fsys *S3FS) CreateFile(name string, mode fs.FileMode) (wfs.WriterFile, error) {
+	return fsys.CreateFileWithOptions(name, mode, nil)
+}
+
+// CreateFileWithOptions creates the named file with the options.
+// The specified mode is ignored. If IfNoneMatch or IfMatch of the options is
+// specified then the preconditions are checked atomically by S3 on Close.
+func (fsys *S3FS) CreateFileWithOptions(name string, mode fs.FileMode, opts *WriteOptions) (wfs.WriterFile, error) {
 	if !fs.ValidPath(name) {
 		return nil, toPathError(fs.ErrInvalid, "CreateFile", name)
 	}
 
-	if _, err := fsys.openFile(name); err != nil {
+	opts = fsys.DefaultWriteOptions.merge(opts)
+	if _, err := fsys.statFile(name); err != nil {
 		if !isNotExist(err) {
 			return nil, toPathError(err, "CreateFile", name)
 		}
 		if _, err := newS3Dir(fsys, name).open(1); err == nil {
 			return nil, toPathError(syscall.EISDIR, "CreateFile", name)
 		}
+	} else if opts.IfNoneMatch != "" {
+		// NOTE: Fail fast, the precondition is checked again on Close.
+		return nil, toPathError(fs.ErrExist, "CreateFile", name)
 	}
 	dir := path.Dir(name)
-	if _, err := fsys.openFile(dir); err == nil {
+	if _, err := fsys.statFile(dir); err == nil {
 		return nil, toPathError(syscall.ENOTDIR, "CreateFile", dir)
 	}
 
-	return newS3WriterFile(fsys, name), nil
+	return newS3WriterFile(fsys, name, opts), nil
 }
 
 // WriteFile writes the specified bytes to the named file.
 // The specified mode is ignored.
 func (fsys *S3FS) WriteFile(name string, p []byte, mode fs.FileMode) (int, error) {
-	w, err := fsys.CreateFile(name, mode)
+	return fsys.WriteFileWithOptions(name, p, mode, nil)
+}
+
+// WriteFileWithOptions writes the specified bytes to the named file with the
+// options. The specified mode is ignored.
+func (fsys *S3FS) WriteFileWithOptions(name string, p []byte, mode fs.FileMode, opts *WriteOptions) (int, error) {
+	w, err := fsys.CreateFileWithOptions(name, mode, opts)
 	if err != nil {
 		return 0, err
 	}
@@ -281,45 +389,25 @@ func (fsys *S3FS) RemoveFile(name string) error {
 		Bucket: aws.String(fsys.bucket),
 		Key:    aws.String(fsys.key(name)),
 	}
+	defer fsys.invalidate(fsys.key(name))
 	var err error
-	_, err = fsys.api.DeleteObject(input)
+	_, err = fsys.client().DeleteObjectWithContext(fsys.context(), input)
 	if err != nil {
 		return toPathError(err, "RemoveFile", name)
 	}
 	return nil
 }
 
-// RemoveAll removes path and any children it contains.
+// RemoveAll removes path and any children it contains. The objects are
+// listed and deleted concurrently by DeleteObjects in batches of 1000 keys.
+// If some keys could not be deleted then RemoveAll returns *RemoveAllError
+// that lists the failed keys. The invalid keys are handled by InvalidKeys, so
+// the skipped keys are not deleted.
 func (fsys *S3FS) RemoveAll(dir string) error {
-	input := &s3.ListObjectsV2Input{
-		Bucket:  aws.String(fsys.bucket),
-		Prefix:  aws.String(normalizePrefix(fsys.key(dir))),
-		MaxKeys: aws.Int64(int64(fsys.ListBufferSize)),
-	}
-	delInput := &s3.DeleteObjectsInput{
-		Bucket: aws.String(fsys.bucket),
-		Delete: &s3.Delete{Quiet: aws.Bool(true)},
-	}
-	for {
-		output, err := fsys.api.ListObjectsV2(input)
-		if err != nil {
-			return toPathError(err, "RemoveAll", dir)
-		}
-		var ids []*s3.ObjectIdentifier
-		for _, o := range output.Contents {
-			ids = append(ids, &s3.ObjectIdentifier{Key: o.Key})
-			input.StartAfter = o.Key
-		}
-		delInput.Delete.Objects = ids
-
-		_, err = fsys.api.DeleteObjects(delInput)
-		if err != nil {
-			return toPathError(err, "RemoveAll", dir)
-		}
-
-		if !*output.IsTruncated {
-			break
-		}
+	prefix := fsys.prefix(dir)
+	defer fsys.invalidateAll(prefix)
+	if err := fsys.removeAll(prefix); err != nil {
+		return toPathError(err, "RemoveAll", dir)
 	}
 	return nil
 }
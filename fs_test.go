@@ -1,11 +1,18 @@
 package s3fs
 
 import (
+	"context"
+	"errors"
 	"io/fs"
+	"reflect"
+	"syscall"
 	"testing"
 	"testing/fstest"
 
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
 	"github.com/jarxorg/wfs"
 	"github.com/jarxorg/wfs/memfs"
 	"github.com/jarxorg/wfs/osfs"
@@ -31,7 +38,7 @@ func newMemFSTesting(t *testing.T) *memfs.MemFS {
 }
 
 type mockFSS3API struct {
-	*fsS3api
+	*s3fake.API
 	err error
 }
 
@@ -41,7 +48,7 @@ func newMockFSS3API() (*mockFSS3API, error) {
 		return nil, err
 	}
 	return &mockFSS3API{
-		fsS3api: newFsS3api(fsys),
+		API: s3fake.New(fsys),
 	}, nil
 }
 
@@ -53,25 +60,51 @@ func newMockFSS3APITesting(t *testing.T) *mockFSS3API {
 	return api
 }
 
-func (m *mockFSS3API) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+// numUploads returns the number of the in-progress multipart uploads of the
+// bucket.
+func (m *mockFSS3API) numUploads(t *testing.T, bucket string) int {
+	output, err := m.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+		Bucket: aws.String(bucket),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(output.Uploads)
+}
+
+func (m *mockFSS3API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	return m.fsS3api.GetObject(input)
+	return m.API.GetObjectWithContext(ctx, input, opts...)
 }
 
-func (m *mockFSS3API) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+func (m *mockFSS3API) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	return m.fsS3api.PutObject(input)
+	return m.API.HeadObjectWithContext(ctx, input, opts...)
 }
 
-func (m *mockFSS3API) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+func (m *mockFSS3API) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
 	if m.err != nil {
 		return nil, m.err
 	}
-	return m.fsS3api.ListObjectsV2(input)
+	return m.API.PutObjectWithContext(ctx, input, opts...)
+}
+
+func (m *mockFSS3API) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.API.ListObjectsV2WithContext(ctx, input, opts...)
+}
+
+func (m *mockFSS3API) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.API.UploadPartWithContext(ctx, input, opts...)
 }
 
 func TestFS(t *testing.T) {
@@ -91,3 +124,158 @@ func TestWriteFileFS(t *testing.T) {
 		t.Errorf("Error wfstest: %+v", err)
 	}
 }
+
+func TestMkdirAll_DirMarkers(t *testing.T) {
+	srcFsys := memfs.New()
+	if err := srcFsys.MkdirAll("src/empty/sub", fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := srcFsys.WriteFile("src/file.txt", []byte("test"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	fsys.DirMarkers = true
+	if err := wfs.CopyFS(fsys, srcFsys, "src"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "src/empty/sub", "src/file.txt"); err != nil {
+		t.Errorf("Error testing/fstest: %+v", err)
+	}
+	info, err := fsys.Stat("src/empty/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Errorf("Error Stat IsDir false; want true")
+	}
+	entries, err := fsys.ReadDir("src/empty/sub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Error ReadDir got %d entries; want 0", len(entries))
+	}
+	matches, err := fsys.Glob("src/empty/*")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"src/empty/sub"}; !reflect.DeepEqual(matches, want) {
+		t.Errorf("Error Glob got %v; want %v", matches, want)
+	}
+
+	paths, err := walkPaths(fsys.WalkDir, "src", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"src/", "src/empty/", "src/empty/sub/", "src/file.txt"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("Error WalkDir got %v; want %v", paths, want)
+	}
+
+	if err := fsys.Rename("src", "dst"); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := fsys.Stat("dst/empty/sub"); err != nil || !info.IsDir() {
+		t.Errorf("Error Stat after Rename got %v, %v; want directory", info, err)
+	}
+	if err := fsys.RemoveAll("dst"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("dst"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+
+	if err := fsys.MkdirAll("dir0/file01.txt/sub", fs.ModePerm); !errors.Is(err, syscall.ENOTDIR) {
+		t.Errorf("Error MkdirAll error got %v; want %v", err, syscall.ENOTDIR)
+	}
+	if err := fsys.MkdirAll("../invalid", fs.ModePerm); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Error MkdirAll error got %v; want %v", err, fs.ErrInvalid)
+	}
+
+	fsys.DirMarkers = false
+	if err := fsys.MkdirAll("nomarker", fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("nomarker"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+type noGetObjectAPI struct {
+	*mockFSS3API
+	t *testing.T
+}
+
+func (m *noGetObjectAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	m.t.Errorf("Error GetObject is called on %s", *input.Key)
+	return m.mockFSS3API.GetObjectWithContext(ctx, input, opts...)
+}
+
+func TestStat(t *testing.T) {
+	fsys := NewWithAPI("testdata", &noGetObjectAPI{mockFSS3API: newMockFSS3APITesting(t), t: t})
+
+	info, err := fsys.Stat("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name() != "file01.txt" || info.IsDir() || info.Size() == 0 {
+		t.Errorf("Error Stat got %s (dir %v, size %d)", info.Name(), info.IsDir(), info.Size())
+	}
+
+	info, err = fsys.Stat("dir0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.IsDir() {
+		t.Errorf("Error Stat dir0 IsDir false; want true")
+	}
+
+	if _, err := fsys.Stat("not-found.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+
+	if _, err := fsys.CreateFile("dir0/file01.txt", fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithContext(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	ctxFsys := fsys.WithContext(ctx)
+	ctxFsys.DirOpenBufferSize = 1
+
+	d, err := ctxFsys.Open(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+	dir := d.(fs.ReadDirFile)
+	if _, err := dir.ReadDir(1); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	if _, err := dir.ReadDir(-1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error ReadDir error got %v; want %v", err, context.Canceled)
+	}
+	if _, err := ctxFsys.ReadDir("dir0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error ReadDir error got %v; want %v", err, context.Canceled)
+	}
+	if err := ctxFsys.RemoveAll("dir0"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error RemoveAll error got %v; want %v", err, context.Canceled)
+	}
+	if _, err := ctxFsys.Glob("dir0/*"); !errors.Is(err, context.Canceled) {
+		t.Errorf("Error Glob error got %v; want %v", err, context.Canceled)
+	}
+	if _, err := ctxFsys.ReadFile("dir0/file01.txt"); err == nil {
+		t.Errorf("Error ReadFile returns no error")
+	}
+	if _, err := ctxFsys.WriteFile("test.txt", []byte("test"), fs.ModePerm); err == nil {
+		t.Errorf("Error WriteFile returns no error")
+	}
+
+	if _, err := fsys.ReadFile("dir0/file01.txt"); err != nil {
+		t.Errorf("Error ReadFile on the parent filesystem: %v", err)
+	}
+}
@@ -0,0 +1,346 @@
+package s3fs
+
+import (
+	"errors"
+	"io/fs"
+	"iter"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// errStopGlob stops the glob when the iteration is stopped.
+var errStopGlob = errors.New("stop glob")
+
+// Glob returns the names of all files and directories matching pattern,
+// providing an implementation of the top-level Glob function. The names are
+// sorted.
+//
+// In addition to the syntax of path.Match, the pattern supports "**" that
+// matches zero or more directories, and "{a,b}" that matches either of the
+// alternatives. See GlobSeq for how the objects are listed.
+func (fsys *S3FS) Glob(pattern string) ([]string, error) {
+	var matches []string
+	for name, err := range fsys.GlobSeq(pattern) {
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, name)
+	}
+	slices.Sort(matches)
+	return slices.Compact(matches), nil
+}
+
+// GlobSeq returns an iterator over the names matching pattern. The names are
+// yielded while listing the objects, so GlobSeq is suitable for the patterns
+// that match huge number of objects. Unlike Glob, the names are not sorted and
+// a name that is both a file and a directory is yielded twice.
+//
+// The objects are listed under the longest literal prefix of the pattern. If
+// the pattern contains "**" then all objects under the prefix are listed
+// without the delimiter at once, and the directories that cannot match are
+// skipped. Otherwise each level of the pattern is listed with the delimiter
+// and the literal directories are not listed.
+func (fsys *S3FS) GlobSeq(pattern string) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		patterns, err := expandBraces(pattern)
+		if err == nil {
+			err = validatePatterns(patterns)
+		}
+		if err != nil {
+			yield("", toPathError(err, "Glob", pattern))
+			return
+		}
+		fn := func(name string) error {
+			if !yield(name, nil) {
+				return errStopGlob
+			}
+			return nil
+		}
+		if len(patterns) > 1 {
+			// NOTE: The alternatives may match the same name.
+			seen := map[string]bool{}
+			yieldOnce := fn
+			fn = func(name string) error {
+				if seen[name] {
+					return nil
+				}
+				seen[name] = true
+				return yieldOnce(name)
+			}
+		}
+		for _, p := range patterns {
+			if err := fsys.glob(p, fn); err != nil {
+				if err != errStopGlob {
+					yield("", err)
+				}
+				return
+			}
+		}
+	}
+}
+
+// glob calls fn with the names matching the pattern that has no braces.
+func (fsys *S3FS) glob(pattern string, fn func(name string) error) error {
+	segments := strings.Split(pattern, "/")
+	if slices.Contains(segments, "**") {
+		return fsys.globFlat(pattern, segments, fn)
+	}
+	return fsys.globLevel("", segments, fn)
+}
+
+// globFlat lists all objects under the literal prefix of the pattern without
+// the delimiter.
+func (fsys *S3FS) globFlat(pattern string, segments []string, fn func(name string) error) error {
+	root := "."
+	n := 0
+	for n < len(segments)-1 && !hasMeta(segments[n]) {
+		n++
+	}
+	if n > 0 {
+		root = path.Join(segments[:n]...)
+	}
+	listPrefix := segments[n]
+	if i := strings.IndexAny(listPrefix, `*?[\`); i != -1 {
+		listPrefix = listPrefix[:i]
+	}
+	return newWalker(fsys, root, listPrefix, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if isNotExist(err) {
+				return nil
+			}
+			return toPathError(errors.Unwrap(err), "Glob", pattern)
+		}
+		if name == "." {
+			return nil
+		}
+		names := strings.Split(name, "/")
+		if matchSegments(segments, names) {
+			if err := fn(name); err != nil {
+				return err
+			}
+		}
+		if d.IsDir() && !matchDirSegments(segments, names) {
+			return fs.SkipDir
+		}
+		return nil
+	}).walk()
+}
+
+// globLevel lists the objects in dir that match the first segment with the
+// delimiter, and globs the subdirectories with the rest segments.
+func (fsys *S3FS) globLevel(dir string, segments []string, fn func(name string) error) error {
+	for len(segments) > 1 && !hasMeta(segments[0]) {
+		dir = path.Join(dir, segments[0])
+		segments = segments[1:]
+	}
+	last := len(segments) == 1
+	levelPattern := path.Join(dir, segments[0])
+	return fsys.listForGlob(levelPattern, !last, func(name string) error {
+		if ok, _ := path.Match(levelPattern, name); !ok {
+			return nil
+		}
+		if last {
+			return fn(name)
+		}
+		return fsys.globLevel(name, segments[1:], fn)
+	})
+}
+
+// listForGlob calls fn with the names of the objects and the directories
+// that start with the literal prefix of the pattern. If dirOnly is true then
+// only the directories are listed.
+func (fsys *S3FS) listForGlob(pattern string, dirOnly bool, fn func(name string) error) error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String(fsys.bucket),
+		Prefix:    aws.String(fsys.globPrefix(pattern)),
+		MaxKeys:   aws.Int64(int64(fsys.ListBufferSize)),
+		Delimiter: aws.String("/"),
+	}
+	root := fsys.prefix(".")
+	// call calls fn with the name of the key if the key is not skipped.
+	call := func(key, rel string) error {
+		ok, err := fsys.checkKey(key, rel[strings.LastIndex(rel, "/")+1:])
+		if err != nil {
+			return toPathError(err, "Glob", pattern)
+		}
+		if !ok {
+			return nil
+		}
+		return fn(fsys.toName(rel))
+	}
+	for {
+		if err := fsys.context().Err(); err != nil {
+			return toPathError(err, "Glob", pattern)
+		}
+		output, err := fsys.listObjectsV2(input)
+		if err != nil {
+			return toPathError(err, "Glob", pattern)
+		}
+		for _, p := range output.CommonPrefixes {
+			prefix := aws.StringValue(p.Prefix)
+			if err := call(prefix, strings.TrimSuffix(strings.TrimPrefix(prefix, root), "/")); err != nil {
+				return err
+			}
+		}
+		if !dirOnly {
+			for _, o := range output.Contents {
+				key := aws.StringValue(o.Key)
+				if strings.HasSuffix(key, "/") {
+					// NOTE: The directory marker is not a file.
+					continue
+				}
+				if err := call(key, strings.TrimPrefix(key, root)); err != nil {
+					return err
+				}
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) || output.NextContinuationToken == nil {
+			return nil
+		}
+		input.ContinuationToken = output.NextContinuationToken
+	}
+}
+
+// globPrefix returns the prefix of the listing for the literal prefix of the
+// pattern.
+func (fsys *S3FS) globPrefix(pattern string) string {
+	if fsys.InvalidKeys != EscapeInvalidKeys {
+		return normalizePrefixPattern(fsys.dir, pattern)
+	}
+	if i := strings.IndexAny(pattern, `*?[\`); i != -1 {
+		pattern = pattern[:i]
+	}
+	dir, partial := path.Split(pattern)
+	return fsys.prefix(dir) + fsys.toKeyPrefix(partial)
+}
+
+// hasMeta reports whether the segment of the pattern has the special
+// characters of path.Match.
+func hasMeta(segment string) bool {
+	return strings.ContainsAny(segment, `*?[\`)
+}
+
+// expandBraces expands the braces of the pattern such as "{a,b}" to the
+// patterns of each alternative. The braces can be nested. expandBraces
+// returns path.ErrBadPattern if the opening brace is not closed.
+func expandBraces(pattern string) ([]string, error) {
+	start := -1
+	depth := 0
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '\\':
+			i++
+		case '{':
+			if depth == 0 {
+				start = i
+			}
+			depth++
+		case '}':
+			if depth == 0 {
+				// NOTE: The unmatched closing brace is literal.
+				continue
+			}
+			depth--
+			if depth > 0 {
+				continue
+			}
+			var patterns []string
+			for _, alt := range splitAlternatives(pattern[start+1 : i]) {
+				expanded, err := expandBraces(pattern[:start] + alt + pattern[i+1:])
+				if err != nil {
+					return nil, err
+				}
+				patterns = append(patterns, expanded...)
+			}
+			return patterns, nil
+		}
+	}
+	if depth != 0 {
+		return nil, path.ErrBadPattern
+	}
+	return []string{pattern}, nil
+}
+
+// splitAlternatives splits s by the commas that are not in the nested braces.
+func splitAlternatives(s string) []string {
+	var alts []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case ',':
+			if depth == 0 {
+				alts = append(alts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(alts, s[start:])
+}
+
+// validatePatterns returns path.ErrBadPattern if any segment of the patterns
+// is malformed.
+func validatePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		for _, segment := range strings.Split(pattern, "/") {
+			if _, err := path.Match(segment, ""); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// matchSegments reports whether the names match the segments of the pattern.
+// The segment "**" matches zero or more names.
+func matchSegments(segments, names []string) bool {
+	for len(segments) > 0 {
+		if segments[0] == "**" {
+			if len(segments) == 1 {
+				return true
+			}
+			for i := 0; i <= len(names); i++ {
+				if matchSegments(segments[1:], names[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(names) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(segments[0], names[0]); !ok {
+			return false
+		}
+		segments, names = segments[1:], names[1:]
+	}
+	return len(names) == 0
+}
+
+// matchDirSegments reports whether the names under the directory of the names
+// can match the segments of the pattern.
+func matchDirSegments(segments, names []string) bool {
+	for len(names) > 0 {
+		if len(segments) == 0 {
+			return false
+		}
+		if segments[0] == "**" {
+			return true
+		}
+		if ok, _ := path.Match(segments[0], names[0]); !ok {
+			return false
+		}
+		segments, names = segments[1:], names[1:]
+	}
+	return len(segments) > 0
+}
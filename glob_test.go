@@ -0,0 +1,184 @@
+package s3fs
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGlob(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{
+			pattern: "",
+		}, {
+			pattern: "*",
+			want:    []string{"dir0", "file0.txt", "file1.txt", "file2.txt"},
+		}, {
+			pattern: "*.txt",
+			want:    []string{"file0.txt", "file1.txt", "file2.txt"},
+		}, {
+			pattern: "dir0/*",
+			want:    []string{"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt"},
+		}, {
+			pattern: "*/*2.txt",
+			want:    []string{"dir0/file02.txt"},
+		}, {
+			pattern: "d*",
+			want:    []string{"dir0"},
+		}, {
+			pattern: "**",
+			want: []string{
+				"dir0", "dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt",
+				"file0.txt", "file1.txt", "file2.txt",
+			},
+		}, {
+			pattern: "**/*1.txt",
+			want:    []string{"dir0/file01.txt", "file1.txt"},
+		}, {
+			pattern: "dir0/**",
+			want:    []string{"dir0", "dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt"},
+		}, {
+			pattern: "dir0/fi**/**",
+			want:    []string{"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt"},
+		}, {
+			pattern: "{file0,file2}.txt",
+			want:    []string{"file0.txt", "file2.txt"},
+		}, {
+			pattern: "{dir0/*1.txt,file{1,2}.txt}",
+			want:    []string{"dir0/file01.txt", "file1.txt", "file2.txt"},
+		}, {
+			pattern: "{**/file0*,dir0/*1.txt}",
+			want:    []string{"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt", "file0.txt"},
+		}, {
+			pattern: "not-found/**",
+		}, {
+			pattern: "not-found/*",
+		},
+	}
+	for _, test := range tests {
+		got, err := fsys.Glob(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Error Glob(%s) got %v; want %v", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestGlob_BadPattern(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	for _, pattern := range []string{"[", "dir0/[", "{a", "{a,[}"} {
+		if _, err := fsys.Glob(pattern); !errors.Is(err, path.ErrBadPattern) {
+			t.Errorf("Error Glob(%s) error got %v; want %v", pattern, err, path.ErrBadPattern)
+		}
+	}
+}
+
+func TestGlob_ListError(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	api.err = errors.New("test")
+	fsys := NewWithAPI("testdata", api)
+	for _, pattern := range []string{"*/*.txt", "**/*.txt"} {
+		if _, err := fsys.Glob(pattern); !errors.Is(err, api.err) {
+			t.Errorf("Error Glob(%s) error got %v; want %v", pattern, err, api.err)
+		}
+	}
+}
+
+func TestGlobSeq_Break(t *testing.T) {
+	files := map[string][]byte{}
+	for i := 0; i < 100; i++ {
+		files[fmt.Sprintf("dir%02d/file.txt", i)] = []byte("test")
+	}
+	fsys, api := newCountFSTesting(t, files)
+	fsys.ListBufferSize = 10
+
+	for _, pattern := range []string{"*/file.txt", "**/file.txt"} {
+		api.reset()
+		var got []string
+		for name, err := range fsys.GlobSeq(pattern) {
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, name)
+			if len(got) == 3 {
+				break
+			}
+		}
+		if want := []string{"dir00/file.txt", "dir01/file.txt", "dir02/file.txt"}; !reflect.DeepEqual(got, want) {
+			t.Errorf("Error GlobSeq(%s) got %v; want %v", pattern, got, want)
+		}
+		if n := api.count("ListObjectsV2"); n > 4 {
+			t.Errorf("Error GlobSeq(%s) requests %d; want <= 4", pattern, n)
+		}
+	}
+}
+
+func TestExpandBraces(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{
+			pattern: "a",
+			want:    []string{"a"},
+		}, {
+			pattern: "{a,b}/c",
+			want:    []string{"a/c", "b/c"},
+		}, {
+			pattern: "{a,b{c,d}}{e,}",
+			want:    []string{"ae", "a", "bce", "bc", "bde", "bd"},
+		}, {
+			pattern: `\{a,b}`,
+			want:    []string{`\{a,b}`},
+		}, {
+			pattern: "a}",
+			want:    []string{"a}"},
+		},
+	}
+	for _, test := range tests {
+		got, err := expandBraces(test.pattern)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Error expandBraces(%s) got %v; want %v", test.pattern, got, test.want)
+		}
+	}
+}
+
+func TestMatchSegments(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+		wantDir bool
+	}{
+		{pattern: "a/*", name: "a/b", want: true},
+		{pattern: "a/*", name: "a", wantDir: true},
+		{pattern: "**", name: "a/b/c", want: true, wantDir: true},
+		{pattern: "a/**/c", name: "a/c", want: true, wantDir: true},
+		{pattern: "a/**/c", name: "a/b/b/c", want: true, wantDir: true},
+		{pattern: "a/**/c", name: "b/c"},
+		{pattern: "a/*/c", name: "a/b", wantDir: true},
+		{pattern: "a/*/c", name: "a/b/c", want: true},
+	}
+	for _, test := range tests {
+		segments := strings.Split(test.pattern, "/")
+		names := strings.Split(test.name, "/")
+		if got := matchSegments(segments, names); got != test.want {
+			t.Errorf("Error matchSegments(%s, %s) got %v; want %v", test.pattern, test.name, got, test.want)
+		}
+		if got := matchDirSegments(segments, names); got != test.wantDir {
+			t.Errorf("Error matchDirSegments(%s, %s) got %v; want %v", test.pattern, test.name, got, test.wantDir)
+		}
+	}
+}
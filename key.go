@@ -0,0 +1,236 @@
+package s3fs
+
+import (
+	"fmt"
+	"io/fs"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// InvalidKeyPolicy specifies how the keys that are not valid as the names of
+// fs.FS are handled. The keys that contain the empty elements such as "a//b"
+// and "/a", the "." or ".." elements, or the invalid UTF-8 bytes are invalid.
+type InvalidKeyPolicy int
+
+const (
+	// SkipInvalidKeys skips the invalid keys. The objects of the invalid keys
+	// are not listed and not removed by RemoveAll.
+	SkipInvalidKeys InvalidKeyPolicy = iota
+	// EscapeInvalidKeys escapes the invalid elements of the keys by the
+	// percent-encoding. The empty element is escaped as "%2F", "." and ".."
+	// are escaped as "%2E" and "%2E%2E", and the invalid UTF-8 bytes are
+	// escaped as "%XX". "%" of all names is also escaped as "%25", so the
+	// escaped names can be opened. The names that are not escaped correctly
+	// are used as the keys as is.
+	EscapeInvalidKeys
+	// ErrorOnInvalidKeys returns *InvalidKeyError if an invalid key is found.
+	ErrorOnInvalidKeys
+)
+
+// InvalidKeyError is the error that is returned if the key is not valid as
+// the name and the policy is ErrorOnInvalidKeys.
+type InvalidKeyError struct {
+	Key string
+}
+
+// Error returns the string of the error.
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf("invalid key %q", e.Key)
+}
+
+// Unwrap returns fs.ErrInvalid.
+func (e *InvalidKeyError) Unwrap() error {
+	return fs.ErrInvalid
+}
+
+// isValidElem reports whether the element of the key is valid as the element
+// of the name.
+func isValidElem(elem string) bool {
+	return elem != "" && elem != "." && elem != ".." && utf8.ValidString(elem)
+}
+
+// isValidKey reports whether all elements of the relative key are valid.
+func isValidKey(rel string) bool {
+	for _, elem := range strings.Split(rel, "/") {
+		if !isValidElem(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+const upperhex = "0123456789ABCDEF"
+
+// escapeElem escapes the element of the key.
+func escapeElem(elem string) string {
+	switch elem {
+	case "":
+		return "%2F"
+	case ".":
+		return "%2E"
+	case "..":
+		return "%2E%2E"
+	}
+	var b strings.Builder
+	for i := 0; i < len(elem); {
+		r, size := utf8.DecodeRuneInString(elem[i:])
+		if elem[i] == '%' || (r == utf8.RuneError && size == 1) {
+			b.WriteByte('%')
+			b.WriteByte(upperhex[elem[i]>>4])
+			b.WriteByte(upperhex[elem[i]&15])
+			i++
+			continue
+		}
+		b.WriteString(elem[i : i+size])
+		i += size
+	}
+	return b.String()
+}
+
+// unescapeElem unescapes the element that is escaped by escapeElem.
+func unescapeElem(elem string) (string, error) {
+	if elem == "%2F" {
+		return "", nil
+	}
+	s, err := url.PathUnescape(elem)
+	if err != nil || strings.Contains(s, "/") {
+		return "", fs.ErrInvalid
+	}
+	return s, nil
+}
+
+// escapeKey escapes each element of the relative key.
+func escapeKey(rel string) string {
+	elems := strings.Split(rel, "/")
+	for i, elem := range elems {
+		elems[i] = escapeElem(elem)
+	}
+	return strings.Join(elems, "/")
+}
+
+// unescapeKey unescapes each element of the name. If the name is not escaped
+// correctly then unescapeKey returns the name as is.
+func unescapeKey(name string) string {
+	elems := strings.Split(name, "/")
+	for i, elem := range elems {
+		s, err := unescapeElem(elem)
+		if err != nil {
+			return name
+		}
+		elems[i] = s
+	}
+	return strings.Join(elems, "/")
+}
+
+// checkKey checks the relative key rel of the key by InvalidKeys. checkKey
+// returns false if the key is skipped, and returns *InvalidKeyError if the
+// policy is ErrorOnInvalidKeys.
+func (fsys *S3FS) checkKey(key, rel string) (bool, error) {
+	if fsys.InvalidKeys == EscapeInvalidKeys || isValidKey(rel) {
+		return true, nil
+	}
+	if fsys.InvalidKeys == ErrorOnInvalidKeys {
+		return false, &InvalidKeyError{Key: key}
+	}
+	return false, nil
+}
+
+// toName converts the relative key to the name.
+func (fsys *S3FS) toName(rel string) string {
+	if fsys.InvalidKeys == EscapeInvalidKeys {
+		return escapeKey(rel)
+	}
+	return rel
+}
+
+// toKeyPrefix converts the partial element of the name that is used as the
+// prefix of the listing. If the element can not be unescaped then
+// toKeyPrefix returns the empty string that lists more keys.
+func (fsys *S3FS) toKeyPrefix(partial string) string {
+	if fsys.InvalidKeys != EscapeInvalidKeys {
+		return partial
+	}
+	s, err := url.PathUnescape(partial)
+	if err != nil || strings.Contains(s, "/") {
+		return ""
+	}
+	return s
+}
+
+// listObjectsV2 calls ListObjectsV2 with EncodingType=url, so the keys that
+// contain the characters that are not allowed in XML are listed, and decodes
+// the keys of the output.
+func (fsys *S3FS) listObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	input.EncodingType = aws.String(s3.EncodingTypeUrl)
+	output, err := fsys.client().ListObjectsV2WithContext(fsys.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	// NOTE: The keys are not encoded if the server ignores EncodingType.
+	if aws.StringValue(output.EncodingType) != s3.EncodingTypeUrl {
+		return output, nil
+	}
+	for _, o := range output.Contents {
+		if o.Key, err = decodeKey(o.Key); err != nil {
+			return nil, err
+		}
+	}
+	for _, p := range output.CommonPrefixes {
+		if p.Prefix, err = decodeKey(p.Prefix); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range []**string{&output.Prefix, &output.Delimiter, &output.StartAfter} {
+		if *s, err = decodeKey(*s); err != nil {
+			return nil, err
+		}
+	}
+	output.EncodingType = nil
+	return output, nil
+}
+
+// listObjectVersionsPage calls ListObjectVersions with EncodingType=url and
+// decodes the keys of the output.
+func (fsys *S3FS) listObjectVersionsPage(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	input.EncodingType = aws.String(s3.EncodingTypeUrl)
+	output, err := fsys.client().ListObjectVersionsWithContext(fsys.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(output.EncodingType) != s3.EncodingTypeUrl {
+		return output, nil
+	}
+	for _, v := range output.Versions {
+		if v.Key, err = decodeKey(v.Key); err != nil {
+			return nil, err
+		}
+	}
+	for _, m := range output.DeleteMarkers {
+		if m.Key, err = decodeKey(m.Key); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range []**string{&output.Prefix, &output.KeyMarker, &output.NextKeyMarker} {
+		if *s, err = decodeKey(*s); err != nil {
+			return nil, err
+		}
+	}
+	output.EncodingType = nil
+	return output, nil
+}
+
+// decodeKey decodes the key that is encoded by EncodingType=url.
+func decodeKey(key *string) (*string, error) {
+	if key == nil {
+		return nil, nil
+	}
+	s, err := url.QueryUnescape(*key)
+	if err != nil {
+		return nil, err
+	}
+	return aws.String(s), nil
+}
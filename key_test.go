@@ -0,0 +1,328 @@
+package s3fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
+	"github.com/jarxorg/wfs/memfs"
+)
+
+// keysAPI serves the objects of the keys that can not be stored on the
+// filesystem of s3fake such as "a//b" and "a/../b". The body of each object is
+// its key. The listings are returned in one page.
+type keysAPI struct {
+	*s3fake.API
+	mutex   sync.Mutex
+	objects map[string]bool
+}
+
+func newKeysAPI(keys ...string) *keysAPI {
+	api := &keysAPI{API: s3fake.New(memfs.New()), objects: map[string]bool{}}
+	for _, key := range keys {
+		api.objects[key] = true
+	}
+	return api
+}
+
+func (api *keysAPI) keys() []string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	var keys []string
+	for key := range api.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func (api *keysAPI) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	encode := func(s string) *string {
+		if aws.StringValue(input.EncodingType) == s3.EncodingTypeUrl {
+			s = strings.ReplaceAll(url.QueryEscape(s), "%2F", "/")
+		}
+		return aws.String(s)
+	}
+	prefix, delimiter := aws.StringValue(input.Prefix), aws.StringValue(input.Delimiter)
+	output := &s3.ListObjectsV2Output{
+		Prefix:       encode(prefix),
+		EncodingType: input.EncodingType,
+		IsTruncated:  aws.Bool(false),
+	}
+	seen := map[string]bool{}
+	for _, key := range api.keys() {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		if i := strings.Index(key[len(prefix):], delimiter); delimiter != "" && i != -1 {
+			p := key[:len(prefix)+i+len(delimiter)]
+			if !seen[p] {
+				seen[p] = true
+				output.CommonPrefixes = append(output.CommonPrefixes, &s3.CommonPrefix{Prefix: encode(p)})
+			}
+			continue
+		}
+		output.Contents = append(output.Contents, &s3.Object{
+			Key:  encode(key),
+			Size: aws.Int64(int64(len(key))),
+		})
+	}
+	return output, nil
+}
+
+func (api *keysAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if !api.objects[key] {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "NoSuchKey", nil)
+	}
+	return &s3.GetObjectOutput{
+		Body:          io.NopCloser(strings.NewReader(key)),
+		ContentLength: aws.Int64(int64(len(key))),
+	}, nil
+}
+
+func (api *keysAPI) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if !api.objects[key] {
+		return nil, awserr.New(errCodeNotFound, "Not Found", nil)
+	}
+	return &s3.HeadObjectOutput{ContentLength: aws.Int64(int64(len(key)))}, nil
+}
+
+func (api *keysAPI) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	for _, id := range input.Delete.Objects {
+		delete(api.objects, aws.StringValue(id.Key))
+	}
+	return &s3.DeleteObjectsOutput{}, nil
+}
+
+var testInvalidKeys = []string{
+	"/c",
+	"100%.txt",
+	"a//b",
+	"d/./e",
+	"dir/../x",
+	"dir/ok.txt",
+	"h\xff",
+	"ok.txt",
+}
+
+func newInvalidKeysFSTesting(policy InvalidKeyPolicy) (*S3FS, *keysAPI) {
+	api := newKeysAPI(testInvalidKeys...)
+	fsys := NewWithAPI("bucket", api)
+	fsys.InvalidKeys = policy
+	return fsys, api
+}
+
+func walkNames(t *testing.T, fsys *S3FS, root string) []string {
+	var names []string
+	err := fsys.WalkDir(root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return names
+}
+
+func TestEscapeKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{key: "a/b", want: "a/b"},
+		{key: "a//b", want: "a/%2F/b"},
+		{key: "/a", want: "%2F/a"},
+		{key: "a/./b", want: "a/%2E/b"},
+		{key: "../a", want: "%2E%2E/a"},
+		{key: "100%", want: "100%25"},
+		{key: "a\xffb", want: "a%FFb"},
+		{key: "日本", want: "日本"},
+	}
+	for _, test := range tests {
+		got := escapeKey(test.key)
+		if got != test.want {
+			t.Errorf("Error escapeKey(%q) got %q; want %q", test.key, got, test.want)
+		}
+		if !fs.ValidPath(got) {
+			t.Errorf("Error escapeKey(%q) got invalid path %q", test.key, got)
+		}
+		if key := unescapeKey(got); key != test.key {
+			t.Errorf("Error unescapeKey(%q) got %q; want %q", got, key, test.key)
+		}
+	}
+	if got, want := unescapeKey("a/%zz"), "a/%zz"; got != want {
+		t.Errorf("Error unescapeKey got %q; want %q", got, want)
+	}
+}
+
+func TestInvalidKeys_Skip(t *testing.T) {
+	fsys, api := newInvalidKeysFSTesting(SkipInvalidKeys)
+
+	want := []string{"100%.txt", "a", "d", "dir", "ok.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	want = []string{"ok.txt"}
+	if got := readDirNames(t, fsys, "dir"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	want = []string{".", "100%.txt", "a", "d", "dir", "dir/ok.txt", "ok.txt"}
+	if got := walkNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error WalkDir got %v; want %v", got, want)
+	}
+	want = []string{"dir/ok.txt"}
+	if got, err := fsys.Glob("*/*"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Error Glob got %v, %v; want %v", got, err, want)
+	}
+	want = []string{"100%.txt", "a", "d", "dir", "dir/ok.txt", "ok.txt"}
+	if got, err := fsys.Glob("**"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Error Glob got %v, %v; want %v", got, err, want)
+	}
+
+	if err := fsys.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"/c", "100%.txt", "a//b", "d/./e", "dir/../x", "h\xff", "ok.txt"}
+	if got := api.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error RemoveAll remains %q; want %q", got, want)
+	}
+}
+
+func TestInvalidKeys_Escape(t *testing.T) {
+	fsys, api := newInvalidKeysFSTesting(EscapeInvalidKeys)
+
+	want := []string{"%2F", "100%25.txt", "a", "d", "dir", "h%FF", "ok.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	want = []string{"%2F"}
+	if got := readDirNames(t, fsys, "a"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	want = []string{
+		".", "%2F", "%2F/c", "100%25.txt", "a", "a/%2F", "a/%2F/b",
+		"d", "d/%2E", "d/%2E/e", "dir", "dir/%2E%2E", "dir/%2E%2E/x",
+		"dir/ok.txt", "h%FF", "ok.txt",
+	}
+	names := walkNames(t, fsys, ".")
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Error WalkDir got %v; want %v", names, want)
+	}
+	for i, name := range names {
+		info, err := fsys.Stat(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.IsDir() {
+			continue
+		}
+		if got, want := info.Name(), name[strings.LastIndex(name, "/")+1:]; got != want {
+			t.Errorf("Error Stat(%q) Name got %q; want %q", name, got, want)
+		}
+		data, err := fsys.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := string(data), unescapeKey(names[i]); got != want {
+			t.Errorf("Error ReadFile(%q) got %q; want %q", name, got, want)
+		}
+	}
+
+	want = []string{"d/%2E/e", "dir/%2E%2E/x"}
+	if got, err := fsys.Glob("*/%2E*/*"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Error Glob got %v, %v; want %v", got, err, want)
+	}
+	want = []string{"a/%2F/b"}
+	if got, err := fsys.Glob("**/b"); err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("Error Glob got %v, %v; want %v", got, err, want)
+	}
+
+	sub, err := fsys.Sub("a/%2F")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"b"}
+	if got := readDirNames(t, sub, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+
+	if err := fsys.RemoveAll("a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveAll("%2F"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"100%.txt", "d/./e", "dir/../x", "dir/ok.txt", "h\xff", "ok.txt"}
+	if got := api.keys(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error RemoveAll remains %q; want %q", got, want)
+	}
+}
+
+func TestInvalidKeys_Error(t *testing.T) {
+	fsys, api := newInvalidKeysFSTesting(ErrorOnInvalidKeys)
+
+	isInvalidKeyError := func(err error, key string) bool {
+		var keyErr *InvalidKeyError
+		return errors.As(err, &keyErr) && keyErr.Key == key && errors.Is(err, fs.ErrInvalid)
+	}
+	if _, err := fsys.ReadDir("."); !isInvalidKeyError(err, "/") {
+		t.Errorf("Error ReadDir error got %v; want InvalidKeyError", err)
+	}
+	if _, err := fsys.ReadDir("dir"); !isInvalidKeyError(err, "dir/../") {
+		t.Errorf("Error ReadDir error got %v; want InvalidKeyError", err)
+	}
+	if _, err := fsys.Glob("*/*"); !isInvalidKeyError(err, "/") {
+		t.Errorf("Error Glob error got %v; want InvalidKeyError", err)
+	}
+
+	var names, keys []string
+	err := fsys.WalkDir(".", func(name string, d fs.DirEntry, err error) error {
+		var keyErr *InvalidKeyError
+		if errors.As(err, &keyErr) {
+			keys = append(keys, keyErr.Key)
+			names = append(names, name)
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{".", "a", "d", "dir", "."}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Error WalkDir error names got %v; want %v", names, want)
+	}
+	want = []string{"/c", "a//b", "d/./e", "dir/../x", "h\xff"}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Error WalkDir error keys got %q; want %q", keys, want)
+	}
+
+	if err := fsys.RemoveAll("dir"); !isInvalidKeyError(err, "dir/../x") {
+		t.Errorf("Error RemoveAll error got %v; want InvalidKeyError", err)
+	}
+	if got, want := len(api.keys()), len(testInvalidKeys); got != want {
+		t.Errorf("Error RemoveAll remains %d keys; want %d", got, want)
+	}
+}
@@ -0,0 +1,234 @@
+package s3fs
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	mathrand "math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// lockPollInterval is the maximum interval of checking the lease that is
+	// held by another owner on Lock.
+	lockPollInterval = 100 * time.Millisecond
+)
+
+var (
+	// ErrLocked is the error that is returned by TryLock if the lock is held
+	// by another lease that is not expired.
+	ErrLocked = errors.New("locked")
+	// ErrLeaseLost is the error that is returned by Renew and Unlock if the
+	// lease is expired and stolen by another owner, or already unlocked.
+	ErrLeaseLost = errors.New("lease lost")
+)
+
+// leaseBody is the content of the lease object.
+type leaseBody struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// expired reports whether the lease is expired at now.
+func (b *leaseBody) expired(now time.Time) bool {
+	return !now.Before(b.Expires)
+}
+
+// Lease is the lease of the lock that is acquired by Lock or TryLock. The
+// lease expires after the TTL unless it is renewed, then another owner can
+// steal the lock. The clocks of the owners are expected to be synchronized.
+type Lease struct {
+	fsys    *S3FS
+	name    string
+	key     string
+	ttl     time.Duration
+	owner   string
+	mutex   sync.Mutex
+	etag    string
+	expires time.Time
+}
+
+// Lock acquires the lock of the named lease object with the TTL. If the lock
+// is held by another lease then Lock waits until it is unlocked or expired,
+// or the context of the filesystem is done. The lease object is written by
+// the conditional PUT, so only one owner acquires the lock at a time.
+func (fsys *S3FS) Lock(name string, ttl time.Duration) (*Lease, error) {
+	for {
+		l, expires, err := fsys.tryLock(name, ttl)
+		if !errors.Is(err, ErrLocked) {
+			return l, err
+		}
+		d := min(time.Until(expires), lockPollInterval/2+mathrand.N(lockPollInterval/2))
+		t := time.NewTimer(max(d, 0))
+		select {
+		case <-t.C:
+		case <-fsys.context().Done():
+			t.Stop()
+			return nil, toPathError(fsys.context().Err(), "Lock", name)
+		}
+	}
+}
+
+// TryLock acquires the lock of the named lease object with the TTL. If the
+// lock is held by another lease that is not expired then TryLock returns
+// ErrLocked.
+func (fsys *S3FS) TryLock(name string, ttl time.Duration) (*Lease, error) {
+	l, _, err := fsys.tryLock(name, ttl)
+	return l, err
+}
+
+// tryLock acquires the lock. If the lock is held then tryLock returns the
+// expiration of the current lease with ErrLocked.
+func (fsys *S3FS) tryLock(name string, ttl time.Duration) (*Lease, time.Time, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, time.Time{}, toPathError(fs.ErrInvalid, "Lock", name)
+	}
+	l := &Lease{
+		fsys:  fsys,
+		name:  name,
+		key:   fsys.key(name),
+		ttl:   ttl,
+		owner: rand.Text(),
+	}
+	for {
+		err := l.write(ttl, &WriteOptions{IfNoneMatch: "*"})
+		if err == nil {
+			return l, time.Time{}, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, time.Time{}, toPathError(err, "Lock", name)
+		}
+		current, etag, err := l.read()
+		if isS3NoSuchKey(err) {
+			// NOTE: The lease object is deleted, so try to create it again.
+			continue
+		}
+		if err != nil {
+			return nil, time.Time{}, toPathError(err, "Lock", name)
+		}
+		if !current.expired(time.Now()) {
+			return nil, current.Expires, toPathError(ErrLocked, "Lock", name)
+		}
+		// NOTE: Steal the expired lease by CAS, so only one owner steals it.
+		err = l.write(ttl, &WriteOptions{IfMatch: etag})
+		if err == nil {
+			return l, time.Time{}, nil
+		}
+		if !errors.Is(err, ErrPreconditionFailed) && !isS3NoSuchKey(err) {
+			return nil, time.Time{}, toPathError(err, "Lock", name)
+		}
+	}
+}
+
+// read reads the current lease object and its ETag.
+func (l *Lease) read() (*leaseBody, string, error) {
+	output, err := l.fsys.client().GetObjectWithContext(l.fsys.context(), &s3.GetObjectInput{
+		Bucket: aws.String(l.fsys.bucket),
+		Key:    aws.String(l.key),
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	defer output.Body.Close()
+	p, err := io.ReadAll(output.Body)
+	if err != nil {
+		return nil, "", err
+	}
+	b := &leaseBody{}
+	if err := json.Unmarshal(p, b); err != nil {
+		return nil, "", err
+	}
+	return b, aws.StringValue(output.ETag), nil
+}
+
+// write writes the lease object that expires after d with the preconditions
+// of opts, and holds the ETag of the object. If the precondition fails but the
+// current object is the one that this lease wrote, such as the response of the
+// retried request is lost, then write succeeds.
+func (l *Lease) write(d time.Duration, opts *WriteOptions) error {
+	b := &leaseBody{Owner: l.owner, Expires: time.Now().Add(d).UTC()}
+	p, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+	merged := l.fsys.DefaultWriteOptions.merge(&WriteOptions{ContentType: "application/json"})
+	merged.IfNoneMatch, merged.IfMatch = opts.IfNoneMatch, opts.IfMatch
+	input := &s3.PutObjectInput{
+		Bucket: aws.String(l.fsys.bucket),
+		Key:    aws.String(l.key),
+		Body:   bytes.NewReader(p),
+	}
+	merged.applyPutObject(input)
+	output, err := l.fsys.client().PutObjectWithContext(l.fsys.context(), input, merged.requestOptions()...)
+	l.fsys.invalidate(l.key)
+	if err != nil {
+		err = merged.conditionError(err)
+		if !errors.Is(err, fs.ErrExist) && !errors.Is(err, ErrPreconditionFailed) {
+			return err
+		}
+		current, etag, readErr := l.read()
+		if readErr != nil || current.Owner != l.owner || !current.Expires.Equal(b.Expires) {
+			return err
+		}
+		output = &s3.PutObjectOutput{ETag: aws.String(etag)}
+	}
+	l.etag = aws.StringValue(output.ETag)
+	l.expires = b.Expires
+	return nil
+}
+
+// Name returns the name of the lease object.
+func (l *Lease) Name() string {
+	return l.name
+}
+
+// Expires returns the time when the lease expires unless it is renewed.
+func (l *Lease) Expires() time.Time {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.expires
+}
+
+// Renew extends the lease by the TTL. The lease object is replaced by CAS on
+// the ETag, so Renew returns ErrLeaseLost if the lease is stolen after it
+// expired.
+func (l *Lease) Renew() error {
+	return l.replace("Renew", l.ttl)
+}
+
+// Unlock releases the lock. The lease object is replaced by the expired lease
+// by CAS on the ETag instead of deleting it, because DeleteObject can not be
+// conditional, then another owner can acquire the lock immediately. Unlock
+// returns ErrLeaseLost if the lease is stolen after it expired.
+func (l *Lease) Unlock() error {
+	err := l.replace("Unlock", 0)
+	l.mutex.Lock()
+	l.etag = ""
+	l.mutex.Unlock()
+	return err
+}
+
+// replace replaces the lease object by CAS with the lease that expires after
+// d.
+func (l *Lease) replace(op string, d time.Duration) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.etag == "" {
+		return toPathError(ErrLeaseLost, op, l.name)
+	}
+	if err := l.write(d, &WriteOptions{IfMatch: l.etag}); err != nil {
+		if errors.Is(err, ErrPreconditionFailed) || isS3NoSuchKey(err) {
+			l.etag = ""
+			err = ErrLeaseLost
+		}
+		return toPathError(err, op, l.name)
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTryLock(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	l, err := fsys.TryLock("locks/job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Name() != "locks/job" {
+		t.Errorf("Error Name got %s; want %s", l.Name(), "locks/job")
+	}
+	if _, err := fsys.TryLock("locks/job", time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("Error TryLock error got %v; want %v", err, ErrLocked)
+	}
+
+	expires := l.Expires()
+	time.Sleep(10 * time.Millisecond)
+	if err := l.Renew(); err != nil {
+		t.Fatal(err)
+	}
+	if !l.Expires().After(expires) {
+		t.Errorf("Error Expires got %v; want after %v", l.Expires(), expires)
+	}
+
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Unlock(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Error Unlock error got %v; want %v", err, ErrLeaseLost)
+	}
+	if err := l.Renew(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Error Renew error got %v; want %v", err, ErrLeaseLost)
+	}
+	l2, err := fsys.TryLock("locks/job", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{".", "/invalid", "a/../b"} {
+		if _, err := fsys.TryLock(name, time.Minute); !errors.Is(err, fs.ErrInvalid) {
+			t.Errorf("Error TryLock(%s) error got %v; want %v", name, err, fs.ErrInvalid)
+		}
+	}
+}
+
+func TestTryLock_Steal(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	stale, err := fsys.TryLock("job.lock", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	var acquired int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := fsys.TryLock("job.lock", time.Minute)
+			if err == nil {
+				atomic.AddInt32(&acquired, 1)
+			} else if !errors.Is(err, ErrLocked) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if acquired != 1 {
+		t.Errorf("Error acquired %d; want %d", acquired, 1)
+	}
+	if err := stale.Renew(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Error Renew error got %v; want %v", err, ErrLeaseLost)
+	}
+	if err := stale.Unlock(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Error Unlock error got %v; want %v", err, ErrLeaseLost)
+	}
+}
+
+func TestLock_MutualExclusion(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	var wg sync.WaitGroup
+	var holders, count int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l, err := fsys.Lock("job.lock", time.Minute)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if n := atomic.AddInt32(&holders, 1); n != 1 {
+				t.Errorf("Error concurrent holders %d; want %d", n, 1)
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&count, 1)
+			atomic.AddInt32(&holders, -1)
+			if err := l.Unlock(); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count != 10 {
+		t.Errorf("Error count %d; want %d", count, 10)
+	}
+}
+
+func TestLock_Renew(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	l, err := fsys.Lock("job.lock", 50*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: The renewed lease is not stolen after the first TTL.
+	for i := 0; i < 4; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if err := l.Renew(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.TryLock("job.lock", time.Minute); !errors.Is(err, ErrLocked) {
+			t.Errorf("Error TryLock error got %v; want %v", err, ErrLocked)
+		}
+	}
+
+	// NOTE: Lock waits until the lease expires.
+	start := time.Now()
+	l2, err := fsys.Lock("job.lock", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 20*time.Millisecond {
+		t.Errorf("Error Lock elapsed %v; want waiting for the expiration", elapsed)
+	}
+	if err := l.Renew(); !errors.Is(err, ErrLeaseLost) {
+		t.Errorf("Error Renew error got %v; want %v", err, ErrLeaseLost)
+	}
+	if err := l2.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLock_Context(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	if _, err := fsys.Lock("job.lock", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := fsys.WithContext(ctx).Lock("job.lock", time.Minute); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Error Lock error got %v; want %v", err, context.DeadlineExceeded)
+	}
+}
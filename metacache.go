@@ -0,0 +1,218 @@
+package s3fs
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// MetadataCache is an in-memory cache of the directory listings and the
+// results of Stat. The cached results expire after the TTL, and the least
+// recently used results are evicted when the number of the results exceeds
+// the maximum. The results of the affected keys and directories are
+// invalidated when the filesystem writes or removes the files, but the
+// changes by the other writers are not visible until the results expire.
+// MetadataCache is safe for concurrent use and can be shared by the
+// filesystems.
+type MetadataCache struct {
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.Mutex
+	entries    map[string]*list.Element
+	lru        *list.List
+	gen        uint64
+	now        func() time.Time
+}
+
+// metaEntry represents a cached result. The path is "bucket/key" of the
+// object or "bucket/prefix" of the directory.
+type metaEntry struct {
+	id      string
+	path    string
+	dir     bool
+	value   any
+	expires time.Time
+}
+
+// NewMetadataCache returns a MetadataCache that caches the results for ttl.
+// If maxEntries is greater than 0 then the number of the cached results is
+// limited to maxEntries.
+func NewMetadataCache(ttl time.Duration, maxEntries int) *MetadataCache {
+	return &MetadataCache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[string]*list.Element{},
+		lru:        list.New(),
+		now:        time.Now,
+	}
+}
+
+// Len returns the number of the cached results.
+func (c *MetadataCache) Len() int {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.lru.Len()
+}
+
+// Clear removes all cached results.
+func (c *MetadataCache) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.entries = map[string]*list.Element{}
+	c.lru.Init()
+	c.gen++
+}
+
+// get returns the cached result of the id and the generation of the cache.
+// The generation is passed to put so that the result that is fetched before
+// the invalidation is not cached.
+func (c *MetadataCache) get(id string) (any, bool, uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	el, ok := c.entries[id]
+	if !ok {
+		return nil, false, c.gen
+	}
+	e := el.Value.(*metaEntry)
+	if !c.now().Before(e.expires) {
+		c.removeElement(el)
+		return nil, false, c.gen
+	}
+	c.lru.MoveToFront(el)
+	return e.value, true, c.gen
+}
+
+// put caches the result if the cache is not invalidated since gen.
+func (c *MetadataCache) put(id, path string, dir bool, value any, gen uint64) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if gen != c.gen {
+		return
+	}
+	if el, ok := c.entries[id]; ok {
+		c.removeElement(el)
+	}
+	c.entries[id] = c.lru.PushFront(&metaEntry{
+		id:      id,
+		path:    path,
+		dir:     dir,
+		value:   value,
+		expires: c.now().Add(c.ttl),
+	})
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		c.removeElement(c.lru.Back())
+	}
+}
+
+// removeElement removes the entry. The caller must hold the mutex.
+func (c *MetadataCache) removeElement(el *list.Element) {
+	c.lru.Remove(el)
+	delete(c.entries, el.Value.(*metaEntry).id)
+}
+
+// invalidate removes the result of the path and the listings of its parent
+// directories. If all is true then the results under the path are also
+// removed.
+func (c *MetadataCache) invalidate(path string, all bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.gen++
+	for el := c.lru.Front(); el != nil; {
+		next := el.Next()
+		e := el.Value.(*metaEntry)
+		if e.path == path ||
+			(e.dir && strings.HasPrefix(path, e.path)) ||
+			(all && strings.HasPrefix(e.path, path)) {
+			c.removeElement(el)
+		}
+		el = next
+	}
+}
+
+// invalidate invalidates the cached metadata and body of the key that is
+// written or removed.
+func (fsys *S3FS) invalidate(key string) {
+	if fsys.MetadataCache != nil {
+		fsys.MetadataCache.invalidate(fsys.bucket+"/"+key, false)
+	}
+	if fsys.DiskCache != nil {
+		fsys.DiskCache.invalidate(path.Join(fsys.bucket, key), false)
+	}
+}
+
+// invalidateAll invalidates the cached metadata and bodies of the all keys
+// under the prefix.
+func (fsys *S3FS) invalidateAll(prefix string) {
+	if fsys.MetadataCache != nil {
+		fsys.MetadataCache.invalidate(fsys.bucket+"/"+prefix, true)
+	}
+	if fsys.DiskCache != nil {
+		fsys.DiskCache.invalidate(fsys.bucket+"/"+prefix, true)
+	}
+}
+
+// listDir lists the objects of the directory through the metadata cache.
+func (fsys *S3FS) listDir(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	c := fsys.MetadataCache
+	if c == nil {
+		return fsys.listObjectsV2(input)
+	}
+	path := fsys.bucket + "/" + aws.StringValue(input.Prefix)
+	id := fmt.Sprintf("list\x00%s\x00%s\x00%d", path,
+		aws.StringValue(input.ContinuationToken), aws.Int64Value(input.MaxKeys))
+	v, ok, gen := c.get(id)
+	if ok {
+		return v.(*s3.ListObjectsV2Output), nil
+	}
+	output, err := fsys.listObjectsV2(input)
+	if err != nil {
+		return nil, err
+	}
+	c.put(id, path, true, output, gen)
+	return output, nil
+}
+
+// headContent returns the content of the object through the metadata cache.
+// The object that does not exist is also cached.
+func (fsys *S3FS) headContent(key string) (*content, error) {
+	c := fsys.MetadataCache
+	path := fsys.bucket + "/" + key
+	id := "stat\x00" + path
+	var gen uint64
+	if c != nil {
+		var v any
+		var ok bool
+		if v, ok, gen = c.get(id); ok {
+			info := v.(*content)
+			if info == nil {
+				return nil, fs.ErrNotExist
+			}
+			cp := *info
+			return &cp, nil
+		}
+	}
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String(fsys.bucket),
+		Key:    aws.String(key),
+	}
+	output, err := fsys.client().HeadObjectWithContext(fsys.context(), input)
+	if err != nil {
+		if c != nil && isS3NoSuchKey(err) {
+			c.put(id, path, false, (*content)(nil), gen)
+		}
+		return nil, err
+	}
+	info := newHeadContent(fsys.bucket, key, output)
+	if c != nil {
+		cp := *info
+		c.put(id, path, false, &cp, gen)
+	}
+	return info, nil
+}
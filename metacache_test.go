@@ -0,0 +1,177 @@
+package s3fs
+
+import (
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func newMetadataCacheFSTesting(t *testing.T, ttl time.Duration, maxEntries int) (*S3FS, *countAPI) {
+	api := newCountAPI(newMemFSTesting(t))
+	fsys := NewWithAPI("testdata", api)
+	fsys.MetadataCache = NewMetadataCache(ttl, maxEntries)
+	return fsys, api
+}
+
+func readDirNames(t *testing.T, fsys fs.FS, dir string) []string {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	return names
+}
+
+func TestMetadataCache(t *testing.T) {
+	fsys, api := newMetadataCacheFSTesting(t, time.Minute, 0)
+
+	for i := 0; i < 3; i++ {
+		readDirNames(t, fsys, "dir0")
+		if _, err := fsys.Stat("dir0"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.Stat("file0.txt"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.Stat("not-found"); !isNotExist(err) {
+			t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+		}
+	}
+	// NOTE: ReadDir, Stat(dir0) and Stat(not-found) list once each.
+	if n := api.count("ListObjectsV2"); n != 3 {
+		t.Errorf("Error ListObjectsV2 requests %d; want %d", n, 3)
+	}
+	// NOTE: Stat(dir0), Stat(file0.txt) and Stat(not-found) head once each.
+	if n := api.count("HeadObject"); n != 3 {
+		t.Errorf("Error HeadObject requests %d; want %d", n, 3)
+	}
+}
+
+func TestMetadataCache_Invalidate(t *testing.T) {
+	fsys, api := newMetadataCacheFSTesting(t, time.Minute, 0)
+	want := []string{"dir0", "file0.txt", "file1.txt", "file2.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	if _, err := fsys.Stat("new.txt"); !isNotExist(err) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+
+	if _, err := fsys.WriteFile("new.txt", []byte("new"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.WriteFile("dir1/sub/file.txt", []byte("new"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"dir0", "dir1", "file0.txt", "file1.txt", "file2.txt", "new.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	if info, err := fsys.Stat("new.txt"); err != nil || info.Size() != 3 {
+		t.Errorf("Error Stat got %v, %v; want size %d", info, err, 3)
+	}
+
+	if err := fsys.RemoveFile("new.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("new.txt"); !isNotExist(err) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+
+	readDirNames(t, fsys, "dir1/sub")
+	if err := fsys.RemoveAll("dir1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("dir1/sub"); !isNotExist(err) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+	want = []string{"dir0", "file0.txt", "file1.txt", "file2.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+
+	if err := fsys.Rename("dir0", "dir2"); err != nil {
+		t.Fatal(err)
+	}
+	want = []string{"dir2", "file0.txt", "file1.txt", "file2.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+
+	// NOTE: The changes by the other writers are not visible until expired.
+	if _, err := NewWithAPI("testdata", api.API).WriteFile("other.txt", []byte("other"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	fsys.MetadataCache.Clear()
+	want = []string{"dir2", "file0.txt", "file1.txt", "file2.txt", "other.txt"}
+	if got := readDirNames(t, fsys, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+}
+
+func TestMetadataCache_Sub(t *testing.T) {
+	fsys, _ := newMetadataCacheFSTesting(t, time.Minute, 0)
+	sub, err := fsys.Sub("dir0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"file01.txt", "file02.txt", "file03.txt"}
+	if got := readDirNames(t, sub, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+	if _, err := fsys.WriteFile("dir0/file04.txt", []byte("new"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	want = append(want, "file04.txt")
+	if got := readDirNames(t, sub, "."); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %v; want %v", got, want)
+	}
+}
+
+func TestMetadataCache_TTL(t *testing.T) {
+	fsys, api := newMetadataCacheFSTesting(t, time.Minute, 0)
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	fsys.MetadataCache.now = func() time.Time { return now }
+
+	readDirNames(t, fsys, ".")
+	now = now.Add(59 * time.Second)
+	readDirNames(t, fsys, ".")
+	if n := api.count("ListObjectsV2"); n != 1 {
+		t.Errorf("Error ListObjectsV2 requests %d; want %d", n, 1)
+	}
+	now = now.Add(time.Second)
+	readDirNames(t, fsys, ".")
+	if n := api.count("ListObjectsV2"); n != 2 {
+		t.Errorf("Error ListObjectsV2 requests %d; want %d", n, 2)
+	}
+}
+
+func TestMetadataCache_MaxEntries(t *testing.T) {
+	fsys, api := newMetadataCacheFSTesting(t, time.Minute, 2)
+	for _, name := range []string{"file0.txt", "file1.txt", "file2.txt"} {
+		if _, err := fsys.Stat(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fsys.MetadataCache.Len(); got != 2 {
+		t.Errorf("Error Len got %d; want %d", got, 2)
+	}
+
+	// NOTE: file0.txt is evicted.
+	api.reset()
+	for _, name := range []string{"file2.txt", "file1.txt", "file0.txt"} {
+		if _, err := fsys.Stat(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := api.count("HeadObject"); n != 1 {
+		t.Errorf("Error HeadObject requests %d; want %d", n, 1)
+	}
+}
@@ -0,0 +1,82 @@
+package s3fs
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectInfo represents the metadata of an S3 object. FileInfo.Sys() of files
+// returns *ObjectInfo. The fields that S3 does not return on the request that
+// gets the FileInfo are empty. ListObjectsV2 returns only ETag and StorageClass,
+// GetObject and HeadObject return all fields.
+type ObjectInfo struct {
+	Bucket               string
+	Key                  string
+	ETag                 string
+	VersionID            string
+	StorageClass         string
+	ContentType          string
+	ContentEncoding      string
+	ContentDisposition   string
+	ContentLanguage      string
+	CacheControl         string
+	Metadata             map[string]string
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+	TagCount             int64
+}
+
+// storageClass returns the storage class. S3 omits the storage class of
+// STANDARD on GetObject and HeadObject.
+func storageClass(class *string) string {
+	if c := aws.StringValue(class); c != "" {
+		return c
+	}
+	return s3.StorageClassStandard
+}
+
+func newObjectInfo(bucket string, o *s3.Object) *ObjectInfo {
+	return &ObjectInfo{
+		Bucket:       bucket,
+		Key:          aws.StringValue(o.Key),
+		ETag:         aws.StringValue(o.ETag),
+		StorageClass: storageClass(o.StorageClass),
+	}
+}
+
+func newHeadObjectInfo(bucket, key string, o *s3.HeadObjectOutput) *ObjectInfo {
+	return &ObjectInfo{
+		Bucket:               bucket,
+		Key:                  key,
+		ETag:                 aws.StringValue(o.ETag),
+		VersionID:            aws.StringValue(o.VersionId),
+		StorageClass:         storageClass(o.StorageClass),
+		ContentType:          aws.StringValue(o.ContentType),
+		ContentEncoding:      aws.StringValue(o.ContentEncoding),
+		ContentDisposition:   aws.StringValue(o.ContentDisposition),
+		ContentLanguage:      aws.StringValue(o.ContentLanguage),
+		CacheControl:         aws.StringValue(o.CacheControl),
+		Metadata:             aws.StringValueMap(o.Metadata),
+		ServerSideEncryption: aws.StringValue(o.ServerSideEncryption),
+		SSEKMSKeyID:          aws.StringValue(o.SSEKMSKeyId),
+	}
+}
+
+func newGetObjectInfo(bucket, key string, o *s3.GetObjectOutput) *ObjectInfo {
+	return &ObjectInfo{
+		Bucket:               bucket,
+		Key:                  key,
+		ETag:                 aws.StringValue(o.ETag),
+		VersionID:            aws.StringValue(o.VersionId),
+		StorageClass:         storageClass(o.StorageClass),
+		ContentType:          aws.StringValue(o.ContentType),
+		ContentEncoding:      aws.StringValue(o.ContentEncoding),
+		ContentDisposition:   aws.StringValue(o.ContentDisposition),
+		ContentLanguage:      aws.StringValue(o.ContentLanguage),
+		CacheControl:         aws.StringValue(o.CacheControl),
+		Metadata:             aws.StringValueMap(o.Metadata),
+		ServerSideEncryption: aws.StringValue(o.ServerSideEncryption),
+		SSEKMSKeyID:          aws.StringValue(o.SSEKMSKeyId),
+		TagCount:             aws.Int64Value(o.TagCount),
+	}
+}
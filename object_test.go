@@ -0,0 +1,80 @@
+package s3fs
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/fs"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestStorageClass(t *testing.T) {
+	if got := storageClass(nil); got != s3.StorageClassStandard {
+		t.Errorf("Error storageClass(nil) got %s; want %s", got, s3.StorageClassStandard)
+	}
+	if got := storageClass(aws.String(s3.StorageClassGlacier)); got != s3.StorageClassGlacier {
+		t.Errorf("Error storageClass got %s; want %s", got, s3.StorageClassGlacier)
+	}
+}
+
+func TestObjectInfo(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	data, err := fsys.ReadFile("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ObjectInfo{
+		Bucket:       "testdata",
+		Key:          "dir0/file01.txt",
+		ETag:         fmt.Sprintf(`"%x"`, md5.Sum(data)),
+		StorageClass: s3.StorageClassStandard,
+	}
+
+	var infos []fs.FileInfo
+	info, err := fsys.Stat("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos = append(infos, info)
+
+	f, err := fsys.Open("dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	info, err = f.Stat()
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos = append(infos, info)
+
+	entries, err := fsys.ReadDir("dir0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err = entries[0].Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos = append(infos, info)
+
+	for i, info := range infos {
+		got, ok := info.Sys().(*ObjectInfo)
+		if !ok {
+			t.Fatalf("Error Sys[%d] got %T; want *ObjectInfo", i, info.Sys())
+		}
+		if got.Bucket != want.Bucket || got.Key != want.Key || got.ETag != want.ETag || got.StorageClass != want.StorageClass {
+			t.Errorf("Error Sys[%d] got %+v; want %+v", i, got, want)
+		}
+	}
+
+	dirInfo, err := fsys.Stat("dir0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sys := dirInfo.Sys(); sys != nil {
+		t.Errorf("Error Sys of directory got %v; want nil", sys)
+	}
+}
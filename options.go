@@ -0,0 +1,200 @@
+package s3fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/url"
+	"path"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ErrPreconditionFailed is the error that is returned if the object is
+// written with IfMatch of WriteOptions and the ETag of the object does not
+// match.
+var ErrPreconditionFailed = errors.New("precondition failed")
+
+// WriteOptions represents the options for writing objects.
+type WriteOptions struct {
+	// ContentType is the Content-Type of the object. If ContentType is empty
+	// then it is detected from the file extension.
+	ContentType     string
+	ContentEncoding string
+	CacheControl    string
+	// Metadata is the user-defined metadata of the object.
+	Metadata map[string]string
+	// Tagging is the tag-set of the object.
+	Tagging map[string]string
+	// StorageClass is the storage class of the object such as "STANDARD_IA".
+	StorageClass string
+	// ServerSideEncryption is the server-side encryption algorithm such as
+	// "AES256" and "aws:kms".
+	ServerSideEncryption string
+	// SSEKMSKeyID is the ID of the KMS key that is used on "aws:kms".
+	SSEKMSKeyID string
+	// ACL is the canned ACL of the object such as "private".
+	ACL string
+	// IfNoneMatch writes the object only if the object does not exist when it
+	// is "*", so the exclusive creation is not racy. S3 supports only "*". If
+	// the object exists then the write returns fs.ErrExist.
+	IfNoneMatch string
+	// IfMatch writes the object only if the ETag of the object matches, like
+	// compare-and-swap. If the ETag does not match then the write returns
+	// ErrPreconditionFailed, and if the object does not exist then the write
+	// returns fs.ErrNotExist.
+	IfMatch string
+}
+
+func mergeStrings(base, override string) string {
+	if override != "" {
+		return override
+	}
+	return base
+}
+
+func mergeMap(base, override map[string]string) map[string]string {
+	if len(base) == 0 {
+		return override
+	}
+	if len(override) == 0 {
+		return base
+	}
+	merged := map[string]string{}
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		merged[k] = v
+	}
+	return merged
+}
+
+// merge returns the options that the non-empty fields of override are
+// applied to opts.
+func (opts *WriteOptions) merge(override *WriteOptions) *WriteOptions {
+	if opts == nil {
+		opts = &WriteOptions{}
+	}
+	if override == nil {
+		override = &WriteOptions{}
+	}
+	return &WriteOptions{
+		ContentType:          mergeStrings(opts.ContentType, override.ContentType),
+		ContentEncoding:      mergeStrings(opts.ContentEncoding, override.ContentEncoding),
+		CacheControl:         mergeStrings(opts.CacheControl, override.CacheControl),
+		Metadata:             mergeMap(opts.Metadata, override.Metadata),
+		Tagging:              mergeMap(opts.Tagging, override.Tagging),
+		StorageClass:         mergeStrings(opts.StorageClass, override.StorageClass),
+		ServerSideEncryption: mergeStrings(opts.ServerSideEncryption, override.ServerSideEncryption),
+		SSEKMSKeyID:          mergeStrings(opts.SSEKMSKeyID, override.SSEKMSKeyID),
+		ACL:                  mergeStrings(opts.ACL, override.ACL),
+		IfNoneMatch:          mergeStrings(opts.IfNoneMatch, override.IfNoneMatch),
+		IfMatch:              mergeStrings(opts.IfMatch, override.IfMatch),
+	}
+}
+
+// contentType returns ContentType or the type that is detected from the
+// extension of the key.
+func (opts *WriteOptions) contentType(key string) *string {
+	if opts.ContentType != "" {
+		return aws.String(opts.ContentType)
+	}
+	if typ := mime.TypeByExtension(path.Ext(key)); typ != "" {
+		return aws.String(typ)
+	}
+	return nil
+}
+
+func (opts *WriteOptions) tagging() *string {
+	if len(opts.Tagging) == 0 {
+		return nil
+	}
+	values := url.Values{}
+	for k, v := range opts.Tagging {
+		values.Set(k, v)
+	}
+	return aws.String(values.Encode())
+}
+
+func (opts *WriteOptions) metadata() map[string]*string {
+	if len(opts.Metadata) == 0 {
+		return nil
+	}
+	return aws.StringMap(opts.Metadata)
+}
+
+// objectWriteOptions returns the options to write an object that has the same
+// metadata as the specified object.
+func objectWriteOptions(o *ObjectInfo) *WriteOptions {
+	return &WriteOptions{
+		ContentType:          o.ContentType,
+		ContentEncoding:      o.ContentEncoding,
+		CacheControl:         o.CacheControl,
+		Metadata:             o.Metadata,
+		StorageClass:         o.StorageClass,
+		ServerSideEncryption: o.ServerSideEncryption,
+		SSEKMSKeyID:          o.SSEKMSKeyID,
+	}
+}
+
+func (opts *WriteOptions) applyPutObject(input *s3.PutObjectInput) {
+	input.ContentType = opts.contentType(aws.StringValue(input.Key))
+	input.ContentEncoding = stringPtr(opts.ContentEncoding)
+	input.CacheControl = stringPtr(opts.CacheControl)
+	input.Metadata = opts.metadata()
+	input.Tagging = opts.tagging()
+	input.StorageClass = stringPtr(opts.StorageClass)
+	input.ServerSideEncryption = stringPtr(opts.ServerSideEncryption)
+	input.SSEKMSKeyId = stringPtr(opts.SSEKMSKeyID)
+	input.ACL = stringPtr(opts.ACL)
+}
+
+func (opts *WriteOptions) applyCreateMultipartUpload(input *s3.CreateMultipartUploadInput) {
+	input.ContentType = opts.contentType(aws.StringValue(input.Key))
+	input.ContentEncoding = stringPtr(opts.ContentEncoding)
+	input.CacheControl = stringPtr(opts.CacheControl)
+	input.Metadata = opts.metadata()
+	input.Tagging = opts.tagging()
+	input.StorageClass = stringPtr(opts.StorageClass)
+	input.ServerSideEncryption = stringPtr(opts.ServerSideEncryption)
+	input.SSEKMSKeyId = stringPtr(opts.SSEKMSKeyID)
+	input.ACL = stringPtr(opts.ACL)
+}
+
+// requestOptions returns the request options that set the If-Match and
+// If-None-Match headers, because PutObjectInput and
+// CompleteMultipartUploadInput of aws-sdk-go do not have the fields.
+func (opts *WriteOptions) requestOptions() []request.Option {
+	header := map[string]string{}
+	if opts.IfNoneMatch != "" {
+		header["If-None-Match"] = opts.IfNoneMatch
+	}
+	if opts.IfMatch != "" {
+		header["If-Match"] = opts.IfMatch
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return []request.Option{request.WithSetRequestHeaders(header)}
+}
+
+// conditional reports whether the write has the preconditions.
+func (opts *WriteOptions) conditional() bool {
+	return opts.IfNoneMatch != "" || opts.IfMatch != ""
+}
+
+// conditionError converts the error of the conditional write to fs.ErrExist
+// or ErrPreconditionFailed. The original error is also wrapped.
+func (opts *WriteOptions) conditionError(err error) error {
+	if !isPreconditionFailed(err) && !isConditionalRequestConflict(err) {
+		return err
+	}
+	if opts.IfNoneMatch != "" {
+		return fmt.Errorf("%w: %w", fs.ErrExist, err)
+	}
+	return fmt.Errorf("%w: %w", ErrPreconditionFailed, err)
+}
@@ -0,0 +1,332 @@
+package s3fs
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestWriteOptions_Merge(t *testing.T) {
+	base := &WriteOptions{
+		ContentType:  "text/plain",
+		CacheControl: "max-age=60",
+		Metadata:     map[string]string{"a": "1", "b": "2"},
+	}
+	override := &WriteOptions{
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"b": "3"},
+		StorageClass: s3.StorageClassStandardIa,
+	}
+	want := &WriteOptions{
+		ContentType:  "text/plain",
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"a": "1", "b": "3"},
+		StorageClass: s3.StorageClassStandardIa,
+	}
+	if got := base.merge(override); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error merge got %+v; want %+v", got, want)
+	}
+
+	var nilOpts *WriteOptions
+	if got := nilOpts.merge(nil); !reflect.DeepEqual(got, &WriteOptions{}) {
+		t.Errorf("Error merge nil got %+v; want empty", got)
+	}
+	if base.Metadata["b"] != "2" {
+		t.Errorf("Error merge modified the base metadata")
+	}
+}
+
+func TestWriteOptions_ApplyPutObject(t *testing.T) {
+	testCases := []struct {
+		opts *WriteOptions
+		key  string
+		want *s3.PutObjectInput
+	}{
+		{
+			opts: &WriteOptions{},
+			key:  "test.json",
+			want: &s3.PutObjectInput{
+				Key:         aws.String("test.json"),
+				ContentType: aws.String("application/json"),
+			},
+		}, {
+			opts: &WriteOptions{},
+			key:  "test",
+			want: &s3.PutObjectInput{
+				Key: aws.String("test"),
+			},
+		}, {
+			opts: &WriteOptions{
+				ContentType:          "application/octet-stream",
+				ContentEncoding:      "gzip",
+				CacheControl:         "no-cache",
+				Metadata:             map[string]string{"k": "v"},
+				Tagging:              map[string]string{"a": "1", "b": "x y"},
+				StorageClass:         s3.StorageClassStandardIa,
+				ServerSideEncryption: s3.ServerSideEncryptionAwsKms,
+				SSEKMSKeyID:          "key-id",
+				ACL:                  s3.ObjectCannedACLPrivate,
+			},
+			key: "test.json",
+			want: &s3.PutObjectInput{
+				Key:                  aws.String("test.json"),
+				ContentType:          aws.String("application/octet-stream"),
+				ContentEncoding:      aws.String("gzip"),
+				CacheControl:         aws.String("no-cache"),
+				Metadata:             map[string]*string{"k": aws.String("v")},
+				Tagging:              aws.String("a=1&b=x+y"),
+				StorageClass:         aws.String(s3.StorageClassStandardIa),
+				ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+				SSEKMSKeyId:          aws.String("key-id"),
+				ACL:                  aws.String(s3.ObjectCannedACLPrivate),
+			},
+		},
+	}
+	for i, tc := range testCases {
+		got := &s3.PutObjectInput{Key: aws.String(tc.key)}
+		tc.opts.applyPutObject(got)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("Error [%d] applyPutObject got %v; want %v", i, got, tc.want)
+		}
+	}
+}
+
+func TestWriteFileWithOptions(t *testing.T) {
+	opts := &WriteOptions{
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"k": "v"},
+		Tagging:      map[string]string{"a": "1"},
+		StorageClass: s3.StorageClassStandardIa,
+	}
+	want := ObjectInfo{
+		ContentType:  "text/plain; charset=utf-8",
+		CacheControl: "no-cache",
+		Metadata:     map[string]string{"k": "v"},
+		StorageClass: s3.StorageClassStandardIa,
+		TagCount:     1,
+	}
+
+	testCases := []struct {
+		name     string
+		partSize int64
+	}{
+		{name: "single.txt"},
+		{name: "multipart.txt", partSize: 4},
+	}
+	for _, tc := range testCases {
+		fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+		fsys.PartSize = tc.partSize
+		fsys.minPartSize = 1
+		fsys.DefaultWriteOptions = &WriteOptions{
+			CacheControl: "max-age=60",
+			StorageClass: s3.StorageClassGlacier,
+		}
+		data := []byte(strings.Repeat("0123456789", 3))
+		if _, err := fsys.WriteFileWithOptions(tc.name, data, fs.ModePerm, opts); err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fsys.Open(tc.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		info, err := f.Stat()
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := info.Sys().(*ObjectInfo)
+		if got.ContentType != want.ContentType ||
+			got.CacheControl != want.CacheControl ||
+			!reflect.DeepEqual(got.Metadata, want.Metadata) ||
+			got.StorageClass != want.StorageClass ||
+			got.TagCount != want.TagCount {
+			t.Errorf("Error %s Sys got %+v; want %+v", tc.name, got, want)
+		}
+
+		entries, err := fsys.ReadDir(".")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, entry := range entries {
+			if entry.Name() != tc.name {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := info.Sys().(*ObjectInfo).StorageClass; got != want.StorageClass {
+				t.Errorf("Error %s listed StorageClass got %s; want %s", tc.name, got, want.StorageClass)
+			}
+		}
+	}
+}
+
+func TestCopy_MultipartKeepsMetadata(t *testing.T) {
+	orig := maxCopyObjectSize
+	maxCopyObjectSize = 4
+	defer func() { maxCopyObjectSize = orig }()
+
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+	opts := &WriteOptions{
+		ContentType: "application/x-test",
+		Metadata:    map[string]string{"k": "v"},
+	}
+	if _, err := fsys.WriteFileWithOptions("src.txt", []byte("0123456789"), fs.ModePerm, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Copy("src.txt", "dst.txt"); err != nil {
+		t.Fatal(err)
+	}
+	info, err := fsys.Stat("dst.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := info.Sys().(*ObjectInfo)
+	if got.ContentType != opts.ContentType || !reflect.DeepEqual(got.Metadata, opts.Metadata) {
+		t.Errorf("Error Copy Sys got %+v; want %+v", got, opts)
+	}
+}
+
+func TestWriteFileWithOptions_Conditional(t *testing.T) {
+	newFSs := map[string]func(t *testing.T) *S3FS{
+		"s3fake": func(t *testing.T) *S3FS {
+			return NewWithAPI("testdata", newMockFSS3APITesting(t))
+		},
+		"v2": func(t *testing.T) *S3FS {
+			fsys, _ := newV2FSTesting(t)
+			return fsys
+		},
+		"server": func(t *testing.T) *S3FS {
+			fsys, _ := newServerFSTesting(t)
+			return fsys
+		},
+	}
+	data := []byte(strings.Repeat("0123456789", 3))
+	for backend, newFS := range newFSs {
+		for _, partSize := range []int64{0, 4} {
+			fsys := newFS(t)
+			fsys.PartSize = partSize
+			fsys.minPartSize = 1
+			exclusive := &WriteOptions{IfNoneMatch: "*"}
+
+			// NOTE: The writers are created before the object exists, so the
+			// precondition is checked on Close.
+			w1, err := fsys.CreateFileWithOptions("new.txt", fs.ModePerm, exclusive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w2, err := fsys.CreateFileWithOptions("new.txt", fs.ModePerm, exclusive)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range []io.Writer{w1, w2} {
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w1.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w2.Close(); !errors.Is(err, fs.ErrExist) {
+				t.Errorf("Error %s partSize %d Close error got %v; want %v", backend, partSize, err, fs.ErrExist)
+			}
+			if _, err := fsys.WriteFileWithOptions("new.txt", data, fs.ModePerm, exclusive); !errors.Is(err, fs.ErrExist) {
+				t.Errorf("Error %s partSize %d WriteFile error got %v; want %v", backend, partSize, err, fs.ErrExist)
+			}
+
+			info, err := w1.Stat()
+			if err != nil {
+				t.Fatal(err)
+			}
+			etag := info.Sys().(*ObjectInfo).ETag
+			if stat, err := fsys.Stat("new.txt"); err != nil {
+				t.Fatal(err)
+			} else if want := stat.Sys().(*ObjectInfo).ETag; etag != want {
+				t.Errorf("Error %s partSize %d ETag got %s; want %s", backend, partSize, etag, want)
+			}
+
+			cas := &WriteOptions{IfMatch: etag}
+			if _, err := fsys.WriteFileWithOptions("new.txt", []byte("swapped"), fs.ModePerm, cas); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := fsys.WriteFileWithOptions("new.txt", data, fs.ModePerm, cas); !errors.Is(err, ErrPreconditionFailed) {
+				t.Errorf("Error %s partSize %d WriteFile error got %v; want %v", backend, partSize, err, ErrPreconditionFailed)
+			}
+			if got, err := fsys.ReadFile("new.txt"); err != nil || string(got) != "swapped" {
+				t.Errorf("Error %s partSize %d ReadFile got %q, %v; want %q", backend, partSize, got, err, "swapped")
+			}
+			if _, err := fsys.WriteFileWithOptions("not-found.txt", data, fs.ModePerm, cas); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("Error %s partSize %d WriteFile error got %v; want %v", backend, partSize, err, fs.ErrNotExist)
+			}
+		}
+	}
+}
+
+func TestCreateFileWithOptions_ConditionalEmpty(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	exclusive := &WriteOptions{IfNoneMatch: "*"}
+	w1, err := fsys.CreateFileWithOptions("empty.txt", fs.ModePerm, exclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2, err := fsys.CreateFileWithOptions("empty.txt", fs.ModePerm, exclusive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w2.Close(); !errors.Is(err, fs.ErrExist) {
+		t.Errorf("Error Close error got %v; want %v", err, fs.ErrExist)
+	}
+	info, err := fsys.Stat("empty.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Size() != 0 {
+		t.Errorf("Error Stat size got %d; want %d", info.Size(), 0)
+	}
+
+	w3, err := fsys.CreateFileWithOptions("empty.txt", fs.ModePerm, &WriteOptions{IfMatch: `"mismatch"`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w3.Close(); !errors.Is(err, ErrPreconditionFailed) {
+		t.Errorf("Error Close error got %v; want %v", err, ErrPreconditionFailed)
+	}
+}
+
+func TestWriteFileWithOptions_ConcurrentCreate(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	var wg sync.WaitGroup
+	var created int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := fsys.WriteFileWithOptions("lock", []byte(fmt.Sprint(i)), fs.ModePerm, &WriteOptions{IfNoneMatch: "*"})
+			if err == nil {
+				atomic.AddInt32(&created, 1)
+			} else if !errors.Is(err, fs.ErrExist) {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("Error created %d; want %d", created, 1)
+	}
+}
@@ -0,0 +1,198 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// prefetcher reads the object by the ranged GETs in parallel and delivers
+// the parts in order. The parts are pinned to the ETag of the opened object
+// by IfMatch, so the object that is modified while reading is not mixed.
+type prefetcher struct {
+	fsys      *S3FS
+	key       string
+	versionID string
+	etag      string
+	size      int64
+	partSize  int64
+	next      int64
+	first     io.ReadCloser
+	remain    int64
+	queue     []*prefetchPart
+	cur       *prefetchPart
+	free      [][]byte
+	err       error
+	ctx       context.Context
+	cancel    context.CancelFunc
+}
+
+// prefetchPart represents a part that is fetched in the background.
+type prefetchPart struct {
+	done chan struct{}
+	buf  []byte
+	pos  int
+	err  error
+}
+
+// newPrefetcher returns a prefetcher that reads the file from the offset. If
+// first is not nil then the first part is read from first.
+func newPrefetcher(f *s3File, offset int64, first io.ReadCloser) *prefetcher {
+	ctx, cancel := context.WithCancel(f.fsys.context())
+	p := &prefetcher{
+		fsys:      f.fsys,
+		key:       f.fsys.key(f.key),
+		versionID: f.versionID,
+		etag:      f.object.ETag,
+		size:      f.size,
+		partSize:  f.fsys.prefetchPartSize(),
+		next:      offset,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+	if first != nil {
+		p.first = first
+		p.remain = min(p.partSize, p.size-offset)
+		p.next += p.remain
+	}
+	p.fill()
+	return p
+}
+
+// fill starts fetching the next parts up to the concurrency.
+func (p *prefetcher) fill() {
+	for len(p.queue) < p.fsys.PrefetchConcurrency && p.next < p.size {
+		end := min(p.next+p.partSize, p.size)
+		var buf []byte
+		if n := len(p.free); n > 0 {
+			buf, p.free = p.free[n-1], p.free[:n-1]
+		} else {
+			buf = make([]byte, p.partSize)
+		}
+		part := &prefetchPart{done: make(chan struct{})}
+		go p.fetch(part, buf[:end-p.next], p.next)
+		p.queue = append(p.queue, part)
+		p.next = end
+	}
+}
+
+// fetch gets the part and retries on the transient errors with the backoff
+// of RetryPolicy, or of the default RetryPolicy if it is not set.
+func (p *prefetcher) fetch(part *prefetchPart, buf []byte, start int64) {
+	defer close(part.done)
+	policy := p.fsys.RetryPolicy
+	if policy == nil {
+		policy = &RetryPolicy{}
+	}
+	for retries := 0; ; retries++ {
+		err := p.fetchRange(buf, start)
+		if err == nil {
+			part.buf = buf
+			return
+		}
+		if retries >= p.fsys.PrefetchRetries || !isRetryablePartError(err) || p.ctx.Err() != nil {
+			part.err = err
+			return
+		}
+		if err := policy.wait(p.ctx, retries+1); err != nil {
+			part.err = err
+			return
+		}
+	}
+}
+
+// fetchRange reads len(buf) bytes from the offset by a ranged GET.
+func (p *prefetcher) fetchRange(buf []byte, start int64) error {
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(p.fsys.bucket),
+		Key:       aws.String(p.key),
+		Range:     aws.String(fmt.Sprintf("bytes=%d-%d", start, start+int64(len(buf))-1)),
+		IfMatch:   stringPtr(p.etag),
+		VersionId: stringPtr(p.versionID),
+	}
+	output, err := p.fsys.client().GetObjectWithContext(p.ctx, input)
+	if err != nil {
+		return err
+	}
+	defer output.Body.Close()
+
+	_, err = io.ReadFull(output.Body, buf)
+	return err
+}
+
+// isRetryablePartError reports whether the part can be fetched again.
+func isRetryablePartError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	return !isPreconditionFailed(err) && !isS3NoSuchKey(err)
+}
+
+// Read reads the parts in order. Once an error occurs, Read returns the
+// error.
+func (p *prefetcher) Read(b []byte) (int, error) {
+	if p.err != nil {
+		return 0, p.err
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	n, err := p.read(b)
+	if err != nil && err != io.EOF {
+		p.err = err
+	}
+	return n, err
+}
+
+func (p *prefetcher) read(b []byte) (int, error) {
+	for {
+		if p.first != nil {
+			if p.remain > 0 {
+				n, err := p.first.Read(b[:min(int64(len(b)), p.remain)])
+				p.remain -= int64(n)
+				if err == io.EOF {
+					if p.remain > 0 {
+						return n, io.ErrUnexpectedEOF
+					}
+					err = nil
+				}
+				return n, err
+			}
+			p.first.Close()
+			p.first = nil
+		}
+		if p.cur != nil {
+			if p.cur.pos < len(p.cur.buf) {
+				n := copy(b, p.cur.buf[p.cur.pos:])
+				p.cur.pos += n
+				return n, nil
+			}
+			p.free = append(p.free, p.cur.buf[:cap(p.cur.buf)])
+			p.cur = nil
+		}
+		if len(p.queue) == 0 {
+			return 0, io.EOF
+		}
+		part := p.queue[0]
+		p.queue = p.queue[1:]
+		<-part.done
+		p.fill()
+		if part.err != nil {
+			return 0, part.err
+		}
+		p.cur = part
+	}
+}
+
+// Close cancels the requests of the parts.
+func (p *prefetcher) Close() error {
+	p.cancel()
+	if p.first != nil {
+		return p.first.Close()
+	}
+	return nil
+}
@@ -0,0 +1,223 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jarxorg/s3fs/s3fake"
+)
+
+func newPrefetchData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	return data
+}
+
+func newPrefetchFSTesting(t *testing.T, data []byte) (*S3FS, *countAPI) {
+	fsys, api := newCountFSTesting(t, map[string][]byte{"large.bin": data})
+	fsys.PrefetchConcurrency = 4
+	fsys.PrefetchPartSize = 64 * 1024
+	return fsys, api
+}
+
+func TestPrefetch(t *testing.T) {
+	data := newPrefetchData(1024*1024 + 100)
+	fsys, api := newPrefetchFSTesting(t, data)
+	api.InjectFault(s3fake.Fault{Op: "GetObject", Latency: 10 * time.Millisecond})
+
+	got, err := fsys.ReadFile("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Error ReadFile got %d bytes; want %d bytes", len(got), len(data))
+	}
+	// NOTE: The first part is read from the body of Open and the other 16
+	// parts are read by the ranged GETs.
+	if n := api.count("GetObject"); n != 17 {
+		t.Errorf("Error GetObject requests %d; want %d", n, 17)
+	}
+	if n := api.maxConcurrency(); n != 4 {
+		t.Errorf("Error concurrent requests %d; want %d", n, 4)
+	}
+}
+
+func TestPrefetch_Small(t *testing.T) {
+	data := newPrefetchData(1000)
+	fsys, api := newPrefetchFSTesting(t, data)
+	got, err := fsys.ReadFile("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Error ReadFile got %d bytes; want %d bytes", len(got), len(data))
+	}
+	if n := api.count("GetObject"); n != 1 {
+		t.Errorf("Error GetObject requests %d; want %d", n, 1)
+	}
+}
+
+func TestPrefetch_Seek(t *testing.T) {
+	data := newPrefetchData(512 * 1024)
+	fsys, _ := newPrefetchFSTesting(t, data)
+	f, err := fsys.Open("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	p := make([]byte, 100*1024)
+	if _, err := io.ReadFull(f, p); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, data[:len(p)]) {
+		t.Errorf("Error Read got unexpected bytes")
+	}
+	offset := int64(200*1024 + 3)
+	if _, err := f.(io.Seeker).Seek(offset, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data[offset:]) {
+		t.Errorf("Error Read after Seek got %d bytes; want %d bytes", len(got), len(data)-int(offset))
+	}
+}
+
+func TestPrefetch_Modified(t *testing.T) {
+	data := newPrefetchData(1024 * 1024)
+	fsys, api := newPrefetchFSTesting(t, data)
+	fsys.PrefetchConcurrency = 2
+	f, err := fsys.Open("large.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWithAPI("bucket", api.API).WriteFile("large.bin", newPrefetchData(2*1024*1024), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(f); !isPreconditionFailed(err) {
+		t.Errorf("Error Read error got %v; want PreconditionFailed", err)
+	}
+	if _, err := f.Read(make([]byte, 1)); !isPreconditionFailed(err) {
+		t.Errorf("Error Read error got %v; want PreconditionFailed", err)
+	}
+}
+
+func TestPrefetch_Retry(t *testing.T) {
+	data := newPrefetchData(512 * 1024)
+	errSlowDown := awserr.New("SlowDown", "reduce your request rate", nil)
+	tests := []struct {
+		retries int
+		wantErr bool
+	}{
+		{retries: 3},
+		{retries: 0, wantErr: true},
+	}
+	for _, test := range tests {
+		fsys, api := newPrefetchFSTesting(t, data)
+		fsys.PrefetchRetries = test.retries
+		f, err := fsys.Open("large.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.InjectFault(s3fake.Fault{
+			Op:    "GetObject",
+			Key:   "large.bin",
+			Err:   errSlowDown,
+			Times: 2,
+		})
+		got, err := io.ReadAll(f)
+		f.Close()
+		if test.wantErr {
+			if !errors.Is(err, errSlowDown) {
+				t.Errorf("Error Read error got %v; want %v", err, errSlowDown)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Error Read got %d bytes; want %d bytes", len(got), len(data))
+		}
+	}
+}
+
+func TestPrefetch_RetryBackoff(t *testing.T) {
+	orig := retrySleep
+	defer func() { retrySleep = orig }()
+	var mutex sync.Mutex
+	var delays []time.Duration
+	retrySleep = func(ctx context.Context, d time.Duration) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		delays = append(delays, d)
+		return ctx.Err()
+	}
+
+	data := newPrefetchData(512 * 1024)
+	errSlowDown := awserr.New("SlowDown", "reduce your request rate", nil)
+	tests := []struct {
+		policy *RetryPolicy
+		limits []time.Duration
+	}{
+		{
+			policy: &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 15 * time.Millisecond},
+			limits: []time.Duration{10 * time.Millisecond, 15 * time.Millisecond, 15 * time.Millisecond},
+		}, {
+			limits: []time.Duration{defaultRetryBaseDelay, 2 * defaultRetryBaseDelay, 4 * defaultRetryBaseDelay},
+		},
+	}
+	for _, test := range tests {
+		delays = nil
+		fsys, api := newPrefetchFSTesting(t, data)
+		fsys.PrefetchConcurrency = 1
+		fsys.RetryPolicy = test.policy
+		if test.policy != nil {
+			// NOTE: The requests are not retried by the client.
+			fsys.RetryPolicy.Retryable = func(error) bool { return false }
+		}
+		f, err := fsys.Open("large.bin")
+		if err != nil {
+			t.Fatal(err)
+		}
+		api.InjectFault(s3fake.Fault{
+			Op:    "GetObject",
+			Key:   "large.bin",
+			Err:   errSlowDown,
+			Times: len(test.limits),
+		})
+		got, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("Error Read got %d bytes; want %d bytes", len(got), len(data))
+		}
+		if len(delays) != len(test.limits) {
+			t.Fatalf("Error delays got %v; want %d delays", delays, len(test.limits))
+		}
+		for i, d := range delays {
+			if d < 0 || d > test.limits[i] {
+				t.Errorf("Error delay of retry %d got %v; want [0, %v]", i+1, d, test.limits[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package s3fs
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// RateLimits is the limits of the requests to S3. The zero value means
+// unlimited.
+type RateLimits struct {
+	// GetRate is the maximum number of GET and HEAD requests per second.
+	GetRate float64
+	// GetBurst is the number of GET and HEAD requests that can be sent at
+	// once. If GetBurst is 0 then GetRate (at least 1) is used.
+	GetBurst int
+	// ListRate is the maximum number of LIST requests per second.
+	ListRate float64
+	// ListBurst is the number of LIST requests that can be sent at once. If
+	// ListBurst is 0 then ListRate (at least 1) is used.
+	ListBurst int
+	// WriteRate is the maximum number of PUT, COPY, POST and DELETE requests
+	// per second.
+	WriteRate float64
+	// WriteBurst is the number of PUT, COPY, POST and DELETE requests that
+	// can be sent at once. If WriteBurst is 0 then WriteRate (at least 1) is
+	// used.
+	WriteBurst int
+	// PrefixDepth is the number of the leading elements of the keys that
+	// identify the prefix, like the request rates of S3 that are limited per
+	// prefix. If PrefixDepth is greater than 0 then the rates are applied to
+	// each prefix, otherwise to the whole bucket.
+	PrefixDepth int
+	// MaxConcurrency is the maximum number of the concurrent requests. The
+	// body of GetObject is not counted after the response is returned.
+	MaxConcurrency int
+}
+
+// opClass is the class of the operations that share the rate.
+type opClass int
+
+const (
+	opGet opClass = iota
+	opList
+	opWrite
+)
+
+// bucketID identifies the token bucket.
+type bucketID struct {
+	class  opClass
+	prefix string
+}
+
+// RateLimiter limits the rate and the concurrency of the requests to S3. The
+// rate is limited by the token bucket of each operation class. A RateLimiter
+// can be shared by the filesystems, so the goroutines that use them
+// cooperate.
+type RateLimiter struct {
+	limits  RateLimits
+	mutex   sync.Mutex
+	buckets map[bucketID]*tokenBucket
+	sem     chan struct{}
+	now     func() time.Time
+}
+
+// NewRateLimiter returns a RateLimiter with the limits.
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	l := &RateLimiter{
+		limits:  limits,
+		buckets: map[bucketID]*tokenBucket{},
+		now:     time.Now,
+	}
+	if limits.MaxConcurrency > 0 {
+		l.sem = make(chan struct{}, limits.MaxConcurrency)
+	}
+	return l
+}
+
+// rate returns the rate and the burst of the operation class.
+func (l *RateLimiter) rate(class opClass) (float64, int) {
+	switch class {
+	case opGet:
+		return l.limits.GetRate, l.limits.GetBurst
+	case opList:
+		return l.limits.ListRate, l.limits.ListBurst
+	}
+	return l.limits.WriteRate, l.limits.WriteBurst
+}
+
+// prefix returns the prefix of the key that has PrefixDepth elements.
+func (l *RateLimiter) prefix(key string) string {
+	if l.limits.PrefixDepth <= 0 {
+		return ""
+	}
+	i := 0
+	for n := 0; n < l.limits.PrefixDepth; n++ {
+		j := strings.Index(key[i:], "/")
+		if j == -1 {
+			return key[:i]
+		}
+		i += j + 1
+	}
+	return key[:i]
+}
+
+// bucket returns the token bucket of the operation class and the key. If the
+// rate of the class is not limited then bucket returns nil.
+func (l *RateLimiter) bucket(class opClass, key string) *tokenBucket {
+	rate, burst := l.rate(class)
+	if rate <= 0 {
+		return nil
+	}
+	id := bucketID{class: class, prefix: l.prefix(key)}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	b, ok := l.buckets[id]
+	if !ok {
+		b = newTokenBucket(rate, burst, l.now)
+		l.buckets[id] = b
+	}
+	return b
+}
+
+// acquire waits for the token of the request and the slot of the concurrency.
+// The returned function releases the slot.
+func (l *RateLimiter) acquire(ctx context.Context, class opClass, key string) (func(), error) {
+	if b := l.bucket(class, key); b != nil {
+		if err := b.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+	if l.sem == nil {
+		return func() {}, nil
+	}
+	select {
+	case l.sem <- struct{}{}:
+		return func() { <-l.sem }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// tokenBucket is the token bucket that refills rate tokens per second up to
+// burst tokens.
+type tokenBucket struct {
+	mutex  sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	now    func() time.Time
+}
+
+func newTokenBucket(rate float64, burst int, now func() time.Time) *tokenBucket {
+	if burst <= 0 {
+		burst = max(int(rate), 1)
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+		now:    now,
+	}
+}
+
+// reserve takes a token and returns the delay until the token is available.
+func (b *tokenBucket) reserve() time.Duration {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	now := b.now()
+	if now.After(b.last) {
+		b.tokens = min(b.burst, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+		b.last = now
+	}
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// cancel returns the token that is reserved but not used.
+func (b *tokenBucket) cancel() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.tokens = min(b.burst, b.tokens+1)
+}
+
+// wait waits until a token is available. If the context is done then the
+// token is returned.
+func (b *tokenBucket) wait(ctx context.Context) error {
+	d := b.reserve()
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		b.cancel()
+		return ctx.Err()
+	}
+}
+
+// limitAPI is the S3API that limits the requests by the RateLimiter.
+type limitAPI struct {
+	api     S3API
+	limiter *RateLimiter
+}
+
+var _ S3API = (*limitAPI)(nil)
+
+// limit calls the operation after acquiring the token and the slot.
+func limit[I, O any](ctx aws.Context, l *RateLimiter, class opClass, key *string, op func(aws.Context, I, ...request.Option) (O, error), input I, opts []request.Option) (O, error) {
+	release, err := l.acquire(ctx, class, aws.StringValue(key))
+	if err != nil {
+		var output O
+		return output, err
+	}
+	defer release()
+	return op(ctx, input, opts...)
+}
+
+// GetObjectWithContext calls GetObjectWithContext of the API by the limiter.
+func (l *limitAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return limit(ctx, l.limiter, opGet, input.Key, l.api.GetObjectWithContext, input, opts)
+}
+
+// HeadObjectWithContext calls HeadObjectWithContext of the API by the limiter.
+func (l *limitAPI) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return limit(ctx, l.limiter, opGet, input.Key, l.api.HeadObjectWithContext, input, opts)
+}
+
+// PutObjectWithContext calls PutObjectWithContext of the API by the limiter.
+func (l *limitAPI) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.PutObjectWithContext, input, opts)
+}
+
+// ListObjectsV2WithContext calls ListObjectsV2WithContext of the API by the
+// limiter.
+func (l *limitAPI) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	return limit(ctx, l.limiter, opList, input.Prefix, l.api.ListObjectsV2WithContext, input, opts)
+}
+
+// ListObjectVersionsWithContext calls ListObjectVersionsWithContext of the
+// API by the limiter.
+func (l *limitAPI) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	return limit(ctx, l.limiter, opList, input.Prefix, l.api.ListObjectVersionsWithContext, input, opts)
+}
+
+// DeleteObjectWithContext calls DeleteObjectWithContext of the API by the
+// limiter.
+func (l *limitAPI) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.DeleteObjectWithContext, input, opts)
+}
+
+// DeleteObjectsWithContext calls DeleteObjectsWithContext of the API by the
+// limiter. The prefix of the first key is used.
+func (l *limitAPI) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	var key *string
+	if input.Delete != nil && len(input.Delete.Objects) > 0 {
+		key = input.Delete.Objects[0].Key
+	}
+	return limit(ctx, l.limiter, opWrite, key, l.api.DeleteObjectsWithContext, input, opts)
+}
+
+// CreateMultipartUploadWithContext calls CreateMultipartUploadWithContext of
+// the API by the limiter.
+func (l *limitAPI) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.CreateMultipartUploadWithContext, input, opts)
+}
+
+// UploadPartWithContext calls UploadPartWithContext of the API by the limiter.
+func (l *limitAPI) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.UploadPartWithContext, input, opts)
+}
+
+// CompleteMultipartUploadWithContext calls CompleteMultipartUploadWithContext
+// of the API by the limiter.
+func (l *limitAPI) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.CompleteMultipartUploadWithContext, input, opts)
+}
+
+// CopyObjectWithContext calls CopyObjectWithContext of the API by the limiter.
+func (l *limitAPI) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.CopyObjectWithContext, input, opts)
+}
+
+// UploadPartCopyWithContext calls UploadPartCopyWithContext of the API by the
+// limiter.
+func (l *limitAPI) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.UploadPartCopyWithContext, input, opts)
+}
+
+// AbortMultipartUploadWithContext calls AbortMultipartUploadWithContext of
+// the API by the limiter.
+func (l *limitAPI) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	return limit(ctx, l.limiter, opWrite, input.Key, l.api.AbortMultipartUploadWithContext, input, opts)
+}
@@ -0,0 +1,128 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jarxorg/s3fs/s3fake"
+)
+
+func newRateLimitFSTesting(t *testing.T, limits RateLimits) (*S3FS, *countAPI) {
+	api := newCountAPI(newMemFSTesting(t))
+	fsys := NewWithAPI("testdata", api)
+	fsys.RateLimiter = NewRateLimiter(limits)
+	return fsys, api
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := newTokenBucket(10, 2, func() time.Time { return now })
+
+	wants := []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond}
+	for i, want := range wants {
+		if got := b.reserve(); got != want {
+			t.Errorf("Error reserve #%d got %v; want %v", i, got, want)
+		}
+	}
+	b.cancel()
+	b.cancel()
+
+	// NOTE: The tokens are refilled up to the burst.
+	now = now.Add(time.Minute)
+	wants = []time.Duration{0, 0, 100 * time.Millisecond}
+	for i, want := range wants {
+		if got := b.reserve(); got != want {
+			t.Errorf("Error reserve #%d got %v; want %v", i, got, want)
+		}
+	}
+}
+
+func TestRateLimiter_Prefix(t *testing.T) {
+	tests := []struct {
+		depth int
+		key   string
+		want  string
+	}{
+		{depth: 0, key: "a/b/c", want: ""},
+		{depth: 1, key: "a/b/c", want: "a/"},
+		{depth: 2, key: "a/b/c", want: "a/b/"},
+		{depth: 3, key: "a/b/c", want: "a/b/"},
+		{depth: 1, key: "file", want: ""},
+	}
+	for _, test := range tests {
+		l := NewRateLimiter(RateLimits{PrefixDepth: test.depth})
+		if got := l.prefix(test.key); got != test.want {
+			t.Errorf("Error prefix(%q) depth %d got %q; want %q", test.key, test.depth, got, test.want)
+		}
+	}
+}
+
+func TestRateLimiter_MaxConcurrency(t *testing.T) {
+	fsys, api := newRateLimitFSTesting(t, RateLimits{MaxConcurrency: 3})
+	api.InjectFault(s3fake.Fault{Latency: 10 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 30)
+	for i := 0; i < 10; i++ {
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			_, err := fsys.Stat("dir0/file01.txt")
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := fsys.ReadFile("file0.txt")
+			errs <- err
+		}()
+		go func() {
+			defer wg.Done()
+			_, err := fsys.ReadDir("dir0")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := api.maxConcurrency(); n != 3 {
+		t.Errorf("Error concurrent requests %d; want %d", n, 3)
+	}
+}
+
+func TestRateLimiter_Rate(t *testing.T) {
+	fsys, _ := newRateLimitFSTesting(t, RateLimits{GetRate: 20, GetBurst: 1})
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := fsys.Stat("file0.txt"); err != nil {
+			t.Fatal(err)
+		}
+		// NOTE: The listings are not limited by GetRate.
+		if _, err := fsys.ReadDir("dir0"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed, want := time.Since(start), 200*time.Millisecond; elapsed < want {
+		t.Errorf("Error elapsed %v; want at least %v", elapsed, want)
+	}
+}
+
+func TestRateLimiter_PrefixDepth(t *testing.T) {
+	fsys, _ := newRateLimitFSTesting(t, RateLimits{GetRate: 1, GetBurst: 1, PrefixDepth: 1})
+	for _, name := range []string{"dir0/file01.txt", "file0.txt"} {
+		if _, err := fsys.Stat(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := fsys.WithContext(ctx).Stat("dir0/file02.txt"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Error Stat error got %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,286 @@
+package s3fs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxDeleteObjects is the maximum number of keys of a DeleteObjects request.
+const maxDeleteObjects = 1000
+
+// DeleteError represents a key that could not be deleted.
+type DeleteError struct {
+	Key       string
+	VersionID string
+	Code      string
+	Message   string
+}
+
+// Error returns the string of the error.
+func (e *DeleteError) Error() string {
+	key := e.Key
+	if e.VersionID != "" {
+		key += "?versionId=" + e.VersionID
+	}
+	return fmt.Sprintf("%s: %s: %s", key, e.Code, e.Message)
+}
+
+// RemoveAllError is the error that RemoveAll returns when some keys could not
+// be deleted. The other keys are deleted.
+type RemoveAllError struct {
+	Errors []*DeleteError
+}
+
+// Error returns the string of the error.
+func (e *RemoveAllError) Error() string {
+	switch len(e.Errors) {
+	case 0:
+		return "failed to delete objects"
+	case 1:
+		return "failed to delete 1 object: " + e.Errors[0].Error()
+	}
+	return fmt.Sprintf("failed to delete %d objects: %s (and %d more)",
+		len(e.Errors), e.Errors[0].Error(), len(e.Errors)-1)
+}
+
+// toDeleteErrors converts the errors of DeleteObjects to DeleteError.
+func toDeleteErrors(errs []*s3.Error) []*DeleteError {
+	var deleteErrs []*DeleteError
+	for _, e := range errs {
+		deleteErrs = append(deleteErrs, &DeleteError{
+			Key:       aws.StringValue(e.Key),
+			VersionID: aws.StringValue(e.VersionId),
+			Code:      aws.StringValue(e.Code),
+			Message:   aws.StringValue(e.Message),
+		})
+	}
+	return deleteErrs
+}
+
+// isXMLText reports whether s can be represented in XML 1.0.
+func isXMLText(s string) bool {
+	if !utf8.ValidString(s) {
+		return false
+	}
+	for _, r := range s {
+		switch {
+		case r == '\t' || r == '\n' || r == '\r':
+		case r < 0x20, r >= 0xD800 && r < 0xE000, r == 0xFFFE, r == 0xFFFF:
+			return false
+		}
+	}
+	return true
+}
+
+// deleteObjects deletes the objects by DeleteObjects and returns the keys
+// that could not be deleted. The keys that can not be represented in XML such
+// as the keys that contain the control characters are deleted by
+// DeleteObject one by one.
+func (fsys *S3FS) deleteObjects(ids []*s3.ObjectIdentifier) ([]*DeleteError, error) {
+	var xmlIDs []*s3.ObjectIdentifier
+	for _, id := range ids {
+		if isXMLText(aws.StringValue(id.Key)) {
+			xmlIDs = append(xmlIDs, id)
+			continue
+		}
+		input := &s3.DeleteObjectInput{
+			Bucket:    aws.String(fsys.bucket),
+			Key:       id.Key,
+			VersionId: id.VersionId,
+		}
+		if _, err := fsys.client().DeleteObjectWithContext(fsys.context(), input); err != nil {
+			return nil, err
+		}
+	}
+	if len(xmlIDs) == 0 {
+		return nil, nil
+	}
+	input := &s3.DeleteObjectsInput{
+		Bucket: aws.String(fsys.bucket),
+		Delete: &s3.Delete{Objects: xmlIDs, Quiet: aws.Bool(true)},
+	}
+	output, err := fsys.client().DeleteObjectsWithContext(fsys.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	return toDeleteErrors(output.Errors), nil
+}
+
+// remover deletes objects by DeleteObjects concurrently.
+type remover struct {
+	fsys      *S3FS
+	cancel    context.CancelFunc
+	batches   chan []*s3.ObjectIdentifier
+	wg        sync.WaitGroup
+	mutex     sync.Mutex
+	err       error
+	keyErrors []*DeleteError
+}
+
+func newRemover(fsys *S3FS, cancel context.CancelFunc) *remover {
+	concurrency := fsys.RemoveConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultRemoveConcurrency
+	}
+	r := &remover{
+		fsys:    fsys,
+		cancel:  cancel,
+		batches: make(chan []*s3.ObjectIdentifier),
+	}
+	for i := 0; i < concurrency; i++ {
+		r.wg.Add(1)
+		go func() {
+			defer r.wg.Done()
+			for ids := range r.batches {
+				r.deleteObjects(ids)
+			}
+		}()
+	}
+	return r
+}
+
+func (r *remover) firstErr() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.err
+}
+
+// setErr sets the error and cancels the other requests.
+func (r *remover) setErr(err error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.err == nil {
+		r.err = err
+		r.cancel()
+	}
+}
+
+func (r *remover) deleteObjects(ids []*s3.ObjectIdentifier) {
+	if r.firstErr() != nil {
+		return
+	}
+	keyErrors, err := r.fsys.deleteObjects(ids)
+	if err != nil {
+		r.setErr(err)
+		return
+	}
+	if len(keyErrors) == 0 {
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.keyErrors = append(r.keyErrors, keyErrors...)
+}
+
+// send sends the batch to the workers. send returns an error if the context
+// is done.
+func (r *remover) send(ids []*s3.ObjectIdentifier) error {
+	select {
+	case r.batches <- ids:
+		return nil
+	case <-r.fsys.context().Done():
+		return r.fsys.context().Err()
+	}
+}
+
+// wait waits for all batches and returns the first error of the requests.
+func (r *remover) wait() error {
+	close(r.batches)
+	r.wg.Wait()
+	return r.firstErr()
+}
+
+// checkRemoveKey checks the key under the prefix by InvalidKeys. The
+// directory markers are checked without the trailing slash.
+func (fsys *S3FS) checkRemoveKey(prefix, key string) (bool, error) {
+	rel := strings.TrimPrefix(key, prefix)
+	if rel == "" {
+		return true, nil
+	}
+	if strings.HasSuffix(rel, "/") {
+		rel = rel[:len(rel)-1]
+	}
+	return fsys.checkKey(key, rel)
+}
+
+// removeAll deletes all objects under the prefix. The listing is pipelined
+// with the DeleteObjects requests of the listed keys.
+func (fsys *S3FS) removeAll(prefix string) error {
+	ctx, cancel := context.WithCancel(fsys.context())
+	defer cancel()
+	cfsys := fsys.WithContext(ctx)
+	r := newRemover(cfsys, cancel)
+
+	var batch []*s3.ObjectIdentifier
+	add := func(ids []*s3.ObjectIdentifier) error {
+		for _, id := range ids {
+			batch = append(batch, id)
+			if len(batch) == maxDeleteObjects {
+				if err := r.send(batch); err != nil {
+					return err
+				}
+				batch = nil
+			}
+		}
+		return nil
+	}
+
+	var err error
+	if fsys.RemoveAllVersions {
+		err = cfsys.listObjectVersions(prefix, func(versions []*ObjectVersion) error {
+			var ids []*s3.ObjectIdentifier
+			for _, v := range versions {
+				if ok, err := fsys.checkRemoveKey(prefix, v.Key); !ok {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				ids = append(ids, &s3.ObjectIdentifier{
+					Key:       aws.String(v.Key),
+					VersionId: aws.String(v.VersionID),
+				})
+			}
+			return add(ids)
+		})
+	} else {
+		err = cfsys.listObjects(prefix, func(objects []*s3.Object) error {
+			var ids []*s3.ObjectIdentifier
+			for _, o := range objects {
+				if ok, err := fsys.checkRemoveKey(prefix, aws.StringValue(o.Key)); !ok {
+					if err != nil {
+						return err
+					}
+					continue
+				}
+				ids = append(ids, &s3.ObjectIdentifier{Key: o.Key})
+			}
+			return add(ids)
+		})
+	}
+	if err == nil && len(batch) > 0 {
+		err = r.send(batch)
+	}
+	waitErr := r.wait()
+	// NOTE: The error of the parent context takes precedence over the
+	// cancellation by the remover.
+	if ctxErr := fsys.context().Err(); ctxErr != nil {
+		return ctxErr
+	}
+	if waitErr != nil {
+		return waitErr
+	}
+	if err != nil {
+		return err
+	}
+	if len(r.keyErrors) > 0 {
+		return &RemoveAllError{Errors: r.keyErrors}
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package s3fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
+)
+
+func newDeleteObjectsFSTesting(t *testing.T, n int) (*S3FS, *countAPI) {
+	files := map[string][]byte{"other.txt": []byte("test")}
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("dir/file%04d.txt", i)] = []byte("test")
+	}
+	return newCountFSTesting(t, files)
+}
+
+// recordBatches records the numbers of the keys of the DeleteObjects requests,
+// and returns the function that returns them.
+func recordBatches(api *countAPI) func() []int {
+	var mutex sync.Mutex
+	var batches []int
+	api.before = func(op string, input interface{}) error {
+		if input, ok := input.(*s3.DeleteObjectsInput); ok {
+			mutex.Lock()
+			defer mutex.Unlock()
+			batches = append(batches, len(input.Delete.Objects))
+		}
+		return nil
+	}
+	return func() []int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return batches
+	}
+}
+
+func TestRemoveAll_Batches(t *testing.T) {
+	fsys, api := newDeleteObjectsFSTesting(t, 2500)
+	fsys.ListBufferSize = 300
+	batches := recordBatches(api)
+
+	if err := fsys.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	total := 0
+	for _, n := range batches() {
+		if n > maxDeleteObjects {
+			t.Errorf("Error DeleteObjects batch size %d; want <= %d", n, maxDeleteObjects)
+		}
+		total += n
+	}
+	if len(batches()) != 3 || total != 2500 {
+		t.Errorf("Error DeleteObjects batches %v; want 3 batches of 2500 keys", batches())
+	}
+	if _, err := fsys.Stat("dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat dir error got %v; want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.Stat("other.txt"); err != nil {
+		t.Errorf("Error Stat other.txt %v", err)
+	}
+}
+
+func TestRemoveAll_Empty(t *testing.T) {
+	fsys, api := newDeleteObjectsFSTesting(t, 0)
+	if err := fsys.RemoveAll("not-found"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.count("DeleteObjects"); n != 0 {
+		t.Errorf("Error DeleteObjects is called %d times; want 0", n)
+	}
+}
+
+func TestRemoveAll_KeyErrors(t *testing.T) {
+	fsys, api := newDeleteObjectsFSTesting(t, 20)
+	for i := 10; i < 20; i++ {
+		api.InjectFault(s3fake.Fault{
+			Op:  "DeleteObjects",
+			Key: fmt.Sprintf("dir/file%04d.txt", i),
+			Err: awserr.New("AccessDenied", "Access Denied", nil),
+		})
+	}
+
+	err := fsys.RemoveAll("dir")
+	var removeErr *RemoveAllError
+	if !errors.As(err, &removeErr) {
+		t.Fatalf("Error RemoveAll error got %v; want *RemoveAllError", err)
+	}
+	if len(removeErr.Errors) != 10 {
+		t.Fatalf("Error RemoveAllError has %d errors; want 10", len(removeErr.Errors))
+	}
+	for _, e := range removeErr.Errors {
+		if !strings.Contains(e.Key, "file001") || e.Code != "AccessDenied" {
+			t.Errorf("Error unexpected DeleteError %v", e)
+		}
+	}
+	entries, err := fsys.ReadDir("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 10 {
+		t.Errorf("Error remaining entries %d; want 10", len(entries))
+	}
+}
+
+func TestRemoveAll_DeleteObjectsError(t *testing.T) {
+	fsys, api := newDeleteObjectsFSTesting(t, 20)
+	errInternal := awserr.New("InternalError", "test", nil)
+	api.InjectFault(s3fake.Fault{Op: "DeleteObjects", Err: errInternal})
+
+	err := fsys.RemoveAll("dir")
+	if !errors.Is(err, errInternal) {
+		t.Errorf("Error RemoveAll error got %v; want %v", err, errInternal)
+	}
+}
+
+func TestRemoveAll_Versions(t *testing.T) {
+	fsys, api := newDeleteObjectsFSTesting(t, 1500)
+	fsys.ListBufferSize = 400
+	fsys.RemoveAllVersions = true
+	batches := recordBatches(api)
+
+	if err := fsys.RemoveAll("dir"); err != nil {
+		t.Fatal(err)
+	}
+	if len(batches()) != 2 {
+		t.Errorf("Error DeleteObjects batches %v; want 2 batches", batches())
+	}
+	if _, err := fsys.Stat("dir"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat dir error got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestRemoveAllError(t *testing.T) {
+	testCases := []struct {
+		err  *RemoveAllError
+		want string
+	}{
+		{
+			err:  &RemoveAllError{},
+			want: "failed to delete objects",
+		}, {
+			err: &RemoveAllError{Errors: []*DeleteError{
+				{Key: "a", Code: "AccessDenied", Message: "Access Denied"},
+			}},
+			want: "failed to delete 1 object: a: AccessDenied: Access Denied",
+		}, {
+			err: &RemoveAllError{Errors: []*DeleteError{
+				{Key: "a", VersionID: "v1", Code: "AccessDenied", Message: "Access Denied"},
+				{Key: "b", Code: "AccessDenied", Message: "Access Denied"},
+			}},
+			want: "failed to delete 2 objects: a?versionId=v1: AccessDenied: Access Denied (and 1 more)",
+		},
+	}
+	for i, tc := range testCases {
+		if got := tc.err.Error(); got != tc.want {
+			t.Errorf("Error [%d] got %s; want %s", i, got, tc.want)
+		}
+	}
+}
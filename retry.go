@@ -0,0 +1,336 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	defaultRetryMaxAttempts = 3
+	defaultRetryBaseDelay   = 100 * time.Millisecond
+	defaultRetryMaxDelay    = 5 * time.Second
+)
+
+// RetryPolicy is the policy of retrying the requests to S3. The requests are
+// retried with the exponential backoff with full jitter, the delay before the
+// n-th retry is a random duration in [0, min(MaxDelay, BaseDelay*2^(n-1))].
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of each request including
+	// the first attempt. (Default 3)
+	MaxAttempts int
+	// BaseDelay is the upper bound of the delay before the first retry.
+	// (Default 100ms)
+	BaseDelay time.Duration
+	// MaxDelay is the upper bound of the delay before each retry.
+	// (Default 5s)
+	MaxDelay time.Duration
+	// Retryable reports whether the request that failed with the error can be
+	// retried. If Retryable is nil then IsRetryable is used.
+	Retryable func(err error) bool
+}
+
+func (p *RetryPolicy) maxAttempts() int {
+	if p.MaxAttempts <= 0 {
+		return defaultRetryMaxAttempts
+	}
+	return p.MaxAttempts
+}
+
+func (p *RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// backoff returns the delay before the retry of the attempt.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	d, maxDelay := p.BaseDelay, p.MaxDelay
+	if d <= 0 {
+		d = defaultRetryBaseDelay
+	}
+	if maxDelay <= 0 {
+		maxDelay = defaultRetryMaxDelay
+	}
+	for i := 1; i < attempt && d < maxDelay; i++ {
+		d *= 2
+	}
+	return rand.N(min(d, maxDelay) + 1)
+}
+
+// retrySleep sleeps the duration. retrySleep returns the error of the context
+// if the context is done.
+var retrySleep = func(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// wait waits the backoff of the attempt. wait returns the error of the
+// context if the context is done.
+func (p *RetryPolicy) wait(ctx context.Context, attempt int) error {
+	return retrySleep(ctx, p.backoff(attempt))
+}
+
+// do calls fn until fn succeeds, the error is not retryable or the attempts
+// reach MaxAttempts.
+func (p *RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.maxAttempts() || !p.retryable(err) {
+			return err
+		}
+		if err := p.wait(ctx, attempt); err != nil {
+			return err
+		}
+	}
+}
+
+// IsRetryable reports whether the request that failed with the error can be
+// retried. The throttling errors such as SlowDown, the server errors such as
+// 503 Service Unavailable, and the connection errors such as the connection
+// reset are retryable. The errors of the context are not retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && isRetryableStatus(reqErr.StatusCode()) {
+		return true
+	}
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) && isRetryableStatus(statusErr.HTTPStatusCode()) {
+		return true
+	}
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		switch awsErr.Code() {
+		case "SlowDown", "ServiceUnavailable", "InternalError", "RequestTimeout",
+			"Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException":
+			return true
+		case request.CanceledErrorCode:
+			return false
+		}
+		if orig := awsErr.OrigErr(); orig != nil {
+			return IsRetryable(orig)
+		}
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	// NOTE: Some transports return the connection errors as the strings.
+	msg := err.Error()
+	return strings.Contains(msg, "connection reset") || strings.Contains(msg, "broken pipe")
+}
+
+func isRetryableStatus(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryAPI is the S3API that retries the requests by the policy.
+type retryAPI struct {
+	api    S3API
+	policy *RetryPolicy
+}
+
+var _ S3API = (*retryAPI)(nil)
+
+// retry calls the operation by the policy. If rewind is not nil then rewind
+// is called before each retry to rewind the body of the input.
+func retry[I, O any](ctx aws.Context, p *RetryPolicy, op func(aws.Context, I, ...request.Option) (O, error), input I, opts []request.Option, rewind func() error) (O, error) {
+	var output O
+	first := true
+	err := p.do(ctx, func() error {
+		if !first && rewind != nil {
+			if err := rewind(); err != nil {
+				return err
+			}
+		}
+		first = false
+		var err error
+		output, err = op(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+// rewinder returns the function that rewinds the body to the current offset.
+func rewinder(body io.ReadSeeker) func() error {
+	if body == nil {
+		return nil
+	}
+	offset, err := body.Seek(0, io.SeekCurrent)
+	return func() error {
+		if err != nil {
+			return err
+		}
+		_, err := body.Seek(offset, io.SeekStart)
+		return err
+	}
+}
+
+// GetObjectWithContext calls GetObjectWithContext of the API by the policy.
+func (r *retryAPI) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	return retry(ctx, r.policy, r.api.GetObjectWithContext, input, opts, nil)
+}
+
+// HeadObjectWithContext calls HeadObjectWithContext of the API by the policy.
+func (r *retryAPI) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	return retry(ctx, r.policy, r.api.HeadObjectWithContext, input, opts, nil)
+}
+
+// PutObjectWithContext calls PutObjectWithContext of the API by the policy.
+func (r *retryAPI) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	return retry(ctx, r.policy, r.api.PutObjectWithContext, input, opts, rewinder(input.Body))
+}
+
+// ListObjectsV2WithContext calls ListObjectsV2WithContext of the API by the
+// policy.
+func (r *retryAPI) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	return retry(ctx, r.policy, r.api.ListObjectsV2WithContext, input, opts, nil)
+}
+
+// ListObjectVersionsWithContext calls ListObjectVersionsWithContext of the
+// API by the policy.
+func (r *retryAPI) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	return retry(ctx, r.policy, r.api.ListObjectVersionsWithContext, input, opts, nil)
+}
+
+// DeleteObjectWithContext calls DeleteObjectWithContext of the API by the
+// policy.
+func (r *retryAPI) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	return retry(ctx, r.policy, r.api.DeleteObjectWithContext, input, opts, nil)
+}
+
+// DeleteObjectsWithContext calls DeleteObjectsWithContext of the API by the
+// policy.
+func (r *retryAPI) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	return retry(ctx, r.policy, r.api.DeleteObjectsWithContext, input, opts, nil)
+}
+
+// CreateMultipartUploadWithContext calls CreateMultipartUploadWithContext of
+// the API by the policy.
+func (r *retryAPI) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	return retry(ctx, r.policy, r.api.CreateMultipartUploadWithContext, input, opts, nil)
+}
+
+// UploadPartWithContext calls UploadPartWithContext of the API by the policy.
+func (r *retryAPI) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	return retry(ctx, r.policy, r.api.UploadPartWithContext, input, opts, rewinder(input.Body))
+}
+
+// CompleteMultipartUploadWithContext calls CompleteMultipartUploadWithContext
+// of the API by the policy.
+func (r *retryAPI) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	return retry(ctx, r.policy, r.api.CompleteMultipartUploadWithContext, input, opts, nil)
+}
+
+// CopyObjectWithContext calls CopyObjectWithContext of the API by the policy.
+func (r *retryAPI) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	return retry(ctx, r.policy, r.api.CopyObjectWithContext, input, opts, nil)
+}
+
+// UploadPartCopyWithContext calls UploadPartCopyWithContext of the API by the
+// policy.
+func (r *retryAPI) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	return retry(ctx, r.policy, r.api.UploadPartCopyWithContext, input, opts, nil)
+}
+
+// AbortMultipartUploadWithContext calls AbortMultipartUploadWithContext of
+// the API by the policy.
+func (r *retryAPI) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	return retry(ctx, r.policy, r.api.AbortMultipartUploadWithContext, input, opts, nil)
+}
+
+// resumeReader reads the body of the file from the offset to the end. If the
+// body fails in the middle then resumeReader resumes reading from the current
+// offset by a ranged GET that is pinned to the ETag of the file.
+type resumeReader struct {
+	f      *s3File
+	body   io.ReadCloser
+	offset int64
+	end    int64
+	err    error
+}
+
+// resumable wraps the body that is read from the offset to end by
+// resumeReader if RetryPolicy is set.
+func (f *s3File) resumable(body io.ReadCloser, offset, end int64) io.ReadCloser {
+	if f.fsys.RetryPolicy == nil {
+		return body
+	}
+	return &resumeReader{f: f, body: body, offset: offset, end: end}
+}
+
+// Read reads the body and resumes the body on the retryable errors.
+func (r *resumeReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+	policy := r.f.fsys.RetryPolicy
+	for attempt := 1; ; attempt++ {
+		n, err := r.body.Read(p)
+		r.offset += int64(n)
+		if err == nil {
+			return n, nil
+		}
+		if err == io.EOF {
+			if r.offset >= r.end {
+				return n, err
+			}
+			// NOTE: The body is closed before the end.
+			err = io.ErrUnexpectedEOF
+		}
+		if attempt >= policy.maxAttempts() || !policy.retryable(err) {
+			return n, err
+		}
+		r.body.Close()
+		r.body = io.NopCloser(strings.NewReader(""))
+		if err := policy.wait(r.f.fsys.context(), attempt); err != nil {
+			r.err = err
+			return n, err
+		}
+		body, err := r.f.getRange(r.offset, r.end-1, r.f.object.ETag)
+		if err != nil {
+			r.err = err
+			return n, err
+		}
+		r.body = body
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// Close closes the body.
+func (r *resumeReader) Close() error {
+	return r.body.Close()
+}
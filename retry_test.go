@@ -0,0 +1,270 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
+)
+
+var errConnReset = &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: awserr.New("SlowDown", "reduce your request rate", nil), want: true},
+		{err: awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "", nil), 503, ""), want: true},
+		{err: awserr.NewRequestFailure(awserr.New("Unknown", "", nil), 502, ""), want: true},
+		{err: awserr.New(request.ErrCodeSerialization, "", errConnReset), want: true},
+		{err: errConnReset, want: true},
+		{err: errors.New("read tcp: connection reset by peer"), want: true},
+		{err: io.ErrUnexpectedEOF, want: true},
+		{err: awserr.NewRequestFailure(awserr.New("PreconditionFailed", "", nil), 412, ""), want: false},
+		{err: awserr.New(s3.ErrCodeNoSuchKey, "", nil), want: false},
+		{err: awserr.New(request.CanceledErrorCode, "", context.Canceled), want: false},
+		{err: context.DeadlineExceeded, want: false},
+		{err: fs.ErrNotExist, want: false},
+	}
+	for _, test := range tests {
+		if got := IsRetryable(test.err); got != test.want {
+			t.Errorf("Error IsRetryable(%v) got %v; want %v", test.err, got, test.want)
+		}
+	}
+}
+
+func TestRetryPolicy_Backoff(t *testing.T) {
+	p := &RetryPolicy{BaseDelay: 10 * time.Millisecond, MaxDelay: 100 * time.Millisecond}
+	for attempt := 1; attempt <= 100; attempt++ {
+		limit := min(10*time.Millisecond<<min(attempt-1, 10), 100*time.Millisecond)
+		for i := 0; i < 10; i++ {
+			if d := p.backoff(attempt); d < 0 || d > limit {
+				t.Errorf("Error backoff(%d) got %v; want [0, %v]", attempt, d, limit)
+			}
+		}
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	errSlowDown := awserr.New("SlowDown", "reduce your request rate", nil)
+	tests := []struct {
+		policy  *RetryPolicy
+		wantErr bool
+	}{
+		{policy: &RetryPolicy{BaseDelay: time.Millisecond}},
+		{policy: &RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, wantErr: true},
+		{policy: nil, wantErr: true},
+	}
+	for _, test := range tests {
+		fsys, api := newCountFSTesting(t, map[string][]byte{"dir/file.txt": []byte("file")})
+		fsys.RetryPolicy = test.policy
+
+		for _, op := range []string{"GetObject", "ListObjectsV2"} {
+			api.InjectFault(s3fake.Fault{Op: op, Err: errSlowDown, Times: 2})
+		}
+		_, err := fsys.ReadFile("dir/file.txt")
+		if test.wantErr {
+			if !errors.Is(err, errSlowDown) {
+				t.Errorf("Error ReadFile error got %v; want %v", err, errSlowDown)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fsys.ReadDir("dir")
+		if test.wantErr {
+			if !errors.Is(err, errSlowDown) {
+				t.Errorf("Error ReadDir error got %v; want %v", err, errSlowDown)
+			}
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		api.ClearFaults()
+
+		// NOTE: The first 2 requests of PutObject fail after reading the body.
+		fails := 2
+		api.before = func(op string, input interface{}) error {
+			if input, ok := input.(*s3.PutObjectInput); ok && fails > 0 {
+				fails--
+				io.Copy(io.Discard, input.Body)
+				return awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "", nil), 503, "")
+			}
+			return nil
+		}
+		_, err = fsys.WriteFile("dir/new.txt", []byte("new"), fs.ModePerm)
+		if test.wantErr {
+			if !IsRetryable(err) {
+				t.Errorf("Error WriteFile error got %v; want ServiceUnavailable", err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		// NOTE: The body is rewound on each retry.
+		if got, err := fsys.ReadFile("dir/new.txt"); err != nil || string(got) != "new" {
+			t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "new")
+		}
+		if n := api.count("PutObject"); n != 3 {
+			t.Errorf("Error PutObject requests %d; want %d", n, 3)
+		}
+	}
+}
+
+// brokenBodies makes the bodies of GetObject fail after n bytes for the first
+// breaks requests, and records the ranged requests.
+type brokenBodies struct {
+	n         int
+	mutex     sync.Mutex
+	breaks    int
+	ranges    []string
+	ifMatches []string
+}
+
+func (b *brokenBodies) after(op string, input, output interface{}) {
+	getInput, ok := input.(*s3.GetObjectInput)
+	if !ok {
+		return
+	}
+	getOutput := output.(*s3.GetObjectOutput)
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if getInput.Range != nil {
+		b.ranges = append(b.ranges, aws.StringValue(getInput.Range))
+		b.ifMatches = append(b.ifMatches, aws.StringValue(getInput.IfMatch))
+	}
+	if b.breaks > 0 {
+		b.breaks--
+		getOutput.Body = &brokenBody{ReadCloser: getOutput.Body, n: b.n}
+	}
+}
+
+type brokenBody struct {
+	io.ReadCloser
+	n int
+}
+
+func (b *brokenBody) Read(p []byte) (int, error) {
+	if b.n <= 0 {
+		return 0, errConnReset
+	}
+	if len(p) > b.n {
+		p = p[:b.n]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.n -= n
+	return n, err
+}
+
+func newBrokenBodyFSTesting(t *testing.T, data []byte) (*S3FS, *countAPI, *brokenBodies) {
+	fsys, api := newCountFSTesting(t, map[string][]byte{"data.bin": data})
+	bodies := &brokenBodies{n: 300}
+	api.after = bodies.after
+	fsys.RetryPolicy = &RetryPolicy{BaseDelay: time.Millisecond}
+	return fsys, api, bodies
+}
+
+func TestRetryPolicy_Resume(t *testing.T) {
+	data := newPrefetchData(1000)
+	fsys, _, bodies := newBrokenBodyFSTesting(t, data)
+	info, err := fsys.Stat("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := info.Sys().(*ObjectInfo).ETag
+
+	bodies.breaks = 2
+	got, err := fsys.ReadFile("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Errorf("Error ReadFile got %d bytes; want %d bytes", len(got), len(data))
+	}
+	wantRanges := []string{"bytes=300-999", "bytes=600-999"}
+	if !reflect.DeepEqual(bodies.ranges, wantRanges) {
+		t.Errorf("Error ranges got %v; want %v", bodies.ranges, wantRanges)
+	}
+	wantIfMatches := []string{etag, etag}
+	if !reflect.DeepEqual(bodies.ifMatches, wantIfMatches) {
+		t.Errorf("Error IfMatch got %v; want %v", bodies.ifMatches, wantIfMatches)
+	}
+
+	f, err := fsys.Open("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	bodies.breaks = 1
+	p := make([]byte, 500)
+	if _, err := f.(io.ReaderAt).ReadAt(p, 200); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p, data[200:700]) {
+		t.Errorf("Error ReadAt got unexpected bytes")
+	}
+
+	fsys.RetryPolicy.MaxAttempts = 1
+	bodies.breaks = 1
+	if _, err := fsys.ReadFile("data.bin"); !errors.Is(err, syscall.ECONNRESET) {
+		t.Errorf("Error ReadFile error got %v; want %v", err, syscall.ECONNRESET)
+	}
+}
+
+func TestRetryPolicy_ResumeModified(t *testing.T) {
+	data := newPrefetchData(1000)
+	fsys, api, bodies := newBrokenBodyFSTesting(t, data)
+	bodies.breaks = 1
+	f, err := fsys.Open("data.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.Read(make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewWithAPI("bucket", api.API).WriteFile("data.bin", newPrefetchData(2000), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(f); !isPreconditionFailed(err) {
+		t.Errorf("Error Read error got %v; want PreconditionFailed", err)
+	}
+}
+
+func TestRetryPolicy_ResumeTruncated(t *testing.T) {
+	data := newPrefetchData(1000)
+	fsys, api, _ := newBrokenBodyFSTesting(t, data)
+	// NOTE: The body ends after 300 bytes without any error, and the resumed
+	// bodies end immediately.
+	api.after = func(op string, input, output interface{}) {
+		if output, ok := output.(*s3.GetObjectOutput); ok {
+			n := int64(300)
+			if input.(*s3.GetObjectInput).Range != nil {
+				n = 0
+			}
+			output.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.LimitReader(output.Body, n), output.Body}
+		}
+	}
+	for _, maxAttempts := range []int{1, 3} {
+		fsys.RetryPolicy.MaxAttempts = maxAttempts
+		if _, err := fsys.ReadFile("data.bin"); !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("Error ReadFile with MaxAttempts %d error got %v; want %v", maxAttempts, err, io.ErrUnexpectedEOF)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package s3fake
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// GetObject API operation for the filesystem.
+func (api *API) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return api.GetObjectWithContext(aws.BackgroundContext(), input)
+}
+
+// GetObjectWithContext API operation for the filesystem.
+func (api *API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	if err := api.inject(ctx, "GetObject", input.Key); err != nil {
+		return nil, err
+	}
+	return api.getObject(input)
+}
+
+// HeadObject API operation for the filesystem.
+func (api *API) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return api.HeadObjectWithContext(aws.BackgroundContext(), input)
+}
+
+// HeadObjectWithContext API operation for the filesystem.
+func (api *API) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	if err := api.inject(ctx, "HeadObject", input.Key); err != nil {
+		return nil, err
+	}
+	return api.headObject(input)
+}
+
+// PutObject API operation for the filesystem.
+func (api *API) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return api.PutObjectWithContext(aws.BackgroundContext(), input)
+}
+
+// PutObjectWithContext API operation for the filesystem.
+func (api *API) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	if err := api.inject(ctx, "PutObject", input.Key); err != nil {
+		return nil, err
+	}
+	return api.putObject(input, writeConditions(opts))
+}
+
+// CopyObject API operation for the filesystem.
+func (api *API) CopyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	return api.CopyObjectWithContext(aws.BackgroundContext(), input)
+}
+
+// CopyObjectWithContext API operation for the filesystem.
+func (api *API) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	if err := api.inject(ctx, "CopyObject", input.Key); err != nil {
+		return nil, err
+	}
+	return api.copyObject(input)
+}
+
+// DeleteObject API operation for the filesystem.
+func (api *API) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return api.DeleteObjectWithContext(aws.BackgroundContext(), input)
+}
+
+// DeleteObjectWithContext API operation for the filesystem.
+func (api *API) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	if err := api.inject(ctx, "DeleteObject", input.Key); err != nil {
+		return nil, err
+	}
+	return api.deleteObject(input)
+}
+
+// DeleteObjects API operation for the filesystem.
+func (api *API) DeleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	return api.DeleteObjectsWithContext(aws.BackgroundContext(), input)
+}
+
+// DeleteObjectsWithContext API operation for the filesystem.
+func (api *API) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	if err := api.inject(ctx, "DeleteObjects", nil); err != nil {
+		return nil, err
+	}
+	return api.deleteObjects(input)
+}
+
+// ListObjects API operation for the filesystem.
+func (api *API) ListObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	return api.ListObjectsWithContext(aws.BackgroundContext(), input)
+}
+
+// ListObjectsWithContext API operation for the filesystem.
+func (api *API) ListObjectsWithContext(ctx aws.Context, input *s3.ListObjectsInput, opts ...request.Option) (*s3.ListObjectsOutput, error) {
+	if err := api.inject(ctx, "ListObjects", input.Prefix); err != nil {
+		return nil, err
+	}
+	return api.listObjects(input)
+}
+
+// ListObjectsV2 API operation for the filesystem.
+func (api *API) ListObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	return api.ListObjectsV2WithContext(aws.BackgroundContext(), input)
+}
+
+// ListObjectsV2WithContext API operation for the filesystem.
+func (api *API) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	if err := api.inject(ctx, "ListObjectsV2", input.Prefix); err != nil {
+		return nil, err
+	}
+	return api.listObjectsV2(input)
+}
+
+// ListObjectVersions API operation for the filesystem.
+func (api *API) ListObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	return api.ListObjectVersionsWithContext(aws.BackgroundContext(), input)
+}
+
+// ListObjectVersionsWithContext API operation for the filesystem.
+func (api *API) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	if err := api.inject(ctx, "ListObjectVersions", input.Prefix); err != nil {
+		return nil, err
+	}
+	return api.listObjectVersions(input)
+}
+
+// GetObjectTagging API operation for the filesystem.
+func (api *API) GetObjectTagging(input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+	return api.GetObjectTaggingWithContext(aws.BackgroundContext(), input)
+}
+
+// GetObjectTaggingWithContext API operation for the filesystem.
+func (api *API) GetObjectTaggingWithContext(ctx aws.Context, input *s3.GetObjectTaggingInput, opts ...request.Option) (*s3.GetObjectTaggingOutput, error) {
+	if err := api.inject(ctx, "GetObjectTagging", input.Key); err != nil {
+		return nil, err
+	}
+	return api.getObjectTagging(input)
+}
+
+// PutObjectTagging API operation for the filesystem.
+func (api *API) PutObjectTagging(input *s3.PutObjectTaggingInput) (*s3.PutObjectTaggingOutput, error) {
+	return api.PutObjectTaggingWithContext(aws.BackgroundContext(), input)
+}
+
+// PutObjectTaggingWithContext API operation for the filesystem.
+func (api *API) PutObjectTaggingWithContext(ctx aws.Context, input *s3.PutObjectTaggingInput, opts ...request.Option) (*s3.PutObjectTaggingOutput, error) {
+	if err := api.inject(ctx, "PutObjectTagging", input.Key); err != nil {
+		return nil, err
+	}
+	return api.putObjectTagging(input)
+}
+
+// DeleteObjectTagging API operation for the filesystem.
+func (api *API) DeleteObjectTagging(input *s3.DeleteObjectTaggingInput) (*s3.DeleteObjectTaggingOutput, error) {
+	return api.DeleteObjectTaggingWithContext(aws.BackgroundContext(), input)
+}
+
+// DeleteObjectTaggingWithContext API operation for the filesystem.
+func (api *API) DeleteObjectTaggingWithContext(ctx aws.Context, input *s3.DeleteObjectTaggingInput, opts ...request.Option) (*s3.DeleteObjectTaggingOutput, error) {
+	if err := api.inject(ctx, "DeleteObjectTagging", input.Key); err != nil {
+		return nil, err
+	}
+	return api.deleteObjectTagging(input)
+}
+
+// CreateMultipartUpload API operation for the filesystem.
+func (api *API) CreateMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	return api.CreateMultipartUploadWithContext(aws.BackgroundContext(), input)
+}
+
+// CreateMultipartUploadWithContext API operation for the filesystem.
+func (api *API) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	if err := api.inject(ctx, "CreateMultipartUpload", input.Key); err != nil {
+		return nil, err
+	}
+	return api.createMultipartUpload(input)
+}
+
+// UploadPart API operation for the filesystem.
+func (api *API) UploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	return api.UploadPartWithContext(aws.BackgroundContext(), input)
+}
+
+// UploadPartWithContext API operation for the filesystem.
+func (api *API) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	if err := api.inject(ctx, "UploadPart", input.Key); err != nil {
+		return nil, err
+	}
+	return api.uploadPart(input)
+}
+
+// UploadPartCopy API operation for the filesystem.
+func (api *API) UploadPartCopy(input *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
+	return api.UploadPartCopyWithContext(aws.BackgroundContext(), input)
+}
+
+// UploadPartCopyWithContext API operation for the filesystem.
+func (api *API) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	if err := api.inject(ctx, "UploadPartCopy", input.Key); err != nil {
+		return nil, err
+	}
+	return api.uploadPartCopy(input)
+}
+
+// CompleteMultipartUpload API operation for the filesystem.
+func (api *API) CompleteMultipartUpload(input *s3.CompleteMultipartUploadInput) (*s3.CompleteMultipartUploadOutput, error) {
+	return api.CompleteMultipartUploadWithContext(aws.BackgroundContext(), input)
+}
+
+// CompleteMultipartUploadWithContext API operation for the filesystem.
+func (api *API) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	if err := api.inject(ctx, "CompleteMultipartUpload", input.Key); err != nil {
+		return nil, err
+	}
+	return api.completeMultipartUpload(input, writeConditions(opts))
+}
+
+// AbortMultipartUpload API operation for the filesystem.
+func (api *API) AbortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	return api.AbortMultipartUploadWithContext(aws.BackgroundContext(), input)
+}
+
+// AbortMultipartUploadWithContext API operation for the filesystem.
+func (api *API) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	if err := api.inject(ctx, "AbortMultipartUpload", input.Key); err != nil {
+		return nil, err
+	}
+	return api.abortMultipartUpload(input)
+}
+
+// ListMultipartUploads API operation for the filesystem.
+func (api *API) ListMultipartUploads(input *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error) {
+	return api.ListMultipartUploadsWithContext(aws.BackgroundContext(), input)
+}
+
+// ListMultipartUploadsWithContext API operation for the filesystem.
+func (api *API) ListMultipartUploadsWithContext(ctx aws.Context, input *s3.ListMultipartUploadsInput, opts ...request.Option) (*s3.ListMultipartUploadsOutput, error) {
+	if err := api.inject(ctx, "ListMultipartUploads", input.Prefix); err != nil {
+		return nil, err
+	}
+	return api.listMultipartUploads(input)
+}
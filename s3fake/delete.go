@@ -0,0 +1,200 @@
+package s3fake
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/wfs"
+)
+
+// maxDeleteObjects is the maximum number of the keys of DeleteObjects.
+const maxDeleteObjects = 1000
+
+// deleteVersion deletes the specified version of the named object on the
+// versioned bucket. If versionID is empty then deleteVersion adds a delete
+// marker.
+func (api *API) deleteVersion(name, versionID string) (*s3.DeletedObject, error) {
+	if versionID == "" {
+		if err := wfs.RemoveFile(api.fsys, name); err != nil && !isNotExist(err) {
+			return nil, err
+		}
+		api.deleteAttrs(name)
+		api.removeEmptyDirs(name)
+		id := api.addVersion(name, &version{deleteMarker: true})
+		return &s3.DeletedObject{
+			DeleteMarker:          aws.Bool(true),
+			DeleteMarkerVersionId: id,
+		}, nil
+	}
+
+	api.mutex.Lock()
+	versions := api.versions[name]
+	index := -1
+	for i, v := range versions {
+		if v.id == versionID {
+			index = i
+			break
+		}
+	}
+	if index == -1 {
+		api.mutex.Unlock()
+		return nil, noSuchVersion(versionID)
+	}
+	deleted := versions[index]
+	versions = append(versions[:index:index], versions[index+1:]...)
+	if len(versions) == 0 {
+		delete(api.versions, name)
+	} else {
+		api.versions[name] = versions
+	}
+	var latest *version
+	if index == len(versions) && len(versions) > 0 {
+		latest = versions[len(versions)-1]
+	}
+	api.mutex.Unlock()
+
+	output := &s3.DeletedObject{
+		DeleteMarker: aws.Bool(deleted.deleteMarker),
+		VersionId:    aws.String(versionID),
+	}
+	if index != len(versions) {
+		// NOTE: The deleted version is not the latest.
+		return output, nil
+	}
+	if latest == nil || latest.deleteMarker {
+		if err := wfs.RemoveFile(api.fsys, name); err != nil && !isNotExist(err) {
+			return nil, err
+		}
+		api.deleteAttrs(name)
+		api.removeEmptyDirs(name)
+		return output, nil
+	}
+	if _, err := wfs.WriteFile(api.fsys, name, latest.data, fs.ModePerm); err != nil {
+		return nil, err
+	}
+	api.setAttrs(name, latest.attrs)
+	return output, nil
+}
+
+func (api *API) deleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if isMarkerKey(input.Key) {
+		api.deleteMarker(name)
+		return &s3.DeleteObjectOutput{}, nil
+	}
+	api.writeMutex.Lock()
+	defer api.writeMutex.Unlock()
+	if api.IsVersioned() {
+		deleted, err := api.deleteVersion(name, aws.StringValue(input.VersionId))
+		if err != nil {
+			return nil, err
+		}
+		output := &s3.DeleteObjectOutput{
+			DeleteMarker: deleted.DeleteMarker,
+			VersionId:    deleted.VersionId,
+		}
+		if deleted.DeleteMarkerVersionId != nil {
+			output.VersionId = deleted.DeleteMarkerVersionId
+		}
+		return output, nil
+	}
+	if err := wfs.RemoveFile(api.fsys, name); err != nil {
+		return nil, toNoSuchKeyIfNotExist(err)
+	}
+	api.deleteAttrs(name)
+	api.removeEmptyDirs(name)
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+// removeEmptyDirs removes the empty parent directories of the named object
+// up to the bucket so that the deleted keys are not listed as the common
+// prefixes. The directories that have the markers are not removed.
+func (api *API) removeEmptyDirs(name string) {
+	bucket, _, _ := strings.Cut(name, "/")
+	for dir := path.Dir(name); dir != bucket && dir != "."; dir = path.Dir(dir) {
+		if api.isMarker(dir) {
+			return
+		}
+		entries, err := fs.ReadDir(api.fsys, dir)
+		if err != nil || len(entries) > 0 {
+			return
+		}
+		if err := wfs.RemoveFile(api.fsys, dir); err != nil {
+			return
+		}
+	}
+}
+
+// deleteError returns the error of DeleteObjects of the key.
+func deleteError(id *s3.ObjectIdentifier, err error) *s3.Error {
+	code, message := "InternalError", err.Error()
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		code, message = awsErr.Code(), awsErr.Message()
+	}
+	return &s3.Error{
+		Code:      aws.String(code),
+		Key:       id.Key,
+		Message:   aws.String(message),
+		VersionId: id.VersionId,
+	}
+}
+
+// deleteIdentifier deletes the object of the identifier.
+func (api *API) deleteIdentifier(bucket string, id *s3.ObjectIdentifier) (*s3.DeletedObject, error) {
+	if err := api.keyFault("DeleteObjects", aws.StringValue(id.Key)); err != nil {
+		return nil, err
+	}
+	name := path.Join(bucket, aws.StringValue(id.Key))
+	if isMarkerKey(id.Key) {
+		api.deleteMarker(name)
+		return &s3.DeletedObject{Key: id.Key}, nil
+	}
+	api.writeMutex.Lock()
+	defer api.writeMutex.Unlock()
+	if api.IsVersioned() {
+		deleted, err := api.deleteVersion(name, aws.StringValue(id.VersionId))
+		if err != nil {
+			return nil, err
+		}
+		deleted.Key = id.Key
+		return deleted, nil
+	}
+	if v := aws.StringValue(id.VersionId); v != "" && v != nullVersionID {
+		return nil, noSuchVersion(v)
+	}
+	if err := wfs.RemoveFile(api.fsys, name); err != nil && !isNotExist(err) {
+		return nil, err
+	}
+	api.deleteAttrs(name)
+	api.removeEmptyDirs(name)
+	return &s3.DeletedObject{
+		Key:       id.Key,
+		VersionId: id.VersionId,
+	}, nil
+}
+
+// deleteObjects deletes the objects. Like S3, deleting a key that does not
+// exist succeeds and the failures are reported per key.
+func (api *API) deleteObjects(input *s3.DeleteObjectsInput) (*s3.DeleteObjectsOutput, error) {
+	if input.Delete == nil || len(input.Delete.Objects) == 0 || len(input.Delete.Objects) > maxDeleteObjects {
+		return nil, awserr.New("MalformedXML", "the XML you provided was not well-formed", nil)
+	}
+	output := &s3.DeleteObjectsOutput{}
+	for _, id := range input.Delete.Objects {
+		deleted, err := api.deleteIdentifier(aws.StringValue(input.Bucket), id)
+		if err != nil {
+			output.Errors = append(output.Errors, deleteError(id, err))
+			continue
+		}
+		if !aws.BoolValue(input.Delete.Quiet) {
+			output.Deleted = append(output.Deleted, deleted)
+		}
+	}
+	return output, nil
+}
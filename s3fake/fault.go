@@ -0,0 +1,118 @@
+package s3fake
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// Fault represents a fault that is injected into the operations of API.
+type Fault struct {
+	// Op is the name of the operation such as "GetObject". If Op is empty
+	// then the fault is injected into all operations.
+	Op string
+	// Key is the key of the object. The prefix is used as the key of the
+	// listing operations. If Key is empty then the fault is injected
+	// regardless of the key. The fault of DeleteObjects with Key is reported
+	// as the error of the key in the output.
+	Key string
+	// Latency delays the operation. The delay ends when the context is done.
+	Latency time.Duration
+	// Err is returned by the operation.
+	Err error
+	// Times is the number of times the fault is injected. If Times is 0 then
+	// the fault is injected every time.
+	Times int
+}
+
+type fault struct {
+	Fault
+	remaining int
+}
+
+// InjectFault injects the fault into the operations. The faults are applied
+// in the order that they are injected.
+func (api *API) InjectFault(f Fault) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.faults = append(api.faults, &fault{Fault: f, remaining: f.Times})
+}
+
+// ClearFaults removes all faults.
+func (api *API) ClearFaults() {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.faults = nil
+}
+
+// matchFaults returns the faults that match the operation and the key, and
+// removes the faults that are injected the specified times. If keyOnly is true
+// then only the faults with Key are matched.
+func (api *API) matchFaults(op, key string, keyOnly bool) []Fault {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	var matched []Fault
+	faults := api.faults[:0]
+	for _, f := range api.faults {
+		if (f.Op != "" && f.Op != op) || (f.Key != "" && f.Key != key) || (keyOnly && f.Key == "") {
+			faults = append(faults, f)
+			continue
+		}
+		matched = append(matched, f.Fault)
+		if f.Times > 0 {
+			f.remaining--
+			if f.remaining == 0 {
+				continue
+			}
+		}
+		faults = append(faults, f)
+	}
+	api.faults = faults
+	return matched
+}
+
+// checkContext returns an error like aws-sdk-go if the context is done.
+func checkContext(ctx aws.Context) error {
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return nil
+}
+
+// inject injects the faults into the operation of the key. inject returns the
+// error of the first fault or the error of the context.
+func (api *API) inject(ctx aws.Context, op string, key *string) error {
+	if err := checkContext(ctx); err != nil {
+		return err
+	}
+	var latency time.Duration
+	var err error
+	for _, f := range api.matchFaults(op, aws.StringValue(key), false) {
+		latency += f.Latency
+		if err == nil {
+			err = f.Err
+		}
+	}
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return checkContext(ctx)
+		case <-t.C:
+		}
+	}
+	return err
+}
+
+// keyFault returns the error of the faults with the key.
+func (api *API) keyFault(op, key string) error {
+	for _, f := range api.matchFaults(op, key, true) {
+		if f.Err != nil {
+			return f.Err
+		}
+	}
+	return nil
+}
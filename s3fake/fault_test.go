@@ -0,0 +1,130 @@
+package s3fake
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func TestInjectFault(t *testing.T) {
+	wantErr := awserr.New("SlowDown", "reduce your request rate", nil)
+	api := New(newMemFSTesting(t))
+	api.InjectFault(Fault{
+		Op:    "GetObject",
+		Key:   "dir0/file01.txt",
+		Err:   wantErr,
+		Times: 2,
+	})
+	get := func(key string) error {
+		output, err := api.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			return err
+		}
+		return output.Body.Close()
+	}
+
+	if err := get("dir0/file02.txt"); err != nil {
+		t.Errorf("Error GetObject other key got %v; want nil", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := get("dir0/file01.txt"); err != wantErr {
+			t.Errorf("Error GetObject #%d got %v; want %v", i, err, wantErr)
+		}
+	}
+	if err := get("dir0/file01.txt"); err != nil {
+		t.Errorf("Error GetObject after faults got %v; want nil", err)
+	}
+
+	api.InjectFault(Fault{Err: wantErr})
+	if _, err := api.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("file0.txt"),
+	}); err != wantErr {
+		t.Errorf("Error HeadObject got %v; want %v", err, wantErr)
+	}
+	api.ClearFaults()
+	if err := get("file0.txt"); err != nil {
+		t.Errorf("Error GetObject after ClearFaults got %v; want nil", err)
+	}
+}
+
+func TestInjectFault_Latency(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	api.InjectFault(Fault{Op: "HeadObject", Latency: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := api.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("file0.txt"),
+	})
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) || awsErr.Code() != request.CanceledErrorCode {
+		t.Errorf("Error HeadObject got %v; want %s", err, request.CanceledErrorCode)
+	}
+}
+
+func TestInjectFault_DeleteObjects(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	api.InjectFault(Fault{
+		Op:  "DeleteObjects",
+		Key: "file1.txt",
+		Err: awserr.New("AccessDenied", "access denied", nil),
+	})
+	output, err := api.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String("testdata"),
+		Delete: &s3.Delete{
+			Objects: []*s3.ObjectIdentifier{
+				{Key: aws.String("file0.txt")},
+				{Key: aws.String("file1.txt")},
+				{Key: aws.String("not-found.txt")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var deleted []string
+	for _, d := range output.Deleted {
+		deleted = append(deleted, aws.StringValue(d.Key))
+	}
+	if want := []string{"file0.txt", "not-found.txt"}; !reflect.DeepEqual(deleted, want) {
+		t.Errorf("Error DeleteObjects Deleted %v; want %v", deleted, want)
+	}
+	wantErrs := []*s3.Error{{
+		Code:    aws.String("AccessDenied"),
+		Key:     aws.String("file1.txt"),
+		Message: aws.String("access denied"),
+	}}
+	if !reflect.DeepEqual(output.Errors, wantErrs) {
+		t.Errorf("Error DeleteObjects Errors %v; want %v", output.Errors, wantErrs)
+	}
+}
+
+func TestDeleteObjects_MalformedXML(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	ids := make([]*s3.ObjectIdentifier, maxDeleteObjects+1)
+	for i := range ids {
+		ids[i] = &s3.ObjectIdentifier{Key: aws.String("file0.txt")}
+	}
+	for _, objects := range [][]*s3.ObjectIdentifier{nil, ids} {
+		_, err := api.DeleteObjects(&s3.DeleteObjectsInput{
+			Bucket: aws.String("testdata"),
+			Delete: &s3.Delete{Objects: objects},
+		})
+		var awsErr awserr.Error
+		if !errors.As(err, &awsErr) || awsErr.Code() != "MalformedXML" {
+			t.Errorf("Error DeleteObjects %d keys got %v; want MalformedXML", len(objects), err)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package s3fake
+
+import (
+	"encoding/base64"
+	"io/fs"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxListKeys is the maximum number of the keys that are returned at once.
+const maxListKeys = int64(1000)
+
+func getMaxKeys(n *int64) int64 {
+	i := aws.Int64Value(n)
+	if i <= 0 || i > maxListKeys {
+		return maxListKeys
+	}
+	return i
+}
+
+// listEntry represents an object or a common prefix of a listing.
+type listEntry struct {
+	key    string
+	object *s3.Object
+}
+
+// listKeys lists the objects and the common prefixes rolled up by the
+// delimiter under the prefix in the order of the keys. The keys that are not
+// after the marker are skipped. listKeys returns at most maxKeys entries and
+// true if the listing is truncated.
+func (api *API) listKeys(bucket, prefix, delimiter, after string, maxKeys int64) ([]*listEntry, bool, error) {
+	root := bucket
+	if i := strings.LastIndex(prefix, "/"); i != -1 {
+		root = path.Join(bucket, prefix[:i])
+	}
+	var entries []*listEntry
+	seen := map[string]bool{}
+	addPrefix := func(p string) {
+		if p > after && !seen[p] {
+			seen[p] = true
+			entries = append(entries, &listEntry{key: p})
+		}
+	}
+	err := fs.WalkDir(api.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == root {
+			if root != bucket {
+				return api.addMarkerEntry(&entries, name, strings.TrimPrefix(name, bucket+"/")+"/", prefix, after, d)
+			}
+			return nil
+		}
+		key := strings.TrimPrefix(name, bucket+"/")
+		if d.IsDir() {
+			dirKey := key + "/"
+			if !strings.HasPrefix(dirKey, prefix) && !strings.HasPrefix(prefix, dirKey) {
+				return fs.SkipDir
+			}
+			// NOTE: All keys under the directory are not after the marker.
+			if after > dirKey && !strings.HasPrefix(after, dirKey) {
+				return fs.SkipDir
+			}
+			if delimiter == "/" && len(dirKey) > len(prefix) {
+				addPrefix(dirKey)
+				return fs.SkipDir
+			}
+			return api.addMarkerEntry(&entries, name, dirKey, prefix, after, d)
+		}
+		if !strings.HasPrefix(key, prefix) || key <= after {
+			return nil
+		}
+		if delimiter != "" {
+			if i := strings.Index(key[len(prefix):], delimiter); i != -1 {
+				addPrefix(key[:len(prefix)+i+len(delimiter)])
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		tag, err := api.etagOf(name)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, &listEntry{
+			key: key,
+			object: &s3.Object{
+				ETag:         aws.String(tag),
+				Key:          aws.String(key),
+				Size:         aws.Int64(info.Size()),
+				LastModified: aws.Time(info.ModTime()),
+				StorageClass: api.attrsOf(name).storageClass(),
+			},
+		})
+		return nil
+	})
+	if err != nil {
+		if isNotExist(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	if int64(len(entries)) > maxKeys {
+		return entries[:maxKeys], true, nil
+	}
+	return entries, false, nil
+}
+
+// addMarkerEntry adds the entry of the marker if the named directory has the
+// marker that is listed.
+func (api *API) addMarkerEntry(entries *[]*listEntry, name, key, prefix, after string, d fs.DirEntry) error {
+	if !strings.HasPrefix(key, prefix) || key <= after || !api.isMarker(name) {
+		return nil
+	}
+	info, err := d.Info()
+	if err != nil {
+		return err
+	}
+	*entries = append(*entries, markerEntry(key, info))
+	return nil
+}
+
+// encodeKey encodes the key if the encoding type is "url".
+func encodeKey(encodingType *string, key *string) *string {
+	if key == nil || aws.StringValue(encodingType) != s3.EncodingTypeUrl {
+		return key
+	}
+	return aws.String(strings.ReplaceAll(url.QueryEscape(*key), "%2F", "/"))
+}
+
+// splitEntries splits the entries into the contents and the common prefixes
+// with the encoding type.
+func splitEntries(entries []*listEntry, encodingType *string) ([]*s3.Object, []*s3.CommonPrefix) {
+	var contents []*s3.Object
+	var prefixes []*s3.CommonPrefix
+	for _, e := range entries {
+		if e.object == nil {
+			prefixes = append(prefixes, &s3.CommonPrefix{
+				Prefix: encodeKey(encodingType, aws.String(e.key)),
+			})
+			continue
+		}
+		e.object.Key = encodeKey(encodingType, e.object.Key)
+		contents = append(contents, e.object)
+	}
+	return contents, prefixes
+}
+
+// continuationToken returns the opaque token of the key.
+func continuationToken(key string) *string {
+	return aws.String(base64.RawURLEncoding.EncodeToString([]byte(key)))
+}
+
+func parseContinuationToken(token string) (string, error) {
+	p, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return "", invalidArgument("the continuation token provided is incorrect")
+	}
+	return string(p), nil
+}
+
+// stringOrNil returns nil if s is empty.
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return aws.String(s)
+}
+
+func (api *API) listObjectsV2(input *s3.ListObjectsV2Input) (*s3.ListObjectsV2Output, error) {
+	after := aws.StringValue(input.StartAfter)
+	if token := aws.StringValue(input.ContinuationToken); token != "" {
+		var err error
+		if after, err = parseContinuationToken(token); err != nil {
+			return nil, err
+		}
+	}
+	maxKeys := getMaxKeys(input.MaxKeys)
+	entries, truncated, err := api.listKeys(aws.StringValue(input.Bucket), aws.StringValue(input.Prefix),
+		aws.StringValue(input.Delimiter), after, maxKeys)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.ListObjectsV2Output{
+		Name:              input.Bucket,
+		Prefix:            encodeKey(input.EncodingType, aws.String(aws.StringValue(input.Prefix))),
+		Delimiter:         encodeKey(input.EncodingType, stringOrNil(aws.StringValue(input.Delimiter))),
+		StartAfter:        encodeKey(input.EncodingType, stringOrNil(aws.StringValue(input.StartAfter))),
+		ContinuationToken: stringOrNil(aws.StringValue(input.ContinuationToken)),
+		EncodingType:      input.EncodingType,
+		MaxKeys:           aws.Int64(maxKeys),
+		KeyCount:          aws.Int64(int64(len(entries))),
+		IsTruncated:       aws.Bool(truncated),
+	}
+	if truncated {
+		output.NextContinuationToken = continuationToken(entries[len(entries)-1].key)
+	}
+	output.Contents, output.CommonPrefixes = splitEntries(entries, input.EncodingType)
+	return output, nil
+}
+
+func (api *API) listObjects(input *s3.ListObjectsInput) (*s3.ListObjectsOutput, error) {
+	maxKeys := getMaxKeys(input.MaxKeys)
+	entries, truncated, err := api.listKeys(aws.StringValue(input.Bucket), aws.StringValue(input.Prefix),
+		aws.StringValue(input.Delimiter), aws.StringValue(input.Marker), maxKeys)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.ListObjectsOutput{
+		Name:         input.Bucket,
+		Prefix:       encodeKey(input.EncodingType, aws.String(aws.StringValue(input.Prefix))),
+		Delimiter:    encodeKey(input.EncodingType, stringOrNil(aws.StringValue(input.Delimiter))),
+		Marker:       encodeKey(input.EncodingType, aws.String(aws.StringValue(input.Marker))),
+		EncodingType: input.EncodingType,
+		MaxKeys:      aws.Int64(maxKeys),
+		IsTruncated:  aws.Bool(truncated),
+	}
+	// NOTE: Like S3, NextMarker is returned only if the delimiter is specified.
+	if truncated && aws.StringValue(input.Delimiter) != "" {
+		output.NextMarker = encodeKey(input.EncodingType, aws.String(entries[len(entries)-1].key))
+	}
+	output.Contents, output.CommonPrefixes = splitEntries(entries, input.EncodingType)
+	return output, nil
+}
+
+// listObjectVersions lists the versions. If the bucket is not versioned then
+// each object has only the null version.
+func (api *API) listObjectVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	var output *s3.ListObjectVersionsOutput
+	if api.IsVersioned() {
+		output = api.listVersions(input)
+	} else {
+		var err error
+		if output, err = api.listNullVersions(input); err != nil {
+			return nil, err
+		}
+	}
+	output.Name = input.Bucket
+	output.Prefix = encodeKey(input.EncodingType, aws.String(aws.StringValue(input.Prefix)))
+	output.KeyMarker = encodeKey(input.EncodingType, aws.String(aws.StringValue(input.KeyMarker)))
+	output.VersionIdMarker = aws.String(aws.StringValue(input.VersionIdMarker))
+	output.MaxKeys = aws.Int64(getMaxKeys(input.MaxKeys))
+	output.EncodingType = input.EncodingType
+	output.NextKeyMarker = encodeKey(input.EncodingType, output.NextKeyMarker)
+	for _, v := range output.Versions {
+		v.Key = encodeKey(input.EncodingType, v.Key)
+	}
+	for _, m := range output.DeleteMarkers {
+		m.Key = encodeKey(input.EncodingType, m.Key)
+	}
+	return output, nil
+}
+
+// listNullVersions lists the null versions on the unversioned bucket.
+func (api *API) listNullVersions(input *s3.ListObjectVersionsInput) (*s3.ListObjectVersionsOutput, error) {
+	entries, truncated, err := api.listKeys(aws.StringValue(input.Bucket), aws.StringValue(input.Prefix),
+		"", aws.StringValue(input.KeyMarker), getMaxKeys(input.MaxKeys))
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.ListObjectVersionsOutput{
+		IsTruncated: aws.Bool(truncated),
+	}
+	for _, e := range entries {
+		o := e.object
+		output.Versions = append(output.Versions, &s3.ObjectVersion{
+			ETag:         o.ETag,
+			IsLatest:     aws.Bool(true),
+			Key:          o.Key,
+			LastModified: o.LastModified,
+			Size:         o.Size,
+			StorageClass: o.StorageClass,
+			VersionId:    aws.String(nullVersionID),
+		})
+	}
+	if truncated && len(output.Versions) > 0 {
+		last := output.Versions[len(output.Versions)-1]
+		output.NextKeyMarker = aws.String(aws.StringValue(last.Key))
+		output.NextVersionIdMarker = last.VersionId
+	}
+	return output, nil
+}
+
+// listVersions lists the versions on the versioned bucket in the order of
+// keys and newest first.
+func (api *API) listVersions(input *s3.ListObjectVersionsInput) *s3.ListObjectVersionsOutput {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+
+	bucket := aws.StringValue(input.Bucket) + "/"
+	prefix := aws.StringValue(input.Prefix)
+	var names []string
+	for name := range api.versions {
+		if strings.HasPrefix(name, bucket+prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	output := &s3.ListObjectVersionsOutput{IsTruncated: aws.Bool(false)}
+	limit := getMaxKeys(input.MaxKeys)
+	keyMarker := aws.StringValue(input.KeyMarker)
+	versionIDMarker := aws.StringValue(input.VersionIdMarker)
+	count := int64(0)
+	for _, name := range names {
+		key := strings.TrimPrefix(name, bucket)
+		if key < keyMarker || (key == keyMarker && versionIDMarker == "") {
+			continue
+		}
+		versions := api.versions[name]
+		for i := len(versions) - 1; i >= 0; i-- {
+			v := versions[i]
+			if key == keyMarker {
+				if v.id == versionIDMarker {
+					versionIDMarker = ""
+					keyMarker = ""
+				}
+				continue
+			}
+			if count >= limit {
+				output.IsTruncated = aws.Bool(true)
+				return output
+			}
+			isLatest := aws.Bool(i == len(versions)-1)
+			if v.deleteMarker {
+				output.DeleteMarkers = append(output.DeleteMarkers, &s3.DeleteMarkerEntry{
+					IsLatest:     isLatest,
+					Key:          aws.String(key),
+					LastModified: aws.Time(v.modTime),
+					VersionId:    aws.String(v.id),
+				})
+			} else {
+				output.Versions = append(output.Versions, &s3.ObjectVersion{
+					ETag:         aws.String(etag(v.data)),
+					IsLatest:     isLatest,
+					Key:          aws.String(key),
+					LastModified: aws.Time(v.modTime),
+					Size:         aws.Int64(int64(len(v.data))),
+					StorageClass: v.attrs.storageClass(),
+					VersionId:    aws.String(v.id),
+				})
+			}
+			output.NextKeyMarker = aws.String(key)
+			output.NextVersionIdMarker = aws.String(v.id)
+			count++
+		}
+	}
+	output.NextKeyMarker = nil
+	output.NextVersionIdMarker = nil
+	return output
+}
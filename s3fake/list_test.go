@@ -0,0 +1,396 @@
+package s3fake
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/wfs"
+)
+
+// newObjectTesting returns the object of the named file for the expected
+// listing.
+func newObjectTesting(t *testing.T, fsys fs.FS, name string) *s3.Object {
+	info, err := fs.Stat(fsys, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, key, _ := strings.Cut(name, "/")
+	return &s3.Object{
+		ETag:         aws.String(etag(data)),
+		Key:          aws.String(key),
+		Size:         aws.Int64(info.Size()),
+		LastModified: aws.Time(info.ModTime()),
+		StorageClass: aws.String(s3.ObjectStorageClassStandard),
+	}
+}
+
+func TestListObjectV2(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	want := &s3.ListObjectsV2Output{
+		Name:                  aws.String("testdata"),
+		Prefix:                aws.String("dir0"),
+		StartAfter:            aws.String("dir0/file01.txt"),
+		MaxKeys:               aws.Int64(1),
+		KeyCount:              aws.Int64(1),
+		IsTruncated:           aws.Bool(true),
+		NextContinuationToken: continuationToken("dir0/file02.txt"),
+		Contents: []*s3.Object{
+			newObjectTesting(t, fsys, "testdata/dir0/file02.txt"),
+		},
+	}
+
+	api := New(fsys)
+	input := &s3.ListObjectsV2Input{
+		Bucket:     aws.String("testdata"),
+		Prefix:     aws.String("dir0"),
+		MaxKeys:    aws.Int64(1),
+		StartAfter: aws.String("dir0/file01.txt"),
+	}
+	got, err := api.ListObjectsV2(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf(`Error ListObjectsV2 got %v; want %v`, got, want)
+	}
+}
+
+func TestListObjectV2_DirEntryInfoError(t *testing.T) {
+	wantErr := errors.New("test")
+	fsys := wfs.DelegateFS(newMemFSTesting(t))
+	fsys.ReadDirFunc = func(name string) ([]fs.DirEntry, error) {
+		return []fs.DirEntry{
+			&wfs.DirEntryDelegator{
+				Values: wfs.DirEntryValues{
+					Name: "file09.txt",
+				},
+				InfoFunc: func() (fs.FileInfo, error) {
+					return nil, wantErr
+				},
+			},
+		}, nil
+	}
+
+	api := New(fsys)
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String("testdata"),
+		Prefix:    aws.String("dir0/"),
+		Delimiter: aws.String("/"),
+	}
+	_, gotErr := api.ListObjectsV2(input)
+	if gotErr != wantErr {
+		t.Errorf(`Error ListObjectsV2 error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestListObjectV2_Delimiter(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	want := &s3.ListObjectsV2Output{
+		Name:                  aws.String("testdata"),
+		Prefix:                aws.String(""),
+		Delimiter:             aws.String("/"),
+		MaxKeys:               aws.Int64(2),
+		KeyCount:              aws.Int64(2),
+		IsTruncated:           aws.Bool(true),
+		NextContinuationToken: continuationToken("file0.txt"),
+		Contents: []*s3.Object{
+			newObjectTesting(t, fsys, "testdata/file0.txt"),
+		},
+		CommonPrefixes: []*s3.CommonPrefix{
+			{Prefix: aws.String("dir0/")},
+		},
+	}
+
+	api := New(fsys)
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String("testdata"),
+		Prefix:    aws.String(""),
+		MaxKeys:   aws.Int64(2),
+		Delimiter: aws.String("/"),
+	}
+	got, err := api.ListObjectsV2(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf(`Error ListObjectsV2 got %v; want %v`, got, want)
+	}
+}
+
+func TestListObjectV2_DeletedPrefix(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	for _, key := range []string{"dir1/sub/a.txt", "dir1/sub/b.txt"} {
+		if _, err := api.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+			Body:   strings.NewReader("test"),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	prefixes := func() []string {
+		output, err := api.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket:    aws.String("testdata"),
+			Delimiter: aws.String("/"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, p := range output.CommonPrefixes {
+			got = append(got, aws.StringValue(p.Prefix))
+		}
+		return got
+	}
+
+	if _, err := api.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir1/sub/a.txt"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prefixes(), []string{"dir0/", "dir1/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Error CommonPrefixes got %v; want %v`, got, want)
+	}
+	if _, err := api.DeleteObjects(&s3.DeleteObjectsInput{
+		Bucket: aws.String("testdata"),
+		Delete: &s3.Delete{Objects: []*s3.ObjectIdentifier{{Key: aws.String("dir1/sub/b.txt")}}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := prefixes(), []string{"dir0/"}; !reflect.DeepEqual(got, want) {
+		t.Errorf(`Error CommonPrefixes got %v; want %v`, got, want)
+	}
+}
+
+func TestListObjectV2_Delimiter_ReadDirError(t *testing.T) {
+	wantErr := errors.New("test")
+	fsys := wfs.DelegateFS(newMemFSTesting(t))
+	fsys.ReadDirFunc = func(name string) ([]fs.DirEntry, error) {
+		return nil, wantErr
+	}
+
+	api := New(fsys)
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String("testdata"),
+		Prefix:    aws.String(""),
+		Delimiter: aws.String("/"),
+	}
+	_, gotErr := api.ListObjectsV2(input)
+	if gotErr != wantErr {
+		t.Errorf(`Error ListObjectsV2 error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestListObjectV2_Delimiter_DirEntryInfoError(t *testing.T) {
+	wantErr := errors.New("test")
+	fsys := wfs.DelegateFS(newMemFSTesting(t))
+	fsys.ReadDirFunc = func(name string) ([]fs.DirEntry, error) {
+		return []fs.DirEntry{
+			&wfs.DirEntryDelegator{
+				Values: wfs.DirEntryValues{
+					Name: "test",
+				},
+				InfoFunc: func() (fs.FileInfo, error) {
+					return nil, wantErr
+				},
+			},
+		}, nil
+	}
+
+	api := New(fsys)
+	input := &s3.ListObjectsV2Input{
+		Bucket:    aws.String("testdata"),
+		Prefix:    aws.String(""),
+		Delimiter: aws.String("/"),
+	}
+	_, gotErr := api.ListObjectsV2(input)
+	if gotErr != wantErr {
+		t.Errorf(`Error ListObjectsV2 error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestListObjectV2_ContinuationToken(t *testing.T) {
+	tests := []struct {
+		prefix    string
+		delimiter string
+		want      []string
+	}{
+		{
+			prefix: "",
+			want: []string{
+				"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt",
+				"file0.txt", "file1.txt", "file2.txt",
+			},
+		}, {
+			prefix:    "",
+			delimiter: "/",
+			want:      []string{"dir0/", "file0.txt", "file1.txt", "file2.txt"},
+		}, {
+			prefix:    "dir0/",
+			delimiter: "/",
+			want:      []string{"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt"},
+		}, {
+			prefix:    "dir",
+			delimiter: "/",
+			want:      []string{"dir0/"},
+		}, {
+			prefix: "not-found/",
+		},
+	}
+	api := New(newMemFSTesting(t))
+	for _, test := range tests {
+		var got []string
+		input := &s3.ListObjectsV2Input{
+			Bucket:    aws.String("testdata"),
+			Prefix:    aws.String(test.prefix),
+			Delimiter: aws.String(test.delimiter),
+			MaxKeys:   aws.Int64(2),
+		}
+		for {
+			output, err := api.ListObjectsV2(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n := len(output.Contents) + len(output.CommonPrefixes); int64(n) != aws.Int64Value(output.KeyCount) {
+				t.Errorf("Error ListObjectsV2(%q, %q) KeyCount %d; want %d", test.prefix, test.delimiter, aws.Int64Value(output.KeyCount), n)
+			}
+			for _, p := range output.CommonPrefixes {
+				got = append(got, aws.StringValue(p.Prefix))
+			}
+			for _, o := range output.Contents {
+				got = append(got, aws.StringValue(o.Key))
+			}
+			if !aws.BoolValue(output.IsTruncated) {
+				break
+			}
+			input.ContinuationToken = output.NextContinuationToken
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Error ListObjectsV2(%q, %q) got %v; want %v", test.prefix, test.delimiter, got, test.want)
+		}
+	}
+}
+
+func TestListObjectV2_InvalidContinuationToken(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	input := &s3.ListObjectsV2Input{
+		Bucket:            aws.String("testdata"),
+		ContinuationToken: aws.String("!"),
+	}
+	if _, err := api.ListObjectsV2(input); err == nil {
+		t.Errorf("Error ListObjectsV2 returns no error")
+	}
+}
+
+func TestListObjectV2_EncodingType(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	if _, err := wfs.WriteFile(fsys, "testdata/dir 1/file+1.txt", []byte("test"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	api := New(fsys)
+	output, err := api.ListObjectsV2(&s3.ListObjectsV2Input{
+		Bucket:       aws.String("testdata"),
+		Prefix:       aws.String("dir 1/"),
+		EncodingType: aws.String(s3.EncodingTypeUrl),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := aws.StringValue(output.Prefix), "dir+1/"; got != want {
+		t.Errorf("Error ListObjectsV2 Prefix %s; want %s", got, want)
+	}
+	if len(output.Contents) != 1 {
+		t.Fatalf("Error ListObjectsV2 Contents %v; want 1 object", output.Contents)
+	}
+	if got, want := aws.StringValue(output.Contents[0].Key), "dir+1/file%2B1.txt"; got != want {
+		t.Errorf("Error ListObjectsV2 Key %s; want %s", got, want)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	tests := []struct {
+		delimiter  string
+		nextMarker *string
+	}{
+		{
+			delimiter: "",
+		}, {
+			delimiter:  "/",
+			nextMarker: aws.String("dir0/"),
+		},
+	}
+	api := New(newMemFSTesting(t))
+	for _, test := range tests {
+		output, err := api.ListObjects(&s3.ListObjectsInput{
+			Bucket:    aws.String("testdata"),
+			Delimiter: aws.String(test.delimiter),
+			MaxKeys:   aws.Int64(1),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			t.Errorf("Error ListObjects(%q) IsTruncated false; want true", test.delimiter)
+		}
+		if !reflect.DeepEqual(output.NextMarker, test.nextMarker) {
+			t.Errorf("Error ListObjects(%q) NextMarker %v; want %v", test.delimiter, output.NextMarker, test.nextMarker)
+		}
+	}
+
+	var got []string
+	input := &s3.ListObjectsInput{
+		Bucket:  aws.String("testdata"),
+		Prefix:  aws.String("dir0/"),
+		MaxKeys: aws.Int64(2),
+	}
+	for {
+		output, err := api.ListObjects(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, o := range output.Contents {
+			got = append(got, aws.StringValue(o.Key))
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		input.Marker = output.Contents[len(output.Contents)-1].Key
+	}
+	want := []string{"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ListObjects got %v; want %v", got, want)
+	}
+}
+
+func TestListObjectVersions_Unversioned(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	output, err := api.ListObjectVersions(&s3.ListObjectVersionsInput{
+		Bucket: aws.String("testdata"),
+		Prefix: aws.String("dir0/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, v := range output.Versions {
+		got = append(got, fmt.Sprintf("%s?%s", path.Base(aws.StringValue(v.Key)), aws.StringValue(v.VersionId)))
+	}
+	want := []string{"file01.txt?null", "file02.txt?null", "file03.txt?null"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ListObjectVersions got %v; want %v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package s3fake
+
+import (
+	"bytes"
+	"io"
+	"io/fs"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/wfs"
+)
+
+// The directory markers are the empty objects whose keys end with a slash.
+// The marker is stored as the directory on the filesystem, and the names of
+// the directories that have the markers are kept in memory. The markers are
+// not versioned.
+
+// isMarkerKey reports whether the key is the key of a directory marker.
+func isMarkerKey(key *string) bool {
+	return strings.HasSuffix(aws.StringValue(key), "/")
+}
+
+// isMarker reports whether the named directory has the marker.
+func (api *API) isMarker(name string) bool {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	return api.markers[name]
+}
+
+// putMarker creates the directory of the marker. The body of the marker must
+// be empty.
+func (api *API) putMarker(name string, p []byte) error {
+	if len(p) > 0 {
+		return awserr.New("NotImplemented", "the object whose key ends with a slash must be empty", nil)
+	}
+	if info, err := fs.Stat(api.fsys, name); err == nil && !info.IsDir() {
+		return awserr.New("NotImplemented", "the object and the directory marker of the same name can not coexist", nil)
+	}
+	if err := wfs.MkdirAll(api.fsys, name, fs.ModePerm); err != nil {
+		return err
+	}
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.markers[name] = true
+	return nil
+}
+
+// statMarker returns the FileInfo of the directory of the marker.
+func (api *API) statMarker(name string) (fs.FileInfo, error) {
+	if !api.isMarker(name) {
+		return nil, noSuchKey()
+	}
+	info, err := fs.Stat(api.fsys, name)
+	if err != nil {
+		return nil, toNoSuchKeyIfNotExist(err)
+	}
+	return info, nil
+}
+
+// getMarker returns the output of GetObject of the marker.
+func (api *API) getMarker(name string, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	info, err := api.statMarker(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConditions(etag(nil), input.IfMatch, input.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	if input.Range != nil {
+		if _, _, err := parseRange(aws.StringValue(input.Range), 0); err != nil {
+			return nil, err
+		}
+	}
+	output := newGetObjectOutput(0, etag(nil), info.ModTime(), &attrs{})
+	output.Body = io.NopCloser(bytes.NewReader(nil))
+	return output, nil
+}
+
+// headMarker returns the output of HeadObject of the marker.
+func (api *API) headMarker(name string, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	info, err := api.statMarker(name)
+	if err != nil {
+		return nil, awserr.New(errCodeNotFound, "Not Found", nil)
+	}
+	if err := checkConditions(etag(nil), input.IfMatch, input.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	return newHeadObjectOutput(0, etag(nil), info.ModTime(), &attrs{}), nil
+}
+
+// deleteMarker deletes the marker. The directory is removed if it is empty.
+func (api *API) deleteMarker(name string) {
+	api.mutex.Lock()
+	delete(api.markers, name)
+	api.mutex.Unlock()
+
+	entries, err := fs.ReadDir(api.fsys, name)
+	if err != nil || len(entries) > 0 {
+		return
+	}
+	if err := wfs.RemoveFile(api.fsys, name); err == nil {
+		api.removeEmptyDirs(name)
+	}
+}
+
+// markerEntry returns the listing entry of the marker.
+func markerEntry(key string, info fs.FileInfo) *listEntry {
+	return &listEntry{
+		key: key,
+		object: &s3.Object{
+			ETag:         aws.String(etag(nil)),
+			Key:          aws.String(key),
+			Size:         aws.Int64(0),
+			LastModified: aws.Time(info.ModTime()),
+			StorageClass: aws.String(s3.ObjectStorageClassStandard),
+		},
+	}
+}
@@ -0,0 +1,503 @@
+package s3fake
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/io2"
+)
+
+// parseRange parses the HTTP Range header such as "bytes=0-9", "bytes=10-"
+// and "bytes=-10", then returns the first and last byte positions.
+func parseRange(rng string, size int64) (int64, int64, error) {
+	invalidRange := awserr.New("InvalidRange", "The requested range is not satisfiable", nil)
+	spec := strings.TrimPrefix(rng, "bytes=")
+	if spec == rng || strings.Contains(spec, ",") {
+		return 0, 0, invalidRange
+	}
+	dash := strings.Index(spec, "-")
+	if dash == -1 {
+		return 0, 0, invalidRange
+	}
+	first, last := spec[:dash], spec[dash+1:]
+	if first == "" {
+		n, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || n <= 0 || size == 0 {
+			return 0, 0, invalidRange
+		}
+		if n > size {
+			n = size
+		}
+		return size - n, size - 1, nil
+	}
+	start, err := strconv.ParseInt(first, 10, 64)
+	if err != nil || start >= size {
+		return 0, 0, invalidRange
+	}
+	end := size - 1
+	if last != "" {
+		end, err = strconv.ParseInt(last, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, invalidRange
+		}
+		if end >= size {
+			end = size - 1
+		}
+	}
+	return start, end, nil
+}
+
+// matchETag reports whether the ETag matches the condition such as
+// `"etag"`, "etag" or "*".
+func matchETag(condition, tag string) bool {
+	return condition == "*" || strings.Trim(condition, `"`) == strings.Trim(tag, `"`)
+}
+
+// checkConditions returns an error if the ETag does not satisfy IfMatch and
+// IfNoneMatch.
+func checkConditions(tag string, ifMatch, ifNoneMatch *string) error {
+	if ifMatch != nil && !matchETag(*ifMatch, tag) {
+		return preconditionFailed()
+	}
+	if ifNoneMatch != nil && matchETag(*ifNoneMatch, tag) {
+		return awserr.NewRequestFailure(
+			awserr.New("NotModified", "Not Modified", nil),
+			http.StatusNotModified, "")
+	}
+	return nil
+}
+
+// conditions is the preconditions of the write request.
+type conditions struct {
+	ifMatch     *string
+	ifNoneMatch *string
+}
+
+// writeConditions returns the preconditions that are set as the If-Match and
+// If-None-Match headers by the request options such as
+// request.WithSetRequestHeaders, because PutObjectInput and
+// CompleteMultipartUploadInput of aws-sdk-go do not have the fields.
+func writeConditions(opts []request.Option) conditions {
+	r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return conditions{
+		ifMatch:     stringOrNil(r.HTTPRequest.Header.Get("If-Match")),
+		ifNoneMatch: stringOrNil(r.HTTPRequest.Header.Get("If-None-Match")),
+	}
+}
+
+// checkWriteConditions returns an error if the named object does not satisfy
+// the preconditions. Like S3, If-None-Match supports only "*" and If-Match of
+// the object that does not exist returns NoSuchKey.
+func (api *API) checkWriteConditions(name string, c conditions) error {
+	if c.ifMatch == nil && c.ifNoneMatch == nil {
+		return nil
+	}
+	tag, err := api.etagOf(name)
+	if err != nil && !isNoSuchKey(err) {
+		return err
+	}
+	exists := err == nil
+	if c.ifNoneMatch != nil {
+		if *c.ifNoneMatch != "*" {
+			return awserr.NewRequestFailure(
+				awserr.New("NotImplemented", "If-None-Match supports only *", nil),
+				http.StatusNotImplemented, "")
+		}
+		if exists {
+			return preconditionFailed()
+		}
+	}
+	if c.ifMatch != nil {
+		if !exists {
+			return noSuchKey()
+		}
+		if !matchETag(*c.ifMatch, tag) {
+			return preconditionFailed()
+		}
+	}
+	return nil
+}
+
+func preconditionFailed() error {
+	return awserr.NewRequestFailure(
+		awserr.New("PreconditionFailed", "at least one of the pre-conditions you specified did not hold", nil),
+		http.StatusPreconditionFailed, "")
+}
+
+func (api *API) getObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if isMarkerKey(input.Key) {
+		return api.getMarker(name, input)
+	}
+	v, ok, err := api.findVersion(name, aws.StringValue(input.VersionId))
+	if err != nil {
+		return nil, err
+	}
+	if ok {
+		return api.getVersion(v, input)
+	}
+	info, err := fs.Stat(api.fsys, name)
+	if err != nil {
+		return nil, toNoSuchKeyIfNotExist(err)
+	}
+	if info.IsDir() {
+		return nil, toNoSuchKeyIfNotExist(fs.ErrNotExist)
+	}
+
+	tag, err := api.etagOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConditions(tag, input.IfMatch, input.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	output := newGetObjectOutput(info.Size(), tag, info.ModTime(), api.attrsOf(name))
+	start, end := int64(0), info.Size()-1
+	if input.Range != nil {
+		start, end, err = parseRange(aws.StringValue(input.Range), info.Size())
+		if err != nil {
+			return nil, err
+		}
+		output.ContentLength = aws.Int64(end - start + 1)
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, info.Size()))
+	}
+
+	var in io.ReadCloser
+	var r io.Reader
+	body := &io2.Delegator{}
+	body.ReadFunc = func(p []byte) (int, error) {
+		if in == nil {
+			var err error
+			in, err = api.fsys.Open(name)
+			if err != nil {
+				return 0, err
+			}
+			if _, err := io.CopyN(io.Discard, in, start); err != nil {
+				return 0, err
+			}
+			r = io.LimitReader(in, end-start+1)
+		}
+		return r.Read(p)
+	}
+	body.CloseFunc = func() error {
+		if in != nil {
+			return in.Close()
+		}
+		return nil
+	}
+	output.Body = body
+
+	return output, nil
+}
+
+func newGetObjectOutput(size int64, tag string, modTime time.Time, a *attrs) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{
+		ContentLength:        aws.Int64(size),
+		ETag:                 aws.String(tag),
+		LastModified:         aws.Time(modTime),
+		ContentType:          a.ContentType,
+		ContentEncoding:      a.ContentEncoding,
+		CacheControl:         a.CacheControl,
+		Metadata:             a.Metadata,
+		StorageClass:         a.StorageClass,
+		ServerSideEncryption: a.ServerSideEncryption,
+		SSEKMSKeyId:          a.SSEKMSKeyId,
+		TagCount:             a.tagCount(),
+	}
+}
+
+// getVersion returns the output of GetObject of the version.
+func (api *API) getVersion(v *version, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	size := int64(len(v.data))
+	if err := checkConditions(etag(v.data), input.IfMatch, input.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	output := newGetObjectOutput(size, etag(v.data), v.modTime, v.attrs)
+	output.VersionId = aws.String(v.id)
+	p := v.data
+	if input.Range != nil {
+		start, end, err := parseRange(aws.StringValue(input.Range), size)
+		if err != nil {
+			return nil, err
+		}
+		p = p[start : end+1]
+		output.ContentLength = aws.Int64(end - start + 1)
+		output.ContentRange = aws.String(fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+	output.Body = io.NopCloser(bytes.NewReader(p))
+	return output, nil
+}
+
+func (api *API) headObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if isMarkerKey(input.Key) {
+		return api.headMarker(name, input)
+	}
+	v, ok, err := api.findVersion(name, aws.StringValue(input.VersionId))
+	if err != nil {
+		if isNoSuchKey(err) {
+			return nil, awserr.New(errCodeNotFound, "Not Found", nil)
+		}
+		return nil, err
+	}
+	if ok {
+		if err := checkConditions(etag(v.data), input.IfMatch, input.IfNoneMatch); err != nil {
+			return nil, err
+		}
+		output := newHeadObjectOutput(int64(len(v.data)), etag(v.data), v.modTime, v.attrs)
+		output.VersionId = aws.String(v.id)
+		return output, nil
+	}
+	info, err := fs.Stat(api.fsys, name)
+	if err != nil {
+		if isNotExist(err) {
+			return nil, awserr.New(errCodeNotFound, "Not Found", nil)
+		}
+		return nil, err
+	}
+	if info.IsDir() {
+		return nil, awserr.New(errCodeNotFound, "Not Found", nil)
+	}
+	tag, err := api.etagOf(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkConditions(tag, input.IfMatch, input.IfNoneMatch); err != nil {
+		return nil, err
+	}
+	return newHeadObjectOutput(info.Size(), tag, info.ModTime(), api.attrsOf(name)), nil
+}
+
+func newHeadObjectOutput(size int64, tag string, modTime time.Time, a *attrs) *s3.HeadObjectOutput {
+	return &s3.HeadObjectOutput{
+		ContentLength:        aws.Int64(size),
+		ETag:                 aws.String(tag),
+		LastModified:         aws.Time(modTime),
+		ContentType:          a.ContentType,
+		ContentEncoding:      a.ContentEncoding,
+		CacheControl:         a.CacheControl,
+		Metadata:             a.Metadata,
+		StorageClass:         a.StorageClass,
+		ServerSideEncryption: a.ServerSideEncryption,
+		SSEKMSKeyId:          a.SSEKMSKeyId,
+	}
+}
+
+func (api *API) putObject(input *s3.PutObjectInput, c conditions) (*s3.PutObjectOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	var p []byte
+	if input.Body != nil {
+		var err error
+		if p, err = io.ReadAll(input.Body); err != nil {
+			return nil, err
+		}
+	}
+	if isMarkerKey(input.Key) {
+		if err := api.putMarker(name, p); err != nil {
+			return nil, err
+		}
+		return &s3.PutObjectOutput{ETag: aws.String(etag(nil))}, nil
+	}
+	versionID, err := api.writeObject(name, p, &attrs{
+		ContentType:          input.ContentType,
+		ContentEncoding:      input.ContentEncoding,
+		CacheControl:         input.CacheControl,
+		Metadata:             input.Metadata,
+		StorageClass:         input.StorageClass,
+		ServerSideEncryption: input.ServerSideEncryption,
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		Tagging:              input.Tagging,
+		ACL:                  input.ACL,
+	}, c)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectOutput{
+		ETag:      aws.String(etag(p)),
+		VersionId: versionID,
+	}, nil
+}
+
+// copySourceName returns the name and the version ID of the CopySource on the
+// filesystem.
+func copySourceName(source *string) (string, string, error) {
+	src := aws.StringValue(source)
+	versionID := ""
+	if i := strings.Index(src, "?"); i != -1 {
+		query, err := url.ParseQuery(src[i+1:])
+		if err != nil {
+			return "", "", awserr.New("InvalidArgument", "invalid copy source", err)
+		}
+		versionID = query.Get("versionId")
+		src = src[:i]
+	}
+	name, err := url.PathUnescape(strings.TrimPrefix(src, "/"))
+	if err != nil {
+		return "", "", awserr.New("InvalidArgument", "invalid copy source", err)
+	}
+	return name, versionID, nil
+}
+
+// copyAttrs returns the attributes of the destination of CopyObject by the
+// MetadataDirective and the TaggingDirective.
+func copyAttrs(src *attrs, input *s3.CopyObjectInput) *attrs {
+	a := *src
+	if aws.StringValue(input.MetadataDirective) == s3.MetadataDirectiveReplace {
+		a.ContentType = input.ContentType
+		a.ContentEncoding = input.ContentEncoding
+		a.CacheControl = input.CacheControl
+		a.Metadata = input.Metadata
+	}
+	if aws.StringValue(input.TaggingDirective) == s3.TaggingDirectiveReplace {
+		a.Tagging = input.Tagging
+	}
+	if input.StorageClass != nil {
+		a.StorageClass = input.StorageClass
+	}
+	if input.ServerSideEncryption != nil {
+		a.ServerSideEncryption = input.ServerSideEncryption
+		a.SSEKMSKeyId = input.SSEKMSKeyId
+	}
+	if input.ACL != nil {
+		a.ACL = input.ACL
+	}
+	return &a
+}
+
+func (api *API) copyObject(input *s3.CopyObjectInput) (*s3.CopyObjectOutput, error) {
+	srcName, srcVersionID, err := copySourceName(input.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	var p []byte
+	a := &attrs{}
+	if strings.HasSuffix(srcName, "/") {
+		if _, err := api.statMarker(path.Clean(srcName)); err != nil {
+			return nil, err
+		}
+	} else if p, a, err = api.readObject(srcName, srcVersionID); err != nil {
+		return nil, err
+	}
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	var versionID *string
+	if isMarkerKey(input.Key) {
+		err = api.putMarker(name, p)
+	} else {
+		versionID, err = api.writeObject(name, p, copyAttrs(a, input), conditions{})
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := fs.Stat(api.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	output := &s3.CopyObjectOutput{
+		CopyObjectResult: &s3.CopyObjectResult{
+			ETag:         aws.String(etag(p)),
+			LastModified: aws.Time(info.ModTime()),
+		},
+		VersionId: versionID,
+	}
+	if srcVersionID != "" {
+		output.CopySourceVersionId = aws.String(srcVersionID)
+	}
+	return output, nil
+}
+
+// tagSet returns the TagSet of the URL-encoded tags such as "k1=v1&k2=v2".
+func tagSet(tagging *string) ([]*s3.Tag, error) {
+	values, err := url.ParseQuery(aws.StringValue(tagging))
+	if err != nil {
+		return nil, invalidArgument("invalid tagging: " + err.Error())
+	}
+	tags := []*s3.Tag{}
+	for k, vs := range values {
+		for _, v := range vs {
+			tags = append(tags, &s3.Tag{Key: aws.String(k), Value: aws.String(v)})
+		}
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return aws.StringValue(tags[i].Key) < aws.StringValue(tags[j].Key)
+	})
+	return tags, nil
+}
+
+// statObject returns an error if the named object does not exist.
+func (api *API) statObject(name string) error {
+	if _, _, err := api.readObject(name, ""); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (api *API) getObjectTagging(input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	_, a, err := api.readObject(name, aws.StringValue(input.VersionId))
+	if err != nil {
+		return nil, err
+	}
+	tags, err := tagSet(a.Tagging)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.GetObjectTaggingOutput{TagSet: tags, VersionId: input.VersionId}, nil
+}
+
+// setTagging sets the tags of the latest version of the named object.
+func (api *API) setTagging(name string, tagging *string) error {
+	if err := api.statObject(name); err != nil {
+		return err
+	}
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	a := &attrs{}
+	if current, ok := api.attrs[name]; ok {
+		copied := *current
+		a = &copied
+	}
+	a.Tagging = tagging
+	api.attrs[name] = a
+	if versions := api.versions[name]; len(versions) > 0 {
+		versions[len(versions)-1].attrs = a
+	}
+	return nil
+}
+
+func (api *API) putObjectTagging(input *s3.PutObjectTaggingInput) (*s3.PutObjectTaggingOutput, error) {
+	values := url.Values{}
+	if input.Tagging != nil {
+		for _, tag := range input.Tagging.TagSet {
+			values.Add(aws.StringValue(tag.Key), aws.StringValue(tag.Value))
+		}
+	}
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err := api.setTagging(name, aws.String(values.Encode())); err != nil {
+		return nil, err
+	}
+	return &s3.PutObjectTaggingOutput{}, nil
+}
+
+func (api *API) deleteObjectTagging(input *s3.DeleteObjectTaggingInput) (*s3.DeleteObjectTaggingOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	if err := api.setTagging(name, nil); err != nil {
+		return nil, err
+	}
+	return &s3.DeleteObjectTaggingOutput{}, nil
+}
@@ -0,0 +1,332 @@
+// Package s3fake provides a fake of the S3 API on a filesystem for testing.
+//
+// Each directory at the root of the filesystem is a bucket, and each file
+// under the bucket is an object. The filesystem should implement the
+// interfaces of github.com/jarxorg/wfs to write objects. The attributes of the
+// objects such as the metadata and the tags, the multipart uploads and the
+// versions are kept in memory. The directory markers, the empty objects whose
+// keys end with a slash, are stored as the directories.
+//
+//	api := s3fake.New(memfs.New())
+//	fsys := s3fs.NewWithAPI("bucket", api)
+package s3fake
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io/fs"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3iface"
+	"github.com/jarxorg/wfs"
+)
+
+// API is a fake of the S3 API on a filesystem. API is safe for concurrent
+// use.
+type API struct {
+	s3iface.S3API
+	fsys  fs.FS
+	mutex sync.Mutex
+	// writeMutex serializes the writes and the deletes of the objects, so the
+	// preconditions of the conditional writes are checked atomically.
+	writeMutex sync.Mutex
+	uploads    map[string]*upload
+	attrs      map[string]*attrs
+	markers    map[string]bool
+	seq        int64
+	// versions is the version store of the objects. The buckets are versioned
+	// if versions is not nil.
+	versions map[string][]*version
+	// now returns the time that is used as LastModified of the versions.
+	now    func() time.Time
+	faults []*fault
+}
+
+var _ s3iface.S3API = (*API)(nil)
+
+// New returns a fake of the S3 API on the provided filesystem.
+func New(fsys fs.FS) *API {
+	return &API{
+		fsys:    fsys,
+		uploads: map[string]*upload{},
+		attrs:   map[string]*attrs{},
+		markers: map[string]bool{},
+		now:     time.Now,
+	}
+}
+
+// SetClock sets the function that returns the current time. The clock is used
+// as LastModified of the versions.
+func (api *API) SetClock(now func() time.Time) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.now = now
+}
+
+// upload represents an in-progress multipart upload.
+type upload struct {
+	name      string
+	bucket    string
+	key       string
+	initiated time.Time
+	parts     map[int64][]byte
+	attrs     *attrs
+}
+
+// version represents a version or a delete marker of an object on the
+// versioned bucket.
+type version struct {
+	id           string
+	data         []byte
+	attrs        *attrs
+	modTime      time.Time
+	deleteMarker bool
+}
+
+// attrs represents the attributes of an object that can not be stored on the
+// filesystem.
+type attrs struct {
+	ContentType          *string
+	ContentEncoding      *string
+	CacheControl         *string
+	Metadata             map[string]*string
+	StorageClass         *string
+	ServerSideEncryption *string
+	SSEKMSKeyId          *string
+	Tagging              *string
+	ACL                  *string
+}
+
+// tagCount returns the number of tags in the Tagging.
+func (a *attrs) tagCount() *int64 {
+	if aws.StringValue(a.Tagging) == "" {
+		return nil
+	}
+	values, err := url.ParseQuery(aws.StringValue(a.Tagging))
+	if err != nil {
+		return nil
+	}
+	return aws.Int64(int64(len(values)))
+}
+
+func (a *attrs) storageClass() *string {
+	if a.StorageClass == nil {
+		return aws.String(s3.ObjectStorageClassStandard)
+	}
+	return a.StorageClass
+}
+
+// nullVersionID is the version ID of the objects on the unversioned bucket.
+const nullVersionID = "null"
+
+// EnableVersioning enables versioning of all buckets. The existing objects
+// become the null versions. Versioning can not be suspended.
+func (api *API) EnableVersioning() error {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if api.versions != nil {
+		return nil
+	}
+	versions := map[string][]*version{}
+	err := fs.WalkDir(api.fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		p, err := fs.ReadFile(api.fsys, name)
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		a, ok := api.attrs[name]
+		if !ok {
+			a = &attrs{}
+		}
+		versions[name] = []*version{{
+			id:      nullVersionID,
+			data:    p,
+			attrs:   a,
+			modTime: info.ModTime(),
+		}}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	api.versions = versions
+	return nil
+}
+
+// IsVersioned returns true if versioning is enabled.
+func (api *API) IsVersioned() bool {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	return api.versions != nil
+}
+
+// findVersion finds the specified version of the named object. If versionID
+// is empty then findVersion finds the latest version. findVersion returns
+// false if the bucket is not versioned and the current object should be used.
+func (api *API) findVersion(name, versionID string) (*version, bool, error) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if api.versions == nil {
+		if versionID != "" && versionID != nullVersionID {
+			return nil, false, noSuchVersion(versionID)
+		}
+		return nil, false, nil
+	}
+	versions := api.versions[name]
+	if versionID == "" {
+		if len(versions) == 0 || versions[len(versions)-1].deleteMarker {
+			return nil, false, noSuchKey()
+		}
+		return versions[len(versions)-1], true, nil
+	}
+	for _, v := range versions {
+		if v.id != versionID {
+			continue
+		}
+		if v.deleteMarker {
+			return nil, false, awserr.New("MethodNotAllowed", "the specified method is not allowed against this resource", nil)
+		}
+		return v, true, nil
+	}
+	return nil, false, noSuchVersion(versionID)
+}
+
+// addVersion adds the version to the named object and returns the version ID
+// if the bucket is versioned.
+func (api *API) addVersion(name string, v *version) *string {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if api.versions == nil {
+		return nil
+	}
+	api.seq++
+	v.id = "v" + strconv.FormatInt(api.seq, 10)
+	v.modTime = api.now()
+	api.versions[name] = append(api.versions[name], v)
+	return aws.String(v.id)
+}
+
+// readObject reads the data and the attributes of the specified version of
+// the named object.
+func (api *API) readObject(name, versionID string) ([]byte, *attrs, error) {
+	v, ok, err := api.findVersion(name, versionID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if ok {
+		return v.data, v.attrs, nil
+	}
+	p, err := fs.ReadFile(api.fsys, name)
+	if err != nil {
+		return nil, nil, toNoSuchKeyIfNotExist(err)
+	}
+	return p, api.attrsOf(name), nil
+}
+
+// writeObject writes the named object if the preconditions hold and returns
+// the version ID if the bucket is versioned.
+func (api *API) writeObject(name string, p []byte, a *attrs, c conditions) (*string, error) {
+	api.writeMutex.Lock()
+	defer api.writeMutex.Unlock()
+	if err := api.checkWriteConditions(name, c); err != nil {
+		return nil, err
+	}
+	f, err := wfs.CreateFile(api.fsys, name, fs.ModePerm)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Write(p); err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	api.setAttrs(name, a)
+	return api.addVersion(name, &version{data: p, attrs: a}), nil
+}
+
+// attrsOf returns the attributes of the named object.
+func (api *API) attrsOf(name string) *attrs {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if a, ok := api.attrs[name]; ok {
+		return a
+	}
+	return &attrs{}
+}
+
+func (api *API) setAttrs(name string, a *attrs) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.attrs[name] = a
+}
+
+func (api *API) deleteAttrs(name string) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	delete(api.attrs, name)
+}
+
+// etagOf returns the ETag of the named file.
+func (api *API) etagOf(name string) (string, error) {
+	p, err := fs.ReadFile(api.fsys, name)
+	if err != nil {
+		return "", toNoSuchKeyIfNotExist(err)
+	}
+	return etag(p), nil
+}
+
+func etag(p []byte) string {
+	sum := md5.Sum(p)
+	return strconv.Quote(hex.EncodeToString(sum[:]))
+}
+
+// errCodeNotFound is the error code that HeadObject returns if the key does
+// not exist.
+const errCodeNotFound = "NotFound"
+
+func isNotExist(err error) bool {
+	return errors.Is(err, fs.ErrNotExist)
+}
+
+func isNoSuchKey(err error) bool {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	code := awsErr.Code()
+	return code == s3.ErrCodeNoSuchKey || code == errCodeNotFound
+}
+
+func noSuchKey() error {
+	return awserr.New(s3.ErrCodeNoSuchKey, "the specified key does not exist", nil)
+}
+
+func toNoSuchKeyIfNotExist(err error) error {
+	if isNotExist(err) {
+		return noSuchKey()
+	}
+	return err
+}
+
+func noSuchVersion(versionID string) error {
+	return awserr.New("NoSuchVersion", "the specified version does not exist: "+versionID, nil)
+}
+
+func invalidArgument(message string) error {
+	return awserr.New("InvalidArgument", message, nil)
+}
@@ -0,0 +1,1023 @@
+package s3fake
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/wfs"
+	"github.com/jarxorg/wfs/memfs"
+	"github.com/jarxorg/wfs/osfs"
+)
+
+func newMemFSTesting(t *testing.T) *memfs.MemFS {
+	fsys := memfs.New()
+	if err := wfs.CopyFS(fsys, osfs.New(".."), "testdata"); err != nil {
+		t.Fatal(err)
+	}
+	return fsys
+}
+
+func TestToNoSuchKeyIfNotExist(t *testing.T) {
+	tests := []struct {
+		err  error
+		want error
+	}{
+		{
+			err:  fs.ErrNotExist,
+			want: noSuchKey(),
+		}, {
+			err:  &fs.PathError{Err: fs.ErrNotExist},
+			want: noSuchKey(),
+		}, {
+			err:  &fs.PathError{Op: "stat", Path: "not-found.txt", Err: syscall.ENOENT},
+			want: noSuchKey(),
+		}, {
+			err:  fs.ErrExist,
+			want: fs.ErrExist,
+		},
+	}
+	for _, test := range tests {
+		got := toNoSuchKeyIfNotExist(test.err)
+		if got.Error() != test.want.Error() {
+			t.Errorf(`Error toNoSuchKeyIfNotExist(%v) returns %v; want %v`, test.err, got, test.want)
+		}
+	}
+}
+
+func TestGetObject(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	f, err := fsys.Open("testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	info, err := fs.Stat(fsys, "testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := New(fsys)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	}
+	output, err := api.GetObject(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Body.Close()
+
+	got, err := io.ReadAll(output.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(got) != string(want) {
+		t.Errorf(`Error Body %s; want %s`, got, want)
+	}
+	if aws.Int64Value(output.ContentLength) != info.Size() {
+		t.Errorf(`Error ContentLength %d; want %d`, output.ContentLength, info.Size())
+	}
+}
+
+func TestGetObject_OutputBodyReadError(t *testing.T) {
+	wantErr := errors.New("test")
+	fsys := wfs.DelegateFS(newMemFSTesting(t))
+	fsys.OpenFunc = func(name string) (fs.File, error) {
+		return nil, wantErr
+	}
+
+	api := New(fsys)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	}
+	output, err := api.GetObject(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Body.Close()
+
+	_, gotErr := output.Body.Read([]byte{})
+	if gotErr != wantErr {
+		t.Errorf(`Error Read error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestGetObject_OutputBodyClose(t *testing.T) {
+	fsys := newMemFSTesting(t)
+
+	api := New(fsys)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	}
+	output, err := api.GetObject(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = output.Body.Close()
+	if err != nil {
+		t.Errorf(`Error %v on closing output body`, err)
+	}
+}
+
+func TestGetObject_StatError(t *testing.T) {
+	wantErr := errors.New("test")
+	fsys := wfs.DelegateFS(newMemFSTesting(t))
+	fsys.StatFunc = func(name string) (fs.FileInfo, error) {
+		return nil, wantErr
+	}
+
+	api := New(fsys)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	}
+	_, gotErr := api.GetObject(input)
+	if gotErr != wantErr {
+		t.Errorf(`Error GetObject error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestGetObject_DirError(t *testing.T) {
+	fsys := newMemFSTesting(t)
+
+	api := New(fsys)
+	input := &s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0"),
+	}
+	wantErr := toNoSuchKeyIfNotExist(fs.ErrNotExist)
+	_, gotErr := api.GetObject(input)
+	if !reflect.DeepEqual(gotErr, wantErr) {
+		t.Errorf(`Error GetObject error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestHeadObject(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	info, err := fs.Stat(fsys, "testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := New(fsys)
+	input := &s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	}
+	output, err := api.HeadObject(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.Int64Value(output.ContentLength) != info.Size() {
+		t.Errorf(`Error ContentLength %d; want %d`, aws.Int64Value(output.ContentLength), info.Size())
+	}
+	if !aws.TimeValue(output.LastModified).Equal(info.ModTime()) {
+		t.Errorf(`Error LastModified %v; want %v`, aws.TimeValue(output.LastModified), info.ModTime())
+	}
+}
+
+func TestGetObject_Conditions(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	head, err := api.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := aws.StringValue(head.ETag)
+
+	tests := []struct {
+		ifMatch     *string
+		ifNoneMatch *string
+		wantStatus  int
+	}{
+		{ifMatch: aws.String(etag)},
+		{ifMatch: aws.String("*")},
+		{ifMatch: aws.String(`"unknown"`), wantStatus: 412},
+		{ifNoneMatch: aws.String(`"unknown"`)},
+		{ifNoneMatch: aws.String(etag), wantStatus: 304},
+		{ifNoneMatch: aws.String("*"), wantStatus: 304},
+	}
+	for _, test := range tests {
+		_, getErr := api.GetObject(&s3.GetObjectInput{
+			Bucket:      aws.String("testdata"),
+			Key:         aws.String("dir0/file01.txt"),
+			IfMatch:     test.ifMatch,
+			IfNoneMatch: test.ifNoneMatch,
+		})
+		_, headErr := api.HeadObject(&s3.HeadObjectInput{
+			Bucket:      aws.String("testdata"),
+			Key:         aws.String("dir0/file01.txt"),
+			IfMatch:     test.ifMatch,
+			IfNoneMatch: test.ifNoneMatch,
+		})
+		for _, err := range []error{getErr, headErr} {
+			status := 0
+			var reqErr awserr.RequestFailure
+			if errors.As(err, &reqErr) {
+				status = reqErr.StatusCode()
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if status != test.wantStatus {
+				t.Errorf("Error IfMatch %s IfNoneMatch %s status got %d; want %d",
+					aws.StringValue(test.ifMatch), aws.StringValue(test.ifNoneMatch), status, test.wantStatus)
+			}
+		}
+	}
+}
+
+func TestHeadObject_NotFound(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	for _, key := range []string{"dir0", "not-found.txt"} {
+		input := &s3.HeadObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+		}
+		_, err := api.HeadObject(input)
+		if !isNoSuchKey(err) {
+			t.Errorf(`Error HeadObject(%s) error got %v; want NotFound`, key, err)
+		}
+	}
+}
+
+func TestPutObject(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	want := []byte("test")
+
+	api := New(fsys)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("test.txt"),
+		Body:   bytes.NewReader(want),
+	}
+	_, err := api.PutObject(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.Open("testdata/test.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	got, err := io.ReadAll(f)
+	if string(got) != string(want) {
+		t.Errorf(`Error PutObject wrote %s; want %s`, got, want)
+	}
+}
+
+func TestPutObject_CreateFileError(t *testing.T) {
+	wantErr := errors.New("test")
+	fsys := wfs.DelegateFS(newMemFSTesting(t))
+	fsys.CreateFileFunc = func(name string, mode fs.FileMode) (wfs.WriterFile, error) {
+		return nil, wantErr
+	}
+
+	api := New(fsys)
+	input := &s3.PutObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("test.txt"),
+		Body:   bytes.NewReader([]byte{}),
+	}
+	_, gotErr := api.PutObject(input)
+	if gotErr != wantErr {
+		t.Errorf(`Error PutObject error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestPutObject_Conditions(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	head, err := api.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := aws.StringValue(head.ETag)
+
+	tests := []struct {
+		key         string
+		ifMatch     string
+		ifNoneMatch string
+		wantCode    string
+	}{
+		{key: "dir0/file01.txt", ifMatch: etag},
+		{key: "dir0/file01.txt", ifMatch: etag, wantCode: "PreconditionFailed"},
+		{key: "dir0/file01.txt", ifNoneMatch: "*", wantCode: "PreconditionFailed"},
+		{key: "dir0/new.txt", ifMatch: etag, wantCode: s3.ErrCodeNoSuchKey},
+		{key: "dir0/new.txt", ifNoneMatch: "*"},
+		{key: "dir0/new.txt", ifNoneMatch: "*", wantCode: "PreconditionFailed"},
+		{key: "dir0/new.txt", ifNoneMatch: etag, wantCode: "NotImplemented"},
+	}
+	for _, test := range tests {
+		header := map[string]string{}
+		if test.ifMatch != "" {
+			header["If-Match"] = test.ifMatch
+		}
+		if test.ifNoneMatch != "" {
+			header["If-None-Match"] = test.ifNoneMatch
+		}
+		_, err := api.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(test.key),
+			Body:   strings.NewReader("updated"),
+		}, request.WithSetRequestHeaders(header))
+		if test.wantCode == "" {
+			if err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		if !isAWSErrorCode(err, test.wantCode) {
+			t.Errorf("Error PutObject(%s) If-Match %s If-None-Match %s error got %v; want %s",
+				test.key, test.ifMatch, test.ifNoneMatch, err, test.wantCode)
+		}
+	}
+}
+
+func TestPutObject_ConcurrentCreate(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	var wg sync.WaitGroup
+	var created int32
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := api.PutObjectWithContext(aws.BackgroundContext(), &s3.PutObjectInput{
+				Bucket: aws.String("testdata"),
+				Key:    aws.String("lock"),
+				Body:   strings.NewReader(fmt.Sprint(i)),
+			}, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}))
+			if err == nil {
+				atomic.AddInt32(&created, 1)
+			} else if !isAWSErrorCode(err, "PreconditionFailed") {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if created != 1 {
+		t.Errorf("Error created %d; want %d", created, 1)
+	}
+}
+
+func TestMultipartUpload_Conditions(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	create, err := api.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	part, err := api.UploadPart(&s3.UploadPartInput{
+		Bucket:     aws.String("testdata"),
+		Key:        aws.String("dir0/file01.txt"),
+		UploadId:   create.UploadId,
+		PartNumber: aws.Int64(1),
+		Body:       strings.NewReader("part"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.CompleteMultipartUploadWithContext(aws.BackgroundContext(), &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("testdata"),
+		Key:      aws.String("dir0/file01.txt"),
+		UploadId: create.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: []*s3.CompletedPart{{ETag: part.ETag, PartNumber: aws.Int64(1)}},
+		},
+	}, request.WithSetRequestHeaders(map[string]string{"If-None-Match": "*"}))
+	if !isAWSErrorCode(err, "PreconditionFailed") {
+		t.Errorf("Error CompleteMultipartUpload error got %v; want PreconditionFailed", err)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	api := New(fsys)
+
+	created, err := api.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("multipart.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parts []*s3.CompletedPart
+	for i, p := range []string{"hello", ",world"} {
+		number := aws.Int64(int64(i + 1))
+		output, err := api.UploadPart(&s3.UploadPartInput{
+			Bucket:     aws.String("testdata"),
+			Key:        aws.String("multipart.txt"),
+			UploadId:   created.UploadId,
+			PartNumber: number,
+			Body:       strings.NewReader(p),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: output.ETag, PartNumber: number})
+	}
+	_, err = api.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String("testdata"),
+		Key:             aws.String("multipart.txt"),
+		UploadId:        created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fs.ReadFile(fsys, "testdata/multipart.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello,world"; string(got) != want {
+		t.Errorf(`Error CompleteMultipartUpload wrote %s; want %s`, got, want)
+	}
+}
+
+func TestMultipartUpload_Abort(t *testing.T) {
+	api := New(newMemFSTesting(t))
+
+	created, err := api.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("multipart.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	input := &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String("testdata"),
+		Key:      aws.String("multipart.txt"),
+		UploadId: created.UploadId,
+	}
+	if _, err := api.AbortMultipartUpload(input); err != nil {
+		t.Fatal(err)
+	}
+	_, gotErr := api.AbortMultipartUpload(input)
+	if wantErr := noSuchUpload(created.UploadId); !reflect.DeepEqual(gotErr, wantErr) {
+		t.Errorf(`Error AbortMultipartUpload error got %v; want %v`, gotErr, wantErr)
+	}
+}
+
+func TestCompleteMultipartUpload_InvalidPart(t *testing.T) {
+	api := New(newMemFSTesting(t))
+
+	created, err := api.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("multipart.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = api.CompleteMultipartUpload(&s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String("testdata"),
+		Key:      aws.String("multipart.txt"),
+		UploadId: created.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: []*s3.CompletedPart{{ETag: aws.String(`"x"`), PartNumber: aws.Int64(1)}},
+		},
+	})
+	if err == nil {
+		t.Errorf(`Error CompleteMultipartUpload returns no error`)
+	}
+}
+
+func TestGetObject_Range(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	data, err := fs.ReadFile(fsys, "testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(data)
+
+	tests := []struct {
+		rng          string
+		want         string
+		contentRange string
+	}{
+		{
+			rng:          "bytes=1-3",
+			want:         string(data[1:4]),
+			contentRange: fmt.Sprintf("bytes 1-3/%d", size),
+		}, {
+			rng:          "bytes=2-",
+			want:         string(data[2:]),
+			contentRange: fmt.Sprintf("bytes 2-%d/%d", size-1, size),
+		}, {
+			rng:          "bytes=-2",
+			want:         string(data[size-2:]),
+			contentRange: fmt.Sprintf("bytes %d-%d/%d", size-2, size-1, size),
+		}, {
+			rng:          fmt.Sprintf("bytes=1-%d", size+10),
+			want:         string(data[1:]),
+			contentRange: fmt.Sprintf("bytes 1-%d/%d", size-1, size),
+		},
+	}
+	api := New(fsys)
+	for _, test := range tests {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String("dir0/file01.txt"),
+			Range:  aws.String(test.rng),
+		}
+		output, err := api.GetObject(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := io.ReadAll(output.Body)
+		output.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != test.want {
+			t.Errorf(`Error GetObject Range %s got %q; want %q`, test.rng, got, test.want)
+		}
+		if aws.Int64Value(output.ContentLength) != int64(len(test.want)) {
+			t.Errorf(`Error GetObject Range %s ContentLength %d; want %d`, test.rng, aws.Int64Value(output.ContentLength), len(test.want))
+		}
+		if aws.StringValue(output.ContentRange) != test.contentRange {
+			t.Errorf(`Error GetObject Range %s ContentRange %s; want %s`, test.rng, aws.StringValue(output.ContentRange), test.contentRange)
+		}
+	}
+}
+
+func TestGetObject_InvalidRange(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	api := New(fsys)
+	for _, rng := range []string{"bytes=1000-", "bytes=3-1", "bytes=a-b", "lines=1-2", "bytes=0-1,3-4"} {
+		input := &s3.GetObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String("dir0/file01.txt"),
+			Range:  aws.String(rng),
+		}
+		if _, err := api.GetObject(input); err == nil {
+			t.Errorf(`Error GetObject Range %s returns no error`, rng)
+		}
+	}
+}
+
+func TestCopyObject(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	want, err := fs.ReadFile(fsys, "testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := New(fsys)
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String("testdata"),
+		Key:        aws.String("copy 1.txt"),
+		CopySource: aws.String("testdata/dir0/file01.txt"),
+	}
+	output, err := api.CopyObject(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(output.CopyObjectResult.ETag); got != etag(want) {
+		t.Errorf(`Error CopyObject ETag %s; want %s`, got, etag(want))
+	}
+	got, err := fs.ReadFile(fsys, "testdata/copy 1.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf(`Error CopyObject wrote %s; want %s`, got, want)
+	}
+
+	input.CopySource = aws.String("testdata/copy%201.txt")
+	input.Key = aws.String("copy2.txt")
+	if _, err := api.CopyObject(input); err != nil {
+		t.Fatal(err)
+	}
+
+	input.CopySource = aws.String("testdata/not-found.txt")
+	if _, err := api.CopyObject(input); !isNoSuchKey(err) {
+		t.Errorf(`Error CopyObject error got %v; want NoSuchKey`, err)
+	}
+}
+
+func TestUploadPartCopy(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	data, err := fs.ReadFile(fsys, "testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	api := New(fsys)
+	created, err := api.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("copy.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	output, err := api.UploadPartCopy(&s3.UploadPartCopyInput{
+		Bucket:          aws.String("testdata"),
+		Key:             aws.String("copy.txt"),
+		UploadId:        created.UploadId,
+		PartNumber:      aws.Int64(1),
+		CopySource:      aws.String("testdata/dir0/file01.txt"),
+		CopySourceRange: aws.String("bytes=1-2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := aws.StringValue(output.CopyPartResult.ETag), etag(data[1:3]); got != want {
+		t.Errorf(`Error UploadPartCopy ETag %s; want %s`, got, want)
+	}
+}
+
+func TestVersioning(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	api := New(fsys)
+	if err := api.EnableVersioning(); err != nil {
+		t.Fatal(err)
+	}
+	put := func(key, body string) string {
+		output, err := api.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(body),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return aws.StringValue(output.VersionId)
+	}
+	get := func(key, versionID string) (string, error) {
+		output, err := api.GetObject(&s3.GetObjectInput{
+			Bucket:    aws.String("testdata"),
+			Key:       aws.String(key),
+			VersionId: aws.String(versionID),
+		})
+		if err != nil {
+			return "", err
+		}
+		p, err := io.ReadAll(output.Body)
+		return string(p), err
+	}
+
+	v1 := put("dir0/file01.txt", "v1")
+	v2 := put("dir0/file01.txt", "v2")
+	if v1 == "" || v1 == v2 {
+		t.Fatalf("Error PutObject versions %q, %q", v1, v2)
+	}
+	if got, err := get("dir0/file01.txt", v1); err != nil || got != "v1" {
+		t.Errorf(`Error GetObject version got %q, %v; want "v1"`, got, err)
+	}
+	if got, err := get("dir0/file01.txt", ""); err != nil || got != "v2" {
+		t.Errorf(`Error GetObject latest got %q, %v; want "v2"`, got, err)
+	}
+	if _, err := get("dir0/file01.txt", "unknown"); err == nil {
+		t.Errorf("Error GetObject unknown version returns no error")
+	}
+
+	deleted, err := api.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !aws.BoolValue(deleted.DeleteMarker) {
+		t.Errorf("Error DeleteObject does not add a delete marker")
+	}
+	if _, err := get("dir0/file01.txt", ""); !isNoSuchKey(err) {
+		t.Errorf("Error GetObject deleted error got %v; want NoSuchKey", err)
+	}
+
+	// NOTE: Deleting the delete marker restores the previous version.
+	if _, err := api.DeleteObject(&s3.DeleteObjectInput{
+		Bucket:    aws.String("testdata"),
+		Key:       aws.String("dir0/file01.txt"),
+		VersionId: deleted.VersionId,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fs.ReadFile(fsys, "testdata/dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v2" {
+		t.Errorf(`Error restored file %q; want "v2"`, got)
+	}
+
+	var keys []string
+	input := &s3.ListObjectVersionsInput{
+		Bucket:  aws.String("testdata"),
+		Prefix:  aws.String("dir0/file01"),
+		MaxKeys: aws.Int64(1),
+	}
+	for {
+		output, err := api.ListObjectVersions(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range output.Versions {
+			keys = append(keys, aws.StringValue(v.Key)+"?"+aws.StringValue(v.VersionId))
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			break
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+	want := []string{
+		"dir0/file01.txt?" + v2,
+		"dir0/file01.txt?" + v1,
+		"dir0/file01.txt?null",
+	}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("Error ListObjectVersions got %v; want %v", keys, want)
+	}
+}
+
+func TestObjectTagging(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	if _, err := api.PutObject(&s3.PutObjectInput{
+		Bucket:  aws.String("testdata"),
+		Key:     aws.String("tagged.txt"),
+		Body:    strings.NewReader("test"),
+		Tagging: aws.String("b=2&a=1"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	getTags := func() []*s3.Tag {
+		output, err := api.GetObjectTagging(&s3.GetObjectTaggingInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String("tagged.txt"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return output.TagSet
+	}
+
+	want := []*s3.Tag{
+		{Key: aws.String("a"), Value: aws.String("1")},
+		{Key: aws.String("b"), Value: aws.String("2")},
+	}
+	if got := getTags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error GetObjectTagging got %v; want %v", got, want)
+	}
+
+	want = []*s3.Tag{{Key: aws.String("c"), Value: aws.String("3")}}
+	if _, err := api.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String("testdata"),
+		Key:     aws.String("tagged.txt"),
+		Tagging: &s3.Tagging{TagSet: want},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getTags(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error PutObjectTagging got %v; want %v", got, want)
+	}
+
+	if _, err := api.DeleteObjectTagging(&s3.DeleteObjectTaggingInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("tagged.txt"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if got := getTags(); len(got) != 0 {
+		t.Errorf("Error DeleteObjectTagging got %v; want empty", got)
+	}
+
+	if _, err := api.PutObjectTagging(&s3.PutObjectTaggingInput{
+		Bucket:  aws.String("testdata"),
+		Key:     aws.String("not-found.txt"),
+		Tagging: &s3.Tagging{},
+	}); !isNoSuchKey(err) {
+		t.Errorf("Error PutObjectTagging error got %v; want NoSuchKey", err)
+	}
+}
+
+func TestCopyObject_Directive(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	if _, err := api.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String("testdata"),
+		Key:         aws.String("src.txt"),
+		Body:        strings.NewReader("test"),
+		ContentType: aws.String("text/plain"),
+		Metadata:    map[string]*string{"k": aws.String("v")},
+		Tagging:     aws.String("a=1"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		input       *s3.CopyObjectInput
+		contentType string
+		metadata    map[string]*string
+		tagCount    int64
+	}{
+		{
+			input:       &s3.CopyObjectInput{},
+			contentType: "text/plain",
+			metadata:    map[string]*string{"k": aws.String("v")},
+			tagCount:    1,
+		}, {
+			input: &s3.CopyObjectInput{
+				MetadataDirective: aws.String(s3.MetadataDirectiveReplace),
+				ContentType:       aws.String("application/json"),
+				TaggingDirective:  aws.String(s3.TaggingDirectiveReplace),
+			},
+			contentType: "application/json",
+		},
+	}
+	for i, test := range tests {
+		input := test.input
+		input.Bucket = aws.String("testdata")
+		input.Key = aws.String("dst.txt")
+		input.CopySource = aws.String("testdata/src.txt")
+		if _, err := api.CopyObject(input); err != nil {
+			t.Fatal(err)
+		}
+		output, err := api.GetObject(&s3.GetObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String("dst.txt"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		output.Body.Close()
+		if got := aws.StringValue(output.ContentType); got != test.contentType {
+			t.Errorf("Error CopyObject #%d ContentType %s; want %s", i, got, test.contentType)
+		}
+		if !reflect.DeepEqual(output.Metadata, test.metadata) {
+			t.Errorf("Error CopyObject #%d Metadata %v; want %v", i, output.Metadata, test.metadata)
+		}
+		if got := aws.Int64Value(output.TagCount); got != test.tagCount {
+			t.Errorf("Error CopyObject #%d TagCount %d; want %d", i, got, test.tagCount)
+		}
+	}
+}
+
+func TestListMultipartUploads(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	ids := map[string]string{}
+	for _, key := range []string{"b.txt", "a.txt", "dir0/c.txt"} {
+		created, err := api.CreateMultipartUpload(&s3.CreateMultipartUploadInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[key] = aws.StringValue(created.UploadId)
+	}
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{
+			prefix: "",
+			want:   []string{"a.txt", "b.txt", "dir0/c.txt"},
+		}, {
+			prefix: "dir0/",
+			want:   []string{"dir0/c.txt"},
+		}, {
+			prefix: "not-found/",
+		},
+	}
+	for _, test := range tests {
+		output, err := api.ListMultipartUploads(&s3.ListMultipartUploadsInput{
+			Bucket: aws.String("testdata"),
+			Prefix: aws.String(test.prefix),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, u := range output.Uploads {
+			key := aws.StringValue(u.Key)
+			if aws.StringValue(u.UploadId) != ids[key] {
+				t.Errorf("Error ListMultipartUploads UploadId of %s %s; want %s", key, aws.StringValue(u.UploadId), ids[key])
+			}
+			got = append(got, key)
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Error ListMultipartUploads(%q) got %v; want %v", test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestDirectoryMarker(t *testing.T) {
+	api := New(newMemFSTesting(t))
+	put := func(key, body string) error {
+		_, err := api.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+			Body:   strings.NewReader(body),
+		})
+		return err
+	}
+	del := func(key string) {
+		if _, err := api.DeleteObject(&s3.DeleteObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String(key),
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	list := func(prefix string) ([]string, []string) {
+		output, err := api.ListObjectsV2(&s3.ListObjectsV2Input{
+			Bucket:    aws.String("testdata"),
+			Prefix:    aws.String(prefix),
+			Delimiter: aws.String("/"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys, prefixes []string
+		for _, o := range output.Contents {
+			keys = append(keys, aws.StringValue(o.Key))
+		}
+		for _, p := range output.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(p.Prefix))
+		}
+		return keys, prefixes
+	}
+
+	if err := put("dir1/", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := put("dir2/", "data"); !isAWSErrorCode(err, "NotImplemented") {
+		t.Errorf("Error PutObject error got %v; want NotImplemented", err)
+	}
+	head, err := api.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir1/"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if aws.Int64Value(head.ContentLength) != 0 || aws.StringValue(head.ETag) != etag(nil) {
+		t.Errorf("Error HeadObject got %d %s", aws.Int64Value(head.ContentLength), aws.StringValue(head.ETag))
+	}
+	if _, err := api.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/"),
+	}); !isAWSErrorCode(err, "NotFound") {
+		t.Errorf("Error HeadObject error got %v; want NotFound", err)
+	}
+	if _, prefixes := list(""); !reflect.DeepEqual(prefixes, []string{"dir0/", "dir1/"}) {
+		t.Errorf("Error CommonPrefixes got %v", prefixes)
+	}
+	if keys, _ := list("dir1/"); !reflect.DeepEqual(keys, []string{"dir1/"}) {
+		t.Errorf("Error Contents got %v", keys)
+	}
+
+	// NOTE: The marker keeps the directory after the files are deleted.
+	if err := put("dir1/a.txt", "a"); err != nil {
+		t.Fatal(err)
+	}
+	del("dir1/a.txt")
+	if keys, _ := list("dir1/"); !reflect.DeepEqual(keys, []string{"dir1/"}) {
+		t.Errorf("Error Contents got %v", keys)
+	}
+
+	if _, err := api.CopyObject(&s3.CopyObjectInput{
+		Bucket:     aws.String("testdata"),
+		Key:        aws.String("dir2/"),
+		CopySource: aws.String("testdata/dir1/"),
+	}); err != nil {
+		t.Fatal(err)
+	}
+	del("dir1/")
+	if _, prefixes := list(""); !reflect.DeepEqual(prefixes, []string{"dir0/", "dir2/"}) {
+		t.Errorf("Error CommonPrefixes got %v", prefixes)
+	}
+}
+
+func isAWSErrorCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
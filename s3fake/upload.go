@@ -0,0 +1,176 @@
+package s3fake
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+func noSuchUpload(uploadID *string) error {
+	return awserr.New(s3.ErrCodeNoSuchUpload, "no such upload: "+aws.StringValue(uploadID), nil)
+}
+
+func (api *API) createMultipartUpload(input *s3.CreateMultipartUploadInput) (*s3.CreateMultipartUploadOutput, error) {
+	name := path.Join(aws.StringValue(input.Bucket), aws.StringValue(input.Key))
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	api.seq++
+	uploadID := strconv.FormatInt(api.seq, 10)
+	api.uploads[uploadID] = &upload{
+		name:      name,
+		bucket:    aws.StringValue(input.Bucket),
+		key:       aws.StringValue(input.Key),
+		initiated: api.now(),
+		parts:     map[int64][]byte{},
+		attrs: &attrs{
+			ContentType:          input.ContentType,
+			ContentEncoding:      input.ContentEncoding,
+			CacheControl:         input.CacheControl,
+			Metadata:             input.Metadata,
+			StorageClass:         input.StorageClass,
+			ServerSideEncryption: input.ServerSideEncryption,
+			SSEKMSKeyId:          input.SSEKMSKeyId,
+			Tagging:              input.Tagging,
+			ACL:                  input.ACL,
+		},
+	}
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   input.Bucket,
+		Key:      input.Key,
+		UploadId: aws.String(uploadID),
+	}, nil
+}
+
+func (api *API) uploadPart(input *s3.UploadPartInput) (*s3.UploadPartOutput, error) {
+	p, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	upload, ok := api.uploads[aws.StringValue(input.UploadId)]
+	if !ok {
+		return nil, noSuchUpload(input.UploadId)
+	}
+	upload.parts[aws.Int64Value(input.PartNumber)] = p
+	return &s3.UploadPartOutput{
+		ETag: aws.String(etag(p)),
+	}, nil
+}
+
+func (api *API) completeMultipartUpload(input *s3.CompleteMultipartUploadInput, c conditions) (*s3.CompleteMultipartUploadOutput, error) {
+	api.mutex.Lock()
+	upload, ok := api.uploads[aws.StringValue(input.UploadId)]
+	delete(api.uploads, aws.StringValue(input.UploadId))
+	api.mutex.Unlock()
+	if !ok {
+		return nil, noSuchUpload(input.UploadId)
+	}
+
+	var parts []*s3.CompletedPart
+	if input.MultipartUpload != nil {
+		parts = input.MultipartUpload.Parts
+	}
+	if !sort.SliceIsSorted(parts, func(i, j int) bool {
+		return aws.Int64Value(parts[i].PartNumber) < aws.Int64Value(parts[j].PartNumber)
+	}) {
+		return nil, awserr.New("InvalidPartOrder", "the list of parts was not in ascending order", nil)
+	}
+	body := new(bytes.Buffer)
+	for _, part := range parts {
+		p, ok := upload.parts[aws.Int64Value(part.PartNumber)]
+		if !ok || etag(p) != aws.StringValue(part.ETag) {
+			return nil, awserr.New("InvalidPart", "one or more of the specified parts could not be found", nil)
+		}
+		body.Write(p)
+	}
+
+	versionID, err := api.writeObject(upload.name, body.Bytes(), upload.attrs, c)
+	if err != nil {
+		return nil, err
+	}
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    input.Bucket,
+		Key:       input.Key,
+		ETag:      aws.String(etag(body.Bytes())),
+		VersionId: versionID,
+	}, nil
+}
+
+func (api *API) abortMultipartUpload(input *s3.AbortMultipartUploadInput) (*s3.AbortMultipartUploadOutput, error) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	if _, ok := api.uploads[aws.StringValue(input.UploadId)]; !ok {
+		return nil, noSuchUpload(input.UploadId)
+	}
+	delete(api.uploads, aws.StringValue(input.UploadId))
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// listMultipartUploads lists the in-progress multipart uploads in the order
+// of the keys and the upload IDs. The listing is not paginated.
+func (api *API) listMultipartUploads(input *s3.ListMultipartUploadsInput) (*s3.ListMultipartUploadsOutput, error) {
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	output := &s3.ListMultipartUploadsOutput{
+		Bucket:      input.Bucket,
+		Prefix:      input.Prefix,
+		IsTruncated: aws.Bool(false),
+	}
+	for id, u := range api.uploads {
+		if u.bucket != aws.StringValue(input.Bucket) || !strings.HasPrefix(u.key, aws.StringValue(input.Prefix)) {
+			continue
+		}
+		output.Uploads = append(output.Uploads, &s3.MultipartUpload{
+			Key:          aws.String(u.key),
+			UploadId:     aws.String(id),
+			Initiated:    aws.Time(u.initiated),
+			StorageClass: u.attrs.storageClass(),
+		})
+	}
+	sort.Slice(output.Uploads, func(i, j int) bool {
+		ui, uj := output.Uploads[i], output.Uploads[j]
+		if *ui.Key != *uj.Key {
+			return *ui.Key < *uj.Key
+		}
+		return *ui.UploadId < *uj.UploadId
+	})
+	return output, nil
+}
+
+func (api *API) uploadPartCopy(input *s3.UploadPartCopyInput) (*s3.UploadPartCopyOutput, error) {
+	srcName, srcVersionID, err := copySourceName(input.CopySource)
+	if err != nil {
+		return nil, err
+	}
+	p, _, err := api.readObject(srcName, srcVersionID)
+	if err != nil {
+		return nil, err
+	}
+	if input.CopySourceRange != nil {
+		start, end, err := parseRange(aws.StringValue(input.CopySourceRange), int64(len(p)))
+		if err != nil {
+			return nil, err
+		}
+		p = p[start : end+1]
+	}
+	api.mutex.Lock()
+	defer api.mutex.Unlock()
+	upload, ok := api.uploads[aws.StringValue(input.UploadId)]
+	if !ok {
+		return nil, noSuchUpload(input.UploadId)
+	}
+	upload.parts[aws.Int64Value(input.PartNumber)] = p
+	return &s3.UploadPartCopyOutput{
+		CopyPartResult: &s3.CopyPartResult{
+			ETag: aws.String(etag(p)),
+		},
+	}, nil
+}
@@ -0,0 +1,1068 @@
+package s3fs
+
+import (
+	"bufio"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/s3fs/s3fake"
+	"github.com/jarxorg/wfs"
+)
+
+const (
+	s3XMLNamespace    = "http://s3.amazonaws.com/doc/2006-03-01/"
+	s3TimeFormat      = "2006-01-02T15:04:05.000Z"
+	metadataHeader    = "X-Amz-Meta-"
+	errCodeNoSuchBkt  = "NoSuchBucket"
+	defaultObjectType = "binary/octet-stream"
+)
+
+// Handler is an http.Handler that serves the S3 REST API on a filesystem.
+// Each directory at the root of the filesystem is served as a bucket. The
+// filesystem should implement the interfaces of wfs to write objects.
+//
+// Handler supports the path-style requests such as "http://host/bucket/key"
+// and the virtual-hosted-style requests such as "http://bucket.domain/key" if
+// Domain is set.
+type Handler struct {
+	// Domain is the domain of the virtual-hosted-style requests such as
+	// "s3.localhost". If Domain is empty then only the path-style requests are
+	// served.
+	Domain string
+	// Credentials is the secret access keys by the access key IDs. If
+	// Credentials is not empty then the requests must be signed by AWS
+	// Signature Version 4.
+	Credentials map[string]string
+	fsys        fs.FS
+	api         *s3fake.API
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// NewHandler returns a Handler that serves the S3 REST API on the filesystem.
+func NewHandler(fsys fs.FS) *Handler {
+	return &Handler{
+		fsys: fsys,
+		api:  s3fake.New(fsys),
+	}
+}
+
+// API returns the fake of the S3 API that serves the requests. The faults
+// that are injected into the API are applied to the requests.
+func (h *Handler) API() *s3fake.API {
+	return h.api
+}
+
+// EnableVersioning enables versioning of all buckets. The versions are kept in
+// memory.
+func (h *Handler) EnableVersioning() error {
+	return h.api.EnableVersioning()
+}
+
+// errorStatus returns the HTTP status code of the error code.
+func errorStatus(code string) int {
+	switch code {
+	case s3.ErrCodeNoSuchKey, errCodeNotFound, errCodeNoSuchBkt, s3.ErrCodeNoSuchUpload, "NoSuchVersion":
+		return http.StatusNotFound
+	case "InvalidRange":
+		return http.StatusRequestedRangeNotSatisfiable
+	case errCodeAccessDenied, "InvalidAccessKeyId", "SignatureDoesNotMatch", "RequestTimeTooSkewed":
+		return http.StatusForbidden
+	case "MethodNotAllowed":
+		return http.StatusMethodNotAllowed
+	case "BucketNotEmpty", "BucketAlreadyOwnedByYou", "ConditionalRequestConflict":
+		return http.StatusConflict
+	case "PreconditionFailed":
+		return http.StatusPreconditionFailed
+	case "NotModified":
+		return http.StatusNotModified
+	case "NotImplemented":
+		return http.StatusNotImplemented
+	case "InternalError":
+		return http.StatusInternalServerError
+	}
+	return http.StatusBadRequest
+}
+
+type xmlError struct {
+	XMLName  xml.Name `xml:"Error"`
+	Code     string
+	Message  string
+	Resource string
+}
+
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := "InternalError", err.Error()
+	var awsErr awserr.Error
+	if errors.As(err, &awsErr) {
+		code, message = awsErr.Code(), awsErr.Message()
+	} else if isNotExist(err) {
+		code = s3.ErrCodeNoSuchKey
+	}
+	status := errorStatus(code)
+	if r.Method == http.MethodHead || status == http.StatusNotModified {
+		w.WriteHeader(status)
+		return
+	}
+	h.writeXML(w, status, &xmlError{
+		Code:     code,
+		Message:  message,
+		Resource: r.URL.Path,
+	})
+}
+
+func (h *Handler) writeXML(w http.ResponseWriter, status int, v interface{}) {
+	p, err := xml.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	w.Write([]byte(xml.Header))
+	w.Write(p)
+}
+
+func notImplemented() error {
+	return awserr.New("NotImplemented", "the requested operation is not implemented", nil)
+}
+
+func methodNotAllowed() error {
+	return awserr.New("MethodNotAllowed", "the specified method is not allowed against this resource", nil)
+}
+
+// bucketAndKey returns the bucket and the key of the request.
+func (h *Handler) bucketAndKey(r *http.Request) (string, string) {
+	p := strings.TrimPrefix(r.URL.Path, "/")
+	if h.Domain != "" {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(host); err == nil {
+			host = hostname
+		}
+		if bucket := strings.TrimSuffix(host, "."+h.Domain); bucket != host {
+			return bucket, p
+		}
+	}
+	bucket, key, _ := strings.Cut(p, "/")
+	return bucket, key
+}
+
+// ServeHTTP serves the S3 REST API.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if len(h.Credentials) > 0 {
+		if err := verifySigV4(r, h.Credentials); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	}
+	if isAWSChunked(r) {
+		r.Body = io.NopCloser(newAWSChunkedReader(r.Body))
+	}
+	bucket, key := h.bucketAndKey(r)
+	if bucket == "" {
+		if r.Method != http.MethodGet {
+			h.writeError(w, r, methodNotAllowed())
+			return
+		}
+		h.listBuckets(w, r)
+		return
+	}
+	// NOTE: The key is validated before it is joined with the bucket, so the
+	// key such as "../other/x" does not escape the bucket. The keys of the
+	// directory markers end with a slash.
+	if !fs.ValidPath(bucket) || strings.Contains(bucket, "/") || (key != "" && !fs.ValidPath(strings.TrimSuffix(key, "/"))) {
+		h.writeError(w, r, awserr.New("InvalidArgument", "invalid bucket or key", nil))
+		return
+	}
+	if key == "" {
+		h.serveBucket(w, r, bucket)
+		return
+	}
+	if err := h.checkBucket(bucket); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.serveObject(w, r, bucket, key)
+}
+
+func (h *Handler) checkBucket(bucket string) error {
+	info, err := fs.Stat(h.fsys, bucket)
+	if err != nil || !info.IsDir() {
+		return awserr.New(errCodeNoSuchBkt, "the specified bucket does not exist", nil)
+	}
+	return nil
+}
+
+type xmlBucket struct {
+	Name         string
+	CreationDate string
+}
+
+type xmlListAllMyBucketsResult struct {
+	XMLName xml.Name    `xml:"ListAllMyBucketsResult"`
+	Xmlns   string      `xml:"xmlns,attr"`
+	Buckets []xmlBucket `xml:"Buckets>Bucket"`
+}
+
+func (h *Handler) listBuckets(w http.ResponseWriter, r *http.Request) {
+	entries, err := fs.ReadDir(h.fsys, ".")
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	result := &xmlListAllMyBucketsResult{Xmlns: s3XMLNamespace}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		result.Buckets = append(result.Buckets, xmlBucket{
+			Name:         entry.Name(),
+			CreationDate: info.ModTime().UTC().Format(s3TimeFormat),
+		})
+	}
+	h.writeXML(w, http.StatusOK, result)
+}
+
+func (h *Handler) serveBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	if r.Method == http.MethodPut && !query.Has("versioning") {
+		h.createBucket(w, r, bucket)
+		return
+	}
+	if err := h.checkBucket(bucket); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	switch r.Method {
+	case http.MethodHead:
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet:
+		switch {
+		case query.Has("versioning"):
+			h.getBucketVersioning(w, r)
+		case query.Has("versions"):
+			h.listObjectVersions(w, r, bucket)
+		case query.Has("location"):
+			h.writeXML(w, http.StatusOK, &struct {
+				XMLName xml.Name `xml:"LocationConstraint"`
+				Xmlns   string   `xml:"xmlns,attr"`
+			}{Xmlns: s3XMLNamespace})
+		default:
+			h.listObjects(w, r, bucket)
+		}
+	case http.MethodPut:
+		h.putBucketVersioning(w, r)
+	case http.MethodPost:
+		if !query.Has("delete") {
+			h.writeError(w, r, notImplemented())
+			return
+		}
+		h.deleteObjects(w, r, bucket)
+	case http.MethodDelete:
+		h.deleteBucket(w, r, bucket)
+	default:
+		h.writeError(w, r, methodNotAllowed())
+	}
+}
+
+func (h *Handler) createBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	if err := h.checkBucket(bucket); err == nil {
+		h.writeError(w, r, awserr.New("BucketAlreadyOwnedByYou", "the bucket already exists", nil))
+		return
+	}
+	if err := wfs.MkdirAll(h.fsys, bucket, fs.ModePerm); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", "/"+bucket)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (h *Handler) deleteBucket(w http.ResponseWriter, r *http.Request, bucket string) {
+	entries, err := fs.ReadDir(h.fsys, bucket)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if len(entries) > 0 {
+		h.writeError(w, r, awserr.New("BucketNotEmpty", "the bucket is not empty", nil))
+		return
+	}
+	if err := wfs.RemoveAll(h.fsys, bucket); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type xmlVersioningConfiguration struct {
+	XMLName xml.Name `xml:"VersioningConfiguration"`
+	Xmlns   string   `xml:"xmlns,attr,omitempty"`
+	Status  string   `xml:",omitempty"`
+}
+
+func (h *Handler) getBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	config := &xmlVersioningConfiguration{Xmlns: s3XMLNamespace}
+	if h.api.IsVersioned() {
+		config.Status = s3.BucketVersioningStatusEnabled
+	}
+	h.writeXML(w, http.StatusOK, config)
+}
+
+func (h *Handler) putBucketVersioning(w http.ResponseWriter, r *http.Request) {
+	config := &xmlVersioningConfiguration{}
+	if err := xml.NewDecoder(r.Body).Decode(config); err != nil {
+		h.writeError(w, r, awserr.New("MalformedXML", err.Error(), nil))
+		return
+	}
+	// NOTE: Versioning can not be suspended.
+	if config.Status != s3.BucketVersioningStatusEnabled {
+		h.writeError(w, r, notImplemented())
+		return
+	}
+	if err := h.EnableVersioning(); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func formatTime(t *time.Time) string {
+	return aws.TimeValue(t).UTC().Format(s3TimeFormat)
+}
+
+type xmlObject struct {
+	Key          string
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type xmlCommonPrefix struct {
+	Prefix string
+}
+
+type xmlListBucketResult struct {
+	XMLName               xml.Name `xml:"ListBucketResult"`
+	Xmlns                 string   `xml:"xmlns,attr"`
+	Name                  string
+	Prefix                string
+	Delimiter             string `xml:",omitempty"`
+	MaxKeys               int64
+	EncodingType          string `xml:",omitempty"`
+	IsTruncated           bool
+	Marker                string            `xml:",omitempty"`
+	NextMarker            string            `xml:",omitempty"`
+	ContinuationToken     string            `xml:",omitempty"`
+	NextContinuationToken string            `xml:",omitempty"`
+	StartAfter            string            `xml:",omitempty"`
+	KeyCount              int64             `xml:",omitempty"`
+	Contents              []xmlObject       `xml:"Contents"`
+	CommonPrefixes        []xmlCommonPrefix `xml:"CommonPrefixes"`
+}
+
+// parseMaxKeys parses the max-keys parameter. parseMaxKeys returns nil if the
+// parameter is empty.
+func parseMaxKeys(query url.Values) (*int64, error) {
+	maxKeys := query.Get("max-keys")
+	if maxKeys == "" {
+		return nil, nil
+	}
+	n, err := strconv.ParseInt(maxKeys, 10, 64)
+	if err != nil || n < 0 {
+		return nil, awserr.New("InvalidArgument", "invalid max-keys", nil)
+	}
+	return aws.Int64(n), nil
+}
+
+// listBucketResult returns the result of ListObjects and ListObjectsV2.
+func listBucketResult(contents []*s3.Object, prefixes []*s3.CommonPrefix) *xmlListBucketResult {
+	result := &xmlListBucketResult{Xmlns: s3XMLNamespace}
+	for _, o := range contents {
+		result.Contents = append(result.Contents, xmlObject{
+			Key:          aws.StringValue(o.Key),
+			LastModified: formatTime(o.LastModified),
+			ETag:         aws.StringValue(o.ETag),
+			Size:         aws.Int64Value(o.Size),
+			StorageClass: aws.StringValue(o.StorageClass),
+		})
+	}
+	for _, p := range prefixes {
+		result.CommonPrefixes = append(result.CommonPrefixes, xmlCommonPrefix{
+			Prefix: aws.StringValue(p.Prefix),
+		})
+	}
+	return result
+}
+
+// listObjects serves ListObjects and ListObjectsV2.
+func (h *Handler) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	maxKeys, err := parseMaxKeys(query)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if aws.Int64Value(maxKeys) == 0 && maxKeys != nil {
+		// NOTE: The fake lists the default number of the keys if MaxKeys is 0.
+		h.writeXML(w, http.StatusOK, &xmlListBucketResult{
+			Xmlns:  s3XMLNamespace,
+			Name:   bucket,
+			Prefix: query.Get("prefix"),
+		})
+		return
+	}
+	if query.Get("list-type") != "2" {
+		output, err := h.api.ListObjectsWithContext(r.Context(), &s3.ListObjectsInput{
+			Bucket:       aws.String(bucket),
+			Prefix:       aws.String(query.Get("prefix")),
+			Delimiter:    stringPtr(query.Get("delimiter")),
+			Marker:       stringPtr(query.Get("marker")),
+			EncodingType: stringPtr(query.Get("encoding-type")),
+			MaxKeys:      maxKeys,
+		})
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		result := listBucketResult(output.Contents, output.CommonPrefixes)
+		result.Name = bucket
+		result.Prefix = aws.StringValue(output.Prefix)
+		result.Delimiter = aws.StringValue(output.Delimiter)
+		result.MaxKeys = aws.Int64Value(output.MaxKeys)
+		result.EncodingType = aws.StringValue(output.EncodingType)
+		result.IsTruncated = aws.BoolValue(output.IsTruncated)
+		result.Marker = aws.StringValue(output.Marker)
+		result.NextMarker = aws.StringValue(output.NextMarker)
+		h.writeXML(w, http.StatusOK, result)
+		return
+	}
+	output, err := h.api.ListObjectsV2WithContext(r.Context(), &s3.ListObjectsV2Input{
+		Bucket:            aws.String(bucket),
+		Prefix:            aws.String(query.Get("prefix")),
+		Delimiter:         stringPtr(query.Get("delimiter")),
+		StartAfter:        stringPtr(query.Get("start-after")),
+		ContinuationToken: stringPtr(query.Get("continuation-token")),
+		EncodingType:      stringPtr(query.Get("encoding-type")),
+		MaxKeys:           maxKeys,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	result := listBucketResult(output.Contents, output.CommonPrefixes)
+	result.Name = bucket
+	result.Prefix = aws.StringValue(output.Prefix)
+	result.Delimiter = aws.StringValue(output.Delimiter)
+	result.MaxKeys = aws.Int64Value(output.MaxKeys)
+	result.EncodingType = aws.StringValue(output.EncodingType)
+	result.IsTruncated = aws.BoolValue(output.IsTruncated)
+	result.ContinuationToken = aws.StringValue(output.ContinuationToken)
+	result.NextContinuationToken = aws.StringValue(output.NextContinuationToken)
+	result.StartAfter = aws.StringValue(output.StartAfter)
+	result.KeyCount = aws.Int64Value(output.KeyCount)
+	h.writeXML(w, http.StatusOK, result)
+}
+
+type xmlVersion struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+	ETag         string
+	Size         int64
+	StorageClass string
+}
+
+type xmlDeleteMarker struct {
+	Key          string
+	VersionId    string
+	IsLatest     bool
+	LastModified string
+}
+
+type xmlListVersionsResult struct {
+	XMLName             xml.Name `xml:"ListVersionsResult"`
+	Xmlns               string   `xml:"xmlns,attr"`
+	Name                string
+	Prefix              string
+	KeyMarker           string
+	VersionIdMarker     string
+	NextKeyMarker       string `xml:",omitempty"`
+	NextVersionIdMarker string `xml:",omitempty"`
+	MaxKeys             int64
+	EncodingType        string `xml:",omitempty"`
+	IsTruncated         bool
+	Versions            []xmlVersion      `xml:"Version"`
+	DeleteMarkers       []xmlDeleteMarker `xml:"DeleteMarker"`
+}
+
+func (h *Handler) listObjectVersions(w http.ResponseWriter, r *http.Request, bucket string) {
+	query := r.URL.Query()
+	maxKeys, err := parseMaxKeys(query)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	output, err := h.api.ListObjectVersionsWithContext(r.Context(), &s3.ListObjectVersionsInput{
+		Bucket:          aws.String(bucket),
+		Prefix:          aws.String(query.Get("prefix")),
+		KeyMarker:       stringPtr(query.Get("key-marker")),
+		VersionIdMarker: stringPtr(query.Get("version-id-marker")),
+		EncodingType:    stringPtr(query.Get("encoding-type")),
+		MaxKeys:         maxKeys,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	result := &xmlListVersionsResult{
+		Xmlns:               s3XMLNamespace,
+		Name:                bucket,
+		Prefix:              aws.StringValue(output.Prefix),
+		KeyMarker:           aws.StringValue(output.KeyMarker),
+		VersionIdMarker:     aws.StringValue(output.VersionIdMarker),
+		NextKeyMarker:       aws.StringValue(output.NextKeyMarker),
+		NextVersionIdMarker: aws.StringValue(output.NextVersionIdMarker),
+		MaxKeys:             aws.Int64Value(output.MaxKeys),
+		EncodingType:        aws.StringValue(output.EncodingType),
+		IsTruncated:         aws.BoolValue(output.IsTruncated),
+	}
+	for _, v := range output.Versions {
+		result.Versions = append(result.Versions, xmlVersion{
+			Key:          aws.StringValue(v.Key),
+			VersionId:    aws.StringValue(v.VersionId),
+			IsLatest:     aws.BoolValue(v.IsLatest),
+			LastModified: formatTime(v.LastModified),
+			ETag:         aws.StringValue(v.ETag),
+			Size:         aws.Int64Value(v.Size),
+			StorageClass: aws.StringValue(v.StorageClass),
+		})
+	}
+	for _, m := range output.DeleteMarkers {
+		result.DeleteMarkers = append(result.DeleteMarkers, xmlDeleteMarker{
+			Key:          aws.StringValue(m.Key),
+			VersionId:    aws.StringValue(m.VersionId),
+			IsLatest:     aws.BoolValue(m.IsLatest),
+			LastModified: formatTime(m.LastModified),
+		})
+	}
+	h.writeXML(w, http.StatusOK, result)
+}
+
+type xmlDelete struct {
+	Quiet   bool
+	Objects []struct {
+		Key       string
+		VersionId string
+	} `xml:"Object"`
+}
+
+type xmlDeleted struct {
+	Key                   string
+	VersionId             string `xml:",omitempty"`
+	DeleteMarker          bool   `xml:",omitempty"`
+	DeleteMarkerVersionId string `xml:",omitempty"`
+}
+
+type xmlDeleteError struct {
+	Key       string
+	VersionId string `xml:",omitempty"`
+	Code      string
+	Message   string
+}
+
+type xmlDeleteResult struct {
+	XMLName xml.Name         `xml:"DeleteResult"`
+	Xmlns   string           `xml:"xmlns,attr"`
+	Deleted []xmlDeleted     `xml:"Deleted"`
+	Errors  []xmlDeleteError `xml:"Error"`
+}
+
+func (h *Handler) deleteObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	del := &xmlDelete{}
+	if err := xml.NewDecoder(r.Body).Decode(del); err != nil {
+		h.writeError(w, r, awserr.New("MalformedXML", err.Error(), nil))
+		return
+	}
+	input := &s3.DeleteObjectsInput{
+		Bucket: aws.String(bucket),
+		Delete: &s3.Delete{Quiet: aws.Bool(del.Quiet)},
+	}
+	for _, o := range del.Objects {
+		input.Delete.Objects = append(input.Delete.Objects, &s3.ObjectIdentifier{
+			Key:       aws.String(o.Key),
+			VersionId: stringPtr(o.VersionId),
+		})
+	}
+	output, err := h.api.DeleteObjectsWithContext(r.Context(), input)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	result := &xmlDeleteResult{Xmlns: s3XMLNamespace}
+	for _, d := range output.Deleted {
+		result.Deleted = append(result.Deleted, xmlDeleted{
+			Key:                   aws.StringValue(d.Key),
+			VersionId:             aws.StringValue(d.VersionId),
+			DeleteMarker:          aws.BoolValue(d.DeleteMarker),
+			DeleteMarkerVersionId: aws.StringValue(d.DeleteMarkerVersionId),
+		})
+	}
+	for _, e := range output.Errors {
+		result.Errors = append(result.Errors, xmlDeleteError{
+			Key:       aws.StringValue(e.Key),
+			VersionId: aws.StringValue(e.VersionId),
+			Code:      aws.StringValue(e.Code),
+			Message:   aws.StringValue(e.Message),
+		})
+	}
+	h.writeXML(w, http.StatusOK, result)
+}
+
+func (h *Handler) serveObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	query := r.URL.Query()
+	switch r.Method {
+	case http.MethodGet:
+		h.getObject(w, r, bucket, key)
+	case http.MethodHead:
+		h.headObject(w, r, bucket, key)
+	case http.MethodPut:
+		switch {
+		case query.Has("uploadId"):
+			h.uploadPart(w, r, bucket, key)
+		case r.Header.Get("X-Amz-Copy-Source") != "":
+			h.copyObject(w, r, bucket, key)
+		default:
+			h.putObject(w, r, bucket, key)
+		}
+	case http.MethodPost:
+		switch {
+		case query.Has("uploads"):
+			h.createMultipartUpload(w, r, bucket, key)
+		case query.Has("uploadId"):
+			h.completeMultipartUpload(w, r, bucket, key)
+		default:
+			h.writeError(w, r, notImplemented())
+		}
+	case http.MethodDelete:
+		if query.Has("uploadId") {
+			h.abortMultipartUpload(w, r, bucket, key)
+			return
+		}
+		h.deleteObject(w, r, bucket, key)
+	default:
+		h.writeError(w, r, methodNotAllowed())
+	}
+}
+
+// setHeader sets the header if the value is not empty.
+func setHeader(w http.ResponseWriter, name string, value *string) {
+	if v := aws.StringValue(value); v != "" {
+		w.Header().Set(name, v)
+	}
+}
+
+// writeObjectHeader writes the headers of the object.
+func writeObjectHeader(w http.ResponseWriter, o *s3.GetObjectOutput) {
+	contentType := aws.StringValue(o.ContentType)
+	if contentType == "" {
+		contentType = defaultObjectType
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(aws.Int64Value(o.ContentLength), 10))
+	w.Header().Set("Last-Modified", aws.TimeValue(o.LastModified).UTC().Format(http.TimeFormat))
+	w.Header().Set("Accept-Ranges", "bytes")
+	setHeader(w, "ETag", o.ETag)
+	setHeader(w, "Content-Range", o.ContentRange)
+	setHeader(w, "Content-Encoding", o.ContentEncoding)
+	setHeader(w, "Cache-Control", o.CacheControl)
+	setHeader(w, "X-Amz-Version-Id", o.VersionId)
+	setHeader(w, "X-Amz-Server-Side-Encryption", o.ServerSideEncryption)
+	setHeader(w, "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id", o.SSEKMSKeyId)
+	if c := aws.StringValue(o.StorageClass); c != "" && c != s3.StorageClassStandard {
+		w.Header().Set("X-Amz-Storage-Class", c)
+	}
+	if n := aws.Int64Value(o.TagCount); n > 0 {
+		w.Header().Set("X-Amz-Tagging-Count", strconv.FormatInt(n, 10))
+	}
+	for k, v := range o.Metadata {
+		w.Header().Set(metadataHeader+k, aws.StringValue(v))
+	}
+}
+
+func (h *Handler) getObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	input := &s3.GetObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		VersionId:   stringPtr(r.URL.Query().Get("versionId")),
+		Range:       stringPtr(r.Header.Get("Range")),
+		IfMatch:     stringPtr(r.Header.Get("If-Match")),
+		IfNoneMatch: stringPtr(r.Header.Get("If-None-Match")),
+	}
+	output, err := h.api.GetObjectWithContext(r.Context(), input)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	defer output.Body.Close()
+	writeObjectHeader(w, output)
+	status := http.StatusOK
+	if output.ContentRange != nil {
+		status = http.StatusPartialContent
+	}
+	w.WriteHeader(status)
+	io.Copy(w, output.Body)
+}
+
+func (h *Handler) headObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	input := &s3.HeadObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		VersionId:   stringPtr(r.URL.Query().Get("versionId")),
+		IfMatch:     stringPtr(r.Header.Get("If-Match")),
+		IfNoneMatch: stringPtr(r.Header.Get("If-None-Match")),
+	}
+	o, err := h.api.HeadObjectWithContext(r.Context(), input)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	writeObjectHeader(w, &s3.GetObjectOutput{
+		CacheControl:         o.CacheControl,
+		ContentEncoding:      o.ContentEncoding,
+		ContentLength:        o.ContentLength,
+		ContentType:          o.ContentType,
+		ETag:                 o.ETag,
+		LastModified:         o.LastModified,
+		Metadata:             o.Metadata,
+		SSEKMSKeyId:          o.SSEKMSKeyId,
+		ServerSideEncryption: o.ServerSideEncryption,
+		StorageClass:         o.StorageClass,
+		VersionId:            o.VersionId,
+	})
+	w.WriteHeader(http.StatusOK)
+}
+
+// requestMetadata returns the user-defined metadata of the request headers.
+func requestMetadata(r *http.Request) map[string]*string {
+	var metadata map[string]*string
+	for k, v := range r.Header {
+		if !strings.HasPrefix(k, metadataHeader) || len(v) == 0 {
+			continue
+		}
+		if metadata == nil {
+			metadata = map[string]*string{}
+		}
+		metadata[strings.ToLower(strings.TrimPrefix(k, metadataHeader))] = aws.String(v[0])
+	}
+	return metadata
+}
+
+// requestPutObjectInput returns the input of PutObject of the request headers.
+func requestPutObjectInput(r *http.Request, bucket, key string) *s3.PutObjectInput {
+	header := func(name string) *string {
+		return stringPtr(r.Header.Get(name))
+	}
+	return &s3.PutObjectInput{
+		Bucket:               aws.String(bucket),
+		Key:                  aws.String(key),
+		ContentType:          header("Content-Type"),
+		ContentEncoding:      stringPtr(strings.TrimPrefix(strings.TrimPrefix(r.Header.Get("Content-Encoding"), "aws-chunked"), ",")),
+		CacheControl:         header("Cache-Control"),
+		Metadata:             requestMetadata(r),
+		StorageClass:         header("X-Amz-Storage-Class"),
+		ServerSideEncryption: header("X-Amz-Server-Side-Encryption"),
+		SSEKMSKeyId:          header("X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id"),
+		Tagging:              header("X-Amz-Tagging"),
+		ACL:                  header("X-Amz-Acl"),
+	}
+}
+
+// requestConditions returns the request options that pass the If-Match and
+// If-None-Match headers of the write request to the API.
+func requestConditions(r *http.Request) []request.Option {
+	header := map[string]string{}
+	for _, name := range []string{"If-Match", "If-None-Match"} {
+		if v := r.Header.Get(name); v != "" {
+			header[name] = v
+		}
+	}
+	if len(header) == 0 {
+		return nil
+	}
+	return []request.Option{request.WithSetRequestHeaders(header)}
+}
+
+func (h *Handler) putObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	input := requestPutObjectInput(r, bucket, key)
+	input.Body = aws.ReadSeekCloser(r.Body)
+	output, err := h.api.PutObjectWithContext(r.Context(), input, requestConditions(r)...)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setHeader(w, "ETag", output.ETag)
+	setHeader(w, "X-Amz-Version-Id", output.VersionId)
+	w.WriteHeader(http.StatusOK)
+}
+
+type xmlCopyObjectResult struct {
+	XMLName      xml.Name
+	Xmlns        string `xml:"xmlns,attr"`
+	ETag         string
+	LastModified string
+}
+
+func (h *Handler) copyObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	output, err := h.api.CopyObjectWithContext(r.Context(), &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(r.Header.Get("X-Amz-Copy-Source")),
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setHeader(w, "X-Amz-Version-Id", output.VersionId)
+	setHeader(w, "X-Amz-Copy-Source-Version-Id", output.CopySourceVersionId)
+	h.writeXML(w, http.StatusOK, &xmlCopyObjectResult{
+		XMLName:      xml.Name{Local: "CopyObjectResult"},
+		Xmlns:        s3XMLNamespace,
+		ETag:         aws.StringValue(output.CopyObjectResult.ETag),
+		LastModified: formatTime(output.CopyObjectResult.LastModified),
+	})
+}
+
+func (h *Handler) deleteObject(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	output, err := h.api.DeleteObjectWithContext(r.Context(), &s3.DeleteObjectInput{
+		Bucket:    aws.String(bucket),
+		Key:       aws.String(key),
+		VersionId: stringPtr(r.URL.Query().Get("versionId")),
+	})
+	if err != nil && !isS3NoSuchKey(err) {
+		h.writeError(w, r, err)
+		return
+	}
+	if output != nil {
+		setHeader(w, "X-Amz-Version-Id", output.VersionId)
+		if aws.BoolValue(output.DeleteMarker) {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type xmlInitiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Xmlns    string   `xml:"xmlns,attr"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+func (h *Handler) createMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	a := requestPutObjectInput(r, bucket, key)
+	output, err := h.api.CreateMultipartUploadWithContext(r.Context(), &s3.CreateMultipartUploadInput{
+		Bucket:               a.Bucket,
+		Key:                  a.Key,
+		ContentType:          a.ContentType,
+		ContentEncoding:      a.ContentEncoding,
+		CacheControl:         a.CacheControl,
+		Metadata:             a.Metadata,
+		StorageClass:         a.StorageClass,
+		ServerSideEncryption: a.ServerSideEncryption,
+		SSEKMSKeyId:          a.SSEKMSKeyId,
+		Tagging:              a.Tagging,
+		ACL:                  a.ACL,
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.writeXML(w, http.StatusOK, &xmlInitiateMultipartUploadResult{
+		Xmlns:    s3XMLNamespace,
+		Bucket:   bucket,
+		Key:      key,
+		UploadId: aws.StringValue(output.UploadId),
+	})
+}
+
+func (h *Handler) uploadPart(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	query := r.URL.Query()
+	partNumber, err := strconv.ParseInt(query.Get("partNumber"), 10, 64)
+	if err != nil || partNumber < 1 || partNumber > maxUploadParts {
+		h.writeError(w, r, awserr.New("InvalidArgument", "invalid partNumber", nil))
+		return
+	}
+	if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+		output, err := h.api.UploadPartCopyWithContext(r.Context(), &s3.UploadPartCopyInput{
+			Bucket:          aws.String(bucket),
+			Key:             aws.String(key),
+			UploadId:        aws.String(query.Get("uploadId")),
+			PartNumber:      aws.Int64(partNumber),
+			CopySource:      aws.String(source),
+			CopySourceRange: stringPtr(r.Header.Get("X-Amz-Copy-Source-Range")),
+		})
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+		h.writeXML(w, http.StatusOK, &xmlCopyObjectResult{
+			XMLName:      xml.Name{Local: "CopyPartResult"},
+			Xmlns:        s3XMLNamespace,
+			ETag:         aws.StringValue(output.CopyPartResult.ETag),
+			LastModified: time.Now().UTC().Format(s3TimeFormat),
+		})
+		return
+	}
+	output, err := h.api.UploadPartWithContext(r.Context(), &s3.UploadPartInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		UploadId:   aws.String(query.Get("uploadId")),
+		PartNumber: aws.Int64(partNumber),
+		Body:       aws.ReadSeekCloser(r.Body),
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setHeader(w, "ETag", output.ETag)
+	w.WriteHeader(http.StatusOK)
+}
+
+type xmlCompleteMultipartUpload struct {
+	Parts []struct {
+		PartNumber int64
+		ETag       string
+	} `xml:"Part"`
+}
+
+type xmlCompleteMultipartUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Bucket  string
+	Key     string
+	ETag    string
+}
+
+func (h *Handler) completeMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	complete := &xmlCompleteMultipartUpload{}
+	if err := xml.NewDecoder(r.Body).Decode(complete); err != nil {
+		h.writeError(w, r, awserr.New("MalformedXML", err.Error(), nil))
+		return
+	}
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(r.URL.Query().Get("uploadId")),
+		MultipartUpload: &s3.CompletedMultipartUpload{},
+	}
+	for _, part := range complete.Parts {
+		input.MultipartUpload.Parts = append(input.MultipartUpload.Parts, &s3.CompletedPart{
+			PartNumber: aws.Int64(part.PartNumber),
+			ETag:       aws.String(part.ETag),
+		})
+	}
+	output, err := h.api.CompleteMultipartUploadWithContext(r.Context(), input, requestConditions(r)...)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	setHeader(w, "X-Amz-Version-Id", output.VersionId)
+	h.writeXML(w, http.StatusOK, &xmlCompleteMultipartUploadResult{
+		Xmlns:  s3XMLNamespace,
+		Bucket: bucket,
+		Key:    key,
+		ETag:   aws.StringValue(output.ETag),
+	})
+}
+
+func (h *Handler) abortMultipartUpload(w http.ResponseWriter, r *http.Request, bucket, key string) {
+	_, err := h.api.AbortMultipartUploadWithContext(r.Context(), &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(r.URL.Query().Get("uploadId")),
+	})
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// isAWSChunked returns true if the body of the request is encoded by the
+// aws-chunked content encoding of streaming uploads.
+func isAWSChunked(r *http.Request) bool {
+	return strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), streamingPayload) ||
+		strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked")
+}
+
+// awsChunkedReader decodes the aws-chunked content encoding such as
+// "<hex-size>;chunk-signature=<signature>\r\n<data>\r\n...0\r\n<trailers>\r\n".
+// The signatures and the trailing checksums are ignored.
+type awsChunkedReader struct {
+	r         *bufio.Reader
+	remaining int64
+	eof       bool
+}
+
+func newAWSChunkedReader(r io.Reader) *awsChunkedReader {
+	return &awsChunkedReader{r: bufio.NewReader(r)}
+}
+
+func (c *awsChunkedReader) Read(p []byte) (int, error) {
+	for c.remaining == 0 {
+		if c.eof {
+			return 0, io.EOF
+		}
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return 0, io.ErrUnexpectedEOF
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			// NOTE: The CRLF after the data of the previous chunk.
+			continue
+		}
+		sizeHex, _, _ := strings.Cut(line, ";")
+		size, err := strconv.ParseInt(sizeHex, 16, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid aws-chunked size %q", sizeHex)
+		}
+		if size == 0 {
+			c.eof = true
+			io.Copy(io.Discard, c.r)
+			return 0, io.EOF
+		}
+		c.remaining = size
+	}
+	if int64(len(p)) > c.remaining {
+		p = p[:c.remaining]
+	}
+	n, err := c.r.Read(p)
+	c.remaining -= int64(n)
+	if err == io.EOF && c.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
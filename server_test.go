@@ -0,0 +1,569 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	v4 "github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/wfs"
+	"github.com/jarxorg/wfs/osfs"
+	"github.com/jarxorg/wfs/wfstest"
+)
+
+const (
+	testAccessKeyID     = "AKIDTEST"
+	testSecretAccessKey = "SECRETTEST"
+)
+
+func newServerTesting(t *testing.T) (*httptest.Server, *Handler) {
+	h := NewHandler(newMemFSTesting(t))
+	h.Credentials = map[string]string{testAccessKeyID: testSecretAccessKey}
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return ts, h
+}
+
+func newServerClient(t *testing.T, endpoint, accessKeyID, secretAccessKey string) *s3.S3 {
+	sess, err := session.NewSession(&aws.Config{
+		Credentials:      credentials.NewStaticCredentials(accessKeyID, secretAccessKey, ""),
+		Endpoint:         aws.String(endpoint),
+		Region:           aws.String("us-east-1"),
+		S3ForcePathStyle: aws.Bool(true),
+		MaxRetries:       aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s3.New(sess)
+}
+
+func newServerFSTesting(t *testing.T) (*S3FS, *s3.S3) {
+	ts, _ := newServerTesting(t)
+	client := newServerClient(t, ts.URL, testAccessKeyID, testSecretAccessKey)
+	return NewWithAPI("testdata", client), client
+}
+
+func TestHandler_FS(t *testing.T) {
+	fsys, _ := newServerFSTesting(t)
+	if err := fstest.TestFS(fsys, "dir0", "dir0/file01.txt"); err != nil {
+		t.Errorf("Error testing/fstest: %+v", err)
+	}
+}
+
+func TestHandler_WriteFileFS(t *testing.T) {
+	fsys, _ := newServerFSTesting(t)
+	tmpDir := "test"
+	if err := wfs.MkdirAll(fsys, tmpDir, fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := wfstest.TestWriteFileFS(fsys, tmpDir); err != nil {
+		t.Errorf("Error wfstest: %+v", err)
+	}
+}
+
+func TestHandler_Multipart(t *testing.T) {
+	orig := maxCopyObjectSize
+	defer func() { maxCopyObjectSize = orig }()
+	maxCopyObjectSize = 4
+
+	fsys, _ := newServerFSTesting(t)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+	want := strings.Repeat("0123456789", 3)
+	if _, err := fsys.WriteFileWithOptions("multipart.txt", []byte(want), fs.ModePerm, &WriteOptions{
+		ContentType: "text/plain",
+		Metadata:    map[string]string{"key": "value"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: Copy uses UploadPartCopy because the size exceeds maxCopyObjectSize.
+	if err := fsys.Copy("multipart.txt", "copied.txt"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("copied.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Error ReadFile got %s; want %s", got, want)
+	}
+	info, err := fsys.Stat("copied.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: aws-sdk-go canonicalizes the keys of the metadata headers.
+	o := info.Sys().(*ObjectInfo)
+	if o.ContentType != "text/plain" || o.Metadata["Key"] != "value" {
+		t.Errorf("Error Stat got %+v; want the content type and the metadata", o)
+	}
+}
+
+func TestHandler_RemoveAll(t *testing.T) {
+	fsys, _ := newServerFSTesting(t)
+	fsys.ListBufferSize = 1
+	if err := fsys.RemoveAll("dir0"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat("dir0/file01.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestHandler_OSFS(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "bucket"), os.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(osfs.New(dir))
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	client := newServerClient(t, ts.URL, testAccessKeyID, testSecretAccessKey)
+
+	_, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("not-found.txt"),
+	})
+	if !isAWSErrorCode(err, s3.ErrCodeNoSuchKey) {
+		t.Errorf("Error GetObject error got %v; want %s", err, s3.ErrCodeNoSuchKey)
+	}
+	_, err = client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("bucket"),
+		Key:    aws.String("not-found.txt"),
+	})
+	if !isAWSErrorCode(err, errCodeNotFound) {
+		t.Errorf("Error HeadObject error got %v; want %s", err, errCodeNotFound)
+	}
+
+	fsys := NewWithAPI("bucket", client)
+	if _, err := fsys.Stat("not-found.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.WriteFile("dir/a.txt", []byte("a"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := fsys.ReadFile("dir/a.txt"); err != nil || string(got) != "a" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "a")
+	}
+}
+
+func TestHandler_ListObjectsV2(t *testing.T) {
+	_, client := newServerFSTesting(t)
+	var keys, prefixes []string
+	err := client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket:    aws.String("testdata"),
+		Delimiter: aws.String("/"),
+		MaxKeys:   aws.Int64(1),
+	}, func(output *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, o := range output.Contents {
+			keys = append(keys, aws.StringValue(o.Key))
+		}
+		for _, p := range output.CommonPrefixes {
+			prefixes = append(prefixes, aws.StringValue(p.Prefix))
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(keys, ","), "file0.txt,file1.txt,file2.txt"; got != want {
+		t.Errorf("Error ListObjectsV2 keys got %s; want %s", got, want)
+	}
+	if got, want := strings.Join(prefixes, ","), "dir0/"; got != want {
+		t.Errorf("Error ListObjectsV2 prefixes got %s; want %s", got, want)
+	}
+}
+
+func TestHandler_Buckets(t *testing.T) {
+	_, client := newServerFSTesting(t)
+	if _, err := client.CreateBucket(&s3.CreateBucketInput{Bucket: aws.String("new")}); err != nil {
+		t.Fatal(err)
+	}
+	output, err := client.ListBuckets(&s3.ListBucketsInput{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, b := range output.Buckets {
+		names = append(names, aws.StringValue(b.Name))
+	}
+	if got, want := strings.Join(names, ","), "new,testdata"; got != want {
+		t.Errorf("Error ListBuckets got %s; want %s", got, want)
+	}
+	if _, err := client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("testdata")}); !isAWSErrorCode(err, "BucketNotEmpty") {
+		t.Errorf("Error DeleteBucket error got %v; want BucketNotEmpty", err)
+	}
+	if _, err := client.DeleteBucket(&s3.DeleteBucketInput{Bucket: aws.String("new")}); err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetObject(&s3.GetObjectInput{Bucket: aws.String("new"), Key: aws.String("key")})
+	if !isAWSErrorCode(err, errCodeNoSuchBkt) {
+		t.Errorf("Error GetObject error got %v; want %s", err, errCodeNoSuchBkt)
+	}
+}
+
+func TestHandler_Range(t *testing.T) {
+	_, client := newServerFSTesting(t)
+	output, err := client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+		Range:  aws.String("bytes=1-3"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer output.Body.Close()
+	got, err := io.ReadAll(output.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "ont" {
+		t.Errorf("Error GetObject got %q; want %q", got, "ont")
+	}
+	if got, want := aws.StringValue(output.ContentRange), "bytes 1-3/10"; got != want {
+		t.Errorf("Error GetObject ContentRange got %s; want %s", got, want)
+	}
+}
+
+func TestHandler_DiskCache(t *testing.T) {
+	fsys, client := newServerFSTesting(t)
+	cache, err := NewDiskCache(t.TempDir(), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fsys.DiskCache = cache
+	for i := 0; i < 2; i++ {
+		got, err := fsys.ReadFile("dir0/file01.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "content01\n" {
+			t.Errorf("Error ReadFile got %q; want %q", got, "content01\n")
+		}
+	}
+	if got := cache.Size(); got != 10 {
+		t.Errorf("Error Size got %d; want %d", got, 10)
+	}
+
+	head, err := client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = client.GetObject(&s3.GetObjectInput{
+		Bucket:      aws.String("testdata"),
+		Key:         aws.String("dir0/file01.txt"),
+		IfNoneMatch: head.ETag,
+	})
+	if !isNotModified(err) {
+		t.Errorf("Error GetObject IfNoneMatch error got %v; want NotModified", err)
+	}
+}
+
+func TestHandler_EncodingType(t *testing.T) {
+	fsys, _ := newServerFSTesting(t)
+	name := "dir0/ctl\x01 +%.txt"
+	if _, err := fsys.WriteFile(name, []byte("ctl"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"ctl\x01 +%.txt", "file01.txt", "file02.txt", "file03.txt"}
+	if got := readDirNames(t, fsys, "dir0"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Error ReadDir got %q; want %q", got, want)
+	}
+	if got, err := fsys.Glob("dir0/ctl*"); err != nil || !reflect.DeepEqual(got, []string{name}) {
+		t.Errorf("Error Glob got %q, %v; want %q", got, err, []string{name})
+	}
+	if err := fsys.Rename("dir0", "dir1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(name); !isNotExist(err) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+	renamed := "dir1/ctl\x01 +%.txt"
+	if got, err := fsys.ReadFile(renamed); err != nil || string(got) != "ctl" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "ctl")
+	}
+	if err := fsys.RemoveAll("dir1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.Stat(renamed); !isNotExist(err) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func isAWSErrorCode(err error, code string) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == code
+}
+
+func TestHandler_SigV4(t *testing.T) {
+	ts, _ := newServerTesting(t)
+	testCases := []struct {
+		accessKeyID     string
+		secretAccessKey string
+		code            string
+	}{
+		{
+			accessKeyID:     testAccessKeyID,
+			secretAccessKey: testSecretAccessKey,
+		}, {
+			accessKeyID:     testAccessKeyID,
+			secretAccessKey: "invalid",
+			code:            "SignatureDoesNotMatch",
+		}, {
+			accessKeyID:     "unknown",
+			secretAccessKey: testSecretAccessKey,
+			code:            "InvalidAccessKeyId",
+		},
+	}
+	for _, tc := range testCases {
+		client := newServerClient(t, ts.URL, tc.accessKeyID, tc.secretAccessKey)
+		_, err := client.PutObject(&s3.PutObjectInput{
+			Bucket: aws.String("testdata"),
+			Key:    aws.String("signed.txt"),
+			Body:   strings.NewReader("signed"),
+		})
+		if tc.code == "" {
+			if err != nil {
+				t.Errorf("Error PutObject by %s: %v", tc.accessKeyID, err)
+			}
+			continue
+		}
+		if !isAWSErrorCode(err, tc.code) {
+			t.Errorf("Error PutObject by %s error got %v; want %s", tc.accessKeyID, err, tc.code)
+		}
+	}
+
+	res, err := http.Get(ts.URL + "/testdata/file0.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusForbidden {
+		t.Errorf("Error anonymous GET status got %d; want %d", res.StatusCode, http.StatusForbidden)
+	}
+}
+
+func TestHandler_Presigned(t *testing.T) {
+	ts, _ := newServerTesting(t)
+	client := newServerClient(t, ts.URL, testAccessKeyID, testSecretAccessKey)
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{
+		Bucket: aws.String("testdata"),
+		Key:    aws.String("dir0/file01.txt"),
+	})
+	u, err := req.Presign(time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	got, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || string(got) != "content01\n" {
+		t.Errorf("Error presigned GET got %d %q; want %d %q", res.StatusCode, got, http.StatusOK, "content01\n")
+	}
+}
+
+func TestHandler_SigV4Time(t *testing.T) {
+	ts, _ := newServerTesting(t)
+	signer := v4.NewSigner(credentials.NewStaticCredentials(testAccessKeyID, testSecretAccessKey, ""))
+	now := time.Now()
+	newRequest := func(t *testing.T) *http.Request {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+"/testdata/file0.txt", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	testCases := []struct {
+		name   string
+		sign   func(t *testing.T) *http.Request
+		status int
+		code   string
+	}{
+		{
+			name: "signed",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Sign(req, nil, "s3", "us-east-1", now.Add(-5*time.Minute))
+				return req
+			},
+			status: http.StatusOK,
+		}, {
+			name: "expired",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Sign(req, nil, "s3", "us-east-1", now.Add(-20*time.Minute))
+				return req
+			},
+			status: http.StatusForbidden,
+			code:   "RequestTimeTooSkewed",
+		}, {
+			name: "future",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Sign(req, nil, "s3", "us-east-1", now.Add(20*time.Minute))
+				return req
+			},
+			status: http.StatusForbidden,
+			code:   "RequestTimeTooSkewed",
+		}, {
+			name: "mismatched scope",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Sign(req, nil, "s3", "us-east-1", now)
+				today := now.UTC().Format("20060102")
+				yesterday := now.UTC().Add(-24 * time.Hour).Format("20060102")
+				req.Header.Set("Authorization", strings.Replace(req.Header.Get("Authorization"), "/"+today+"/", "/"+yesterday+"/", 1))
+				return req
+			},
+			status: http.StatusBadRequest,
+			code:   "AuthorizationHeaderMalformed",
+		}, {
+			name: "presigned",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Presign(req, nil, "s3", "us-east-1", 7*24*time.Hour, now)
+				return req
+			},
+			status: http.StatusOK,
+		}, {
+			name: "oversized expires",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Presign(req, nil, "s3", "us-east-1", 8*24*time.Hour, now)
+				return req
+			},
+			status: http.StatusBadRequest,
+			code:   "AuthorizationQueryParametersError",
+		}, {
+			name: "negative expires",
+			sign: func(t *testing.T) *http.Request {
+				req := newRequest(t)
+				signer.Presign(req, nil, "s3", "us-east-1", time.Minute, now)
+				req.URL.RawQuery = strings.Replace(req.URL.RawQuery, "X-Amz-Expires=60", "X-Amz-Expires=-1", 1)
+				return req
+			},
+			status: http.StatusBadRequest,
+			code:   "AuthorizationQueryParametersError",
+		},
+	}
+	for _, tc := range testCases {
+		res, err := http.DefaultClient.Do(tc.sign(t))
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != tc.status {
+			t.Errorf("Error %s status got %d; want %d", tc.name, res.StatusCode, tc.status)
+		}
+		if tc.code != "" && !strings.Contains(string(body), "<Code>"+tc.code+"</Code>") {
+			t.Errorf("Error %s body got %s; want %s", tc.name, body, tc.code)
+		}
+	}
+}
+
+func TestHandler_VirtualHost(t *testing.T) {
+	h := NewHandler(newMemFSTesting(t))
+	h.Domain = "s3.localhost"
+
+	req := httptest.NewRequest(http.MethodGet, "http://testdata.s3.localhost:9000/dir0/file01.txt", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "content01\n" {
+		t.Errorf("Error virtual-hosted-style GET got %d %q; want %d %q", w.Code, w.Body.String(), http.StatusOK, "content01\n")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "http://localhost/testdata/dir0/file01.txt", nil)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	if w.Code != http.StatusOK || w.Body.String() != "content01\n" {
+		t.Errorf("Error path-style GET got %d %q; want %d %q", w.Code, w.Body.String(), http.StatusOK, "content01\n")
+	}
+}
+
+func TestHandler_Traversal(t *testing.T) {
+	memFsys := newMemFSTesting(t)
+	if _, err := wfs.WriteFile(memFsys, "other/secret.txt", []byte("secret"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	h := NewHandler(memFsys)
+	for _, target := range []string{
+		"/testdata/../other/secret.txt",
+		"/testdata/..%2Fother%2Fsecret.txt",
+		"/testdata/dir0/../../other/secret.txt",
+	} {
+		for _, method := range []string{http.MethodGet, http.MethodPut} {
+			req := httptest.NewRequest(method, "http://localhost"+target, strings.NewReader("overwritten"))
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("Error %s %s status got %d; want %d", method, target, w.Code, http.StatusBadRequest)
+			}
+		}
+	}
+	if got, err := fs.ReadFile(memFsys, "other/secret.txt"); err != nil || string(got) != "secret" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "secret")
+	}
+}
+
+func TestAWSChunkedReader(t *testing.T) {
+	body := "5;chunk-signature=abc\r\nhello\r\n6;chunk-signature=def\r\n world\r\n0;chunk-signature=ghi\r\n\r\n"
+	got, err := io.ReadAll(newAWSChunkedReader(strings.NewReader(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "hello world" {
+		t.Errorf("Error awsChunkedReader got %q; want %q", got, "hello world")
+	}
+	if _, err := io.ReadAll(newAWSChunkedReader(strings.NewReader("5\r\nhel"))); err == nil {
+		t.Errorf("Error awsChunkedReader returns no error on the truncated body")
+	}
+}
+
+func TestHandler_V2(t *testing.T) {
+	ts, _ := newServerTesting(t)
+	client := s3v2.New(s3v2.Options{
+		BaseEndpoint: awsv2.String(ts.URL),
+		Region:       "us-east-1",
+		UsePathStyle: true,
+		Credentials: awsv2.CredentialsProviderFunc(func(ctx context.Context) (awsv2.Credentials, error) {
+			return awsv2.Credentials{AccessKeyID: testAccessKeyID, SecretAccessKey: testSecretAccessKey}, nil
+		}),
+	})
+	fsys := NewWithClient("testdata", client)
+	if _, err := fsys.WriteFile("v2.txt", []byte("v2"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := fstest.TestFS(fsys, "v2.txt", "dir0/file01.txt"); err != nil {
+		t.Errorf("Error testing/fstest: %+v", err)
+	}
+}
@@ -0,0 +1,266 @@
+package s3fs
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+const (
+	sigV4Algorithm      = "AWS4-HMAC-SHA256"
+	sigV4TimeFormat     = "20060102T150405Z"
+	unsignedPayload     = "UNSIGNED-PAYLOAD"
+	streamingPayload    = "STREAMING-"
+	errCodeAccessDenied = "AccessDenied"
+	// maxSigV4Skew is the maximum difference between the time of the signed
+	// request and the current time.
+	maxSigV4Skew = 15 * time.Minute
+	// maxPresignExpires is the maximum X-Amz-Expires of the presigned
+	// requests in seconds (7 days).
+	maxPresignExpires = 7 * 24 * 60 * 60
+)
+
+// sigV4Request represents the signature of a request that is signed by AWS
+// Signature Version 4.
+type sigV4Request struct {
+	accessKeyID   string
+	scope         string
+	amzDate       string
+	signedHeaders []string
+	signature     string
+	payloadHash   string
+	presigned     bool
+}
+
+func accessDenied(message string) error {
+	return awserr.New(errCodeAccessDenied, message, nil)
+}
+
+// parseSigV4 parses the signature of the header or the query of the request.
+func parseSigV4(r *http.Request) (*sigV4Request, error) {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if !strings.HasPrefix(auth, sigV4Algorithm+" ") {
+			return nil, accessDenied("unsupported authorization type")
+		}
+		s := &sigV4Request{
+			amzDate:     r.Header.Get("X-Amz-Date"),
+			payloadHash: r.Header.Get("X-Amz-Content-Sha256"),
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(auth, sigV4Algorithm+" "), ",") {
+			k, v, _ := strings.Cut(strings.TrimSpace(field), "=")
+			switch k {
+			case "Credential":
+				if err := s.setCredential(v); err != nil {
+					return nil, err
+				}
+			case "SignedHeaders":
+				s.signedHeaders = strings.Split(v, ";")
+			case "Signature":
+				s.signature = v
+			}
+		}
+		signedAt, err := s.signedAt()
+		if err != nil {
+			return nil, err
+		}
+		if d := time.Since(signedAt); d > maxSigV4Skew || d < -maxSigV4Skew {
+			return nil, awserr.New("RequestTimeTooSkewed", "the difference between the request time and the current time is too large", nil)
+		}
+		return s, nil
+	}
+	query := r.URL.Query()
+	if query.Get("X-Amz-Algorithm") == "" {
+		return nil, accessDenied("access denied")
+	}
+	if query.Get("X-Amz-Algorithm") != sigV4Algorithm {
+		return nil, accessDenied("unsupported algorithm")
+	}
+	s := &sigV4Request{
+		amzDate:       query.Get("X-Amz-Date"),
+		signedHeaders: strings.Split(query.Get("X-Amz-SignedHeaders"), ";"),
+		signature:     query.Get("X-Amz-Signature"),
+		payloadHash:   unsignedPayload,
+		presigned:     true,
+	}
+	if err := s.setCredential(query.Get("X-Amz-Credential")); err != nil {
+		return nil, err
+	}
+	signedAt, err := s.signedAt()
+	if err != nil {
+		return nil, err
+	}
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return nil, accessDenied("invalid X-Amz-Expires")
+	}
+	if expires < 0 || expires > maxPresignExpires {
+		return nil, s.malformed("X-Amz-Expires must be between 0 and 604800 seconds")
+	}
+	if time.Now().After(signedAt.Add(time.Duration(expires) * time.Second)) {
+		return nil, accessDenied("request has expired")
+	}
+	return s, nil
+}
+
+// setCredential sets the access key ID and the scope from the credential such
+// as "AKID/20060102/us-east-1/s3/aws4_request".
+func (s *sigV4Request) setCredential(credential string) error {
+	accessKeyID, scope, ok := strings.Cut(credential, "/")
+	if !ok || strings.Count(scope, "/") != 3 {
+		return accessDenied("invalid credential")
+	}
+	s.accessKeyID = accessKeyID
+	s.scope = scope
+	return nil
+}
+
+// signedAt parses X-Amz-Date and checks that the date of the scope is the
+// same day.
+func (s *sigV4Request) signedAt() (time.Time, error) {
+	signedAt, err := time.Parse(sigV4TimeFormat, s.amzDate)
+	if err != nil {
+		return time.Time{}, accessDenied("invalid X-Amz-Date")
+	}
+	if date, _, _ := strings.Cut(s.scope, "/"); date != signedAt.Format("20060102") {
+		return time.Time{}, s.malformed("the date of the credential scope does not match X-Amz-Date")
+	}
+	return signedAt, nil
+}
+
+// malformed returns the error of the malformed authorization of the header or
+// the query.
+func (s *sigV4Request) malformed(message string) error {
+	if s.presigned {
+		return awserr.New("AuthorizationQueryParametersError", message, nil)
+	}
+	return awserr.New("AuthorizationHeaderMalformed", message, nil)
+}
+
+// uriEncode encodes the string by the rules of AWS Signature Version 4.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			b.WriteString("%" + strings.ToUpper(hex.EncodeToString([]byte{c})))
+		}
+	}
+	return b.String()
+}
+
+func canonicalQuery(rawQuery string, presigned bool) string {
+	var params []string
+	for _, param := range strings.Split(rawQuery, "&") {
+		if param == "" {
+			continue
+		}
+		k, v, _ := strings.Cut(param, "=")
+		k, _ = url.QueryUnescape(k)
+		v, _ = url.QueryUnescape(v)
+		if presigned && k == "X-Amz-Signature" {
+			continue
+		}
+		params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
+
+func canonicalHeaderValue(r *http.Request, name string) string {
+	switch name {
+	case "host":
+		return r.Host
+	case "content-length":
+		if v := r.Header.Get("Content-Length"); v != "" {
+			return v
+		}
+		return strconv.FormatInt(r.ContentLength, 10)
+	}
+	values := r.Header.Values(name)
+	for i, v := range values {
+		values[i] = strings.Join(strings.Fields(v), " ")
+	}
+	return strings.Join(values, ",")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(p []byte) string {
+	sum := sha256.Sum256(p)
+	return hex.EncodeToString(sum[:])
+}
+
+// sign returns the signature of the request with the secret access key.
+func (s *sigV4Request) sign(r *http.Request, secretAccessKey string) string {
+	var headers strings.Builder
+	for _, name := range s.signedHeaders {
+		headers.WriteString(name + ":" + canonicalHeaderValue(r, name) + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		canonicalQuery(r.URL.RawQuery, s.presigned),
+		headers.String(),
+		strings.Join(s.signedHeaders, ";"),
+		s.payloadHash,
+	}, "\n")
+	stringToSign := strings.Join([]string{
+		sigV4Algorithm,
+		s.amzDate,
+		s.scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	parts := strings.Split(s.scope, "/")
+	key := hmacSHA256([]byte("AWS4"+secretAccessKey), parts[0])
+	for _, part := range parts[1:] {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// verifySigV4 verifies the signature of the request by the credentials. The
+// payload is not verified against X-Amz-Content-Sha256 and the signatures of
+// the chunks of streaming uploads are not verified.
+func verifySigV4(r *http.Request, credentials map[string]string) error {
+	s, err := parseSigV4(r)
+	if err != nil {
+		return err
+	}
+	secretAccessKey, ok := credentials[s.accessKeyID]
+	if !ok {
+		return awserr.New("InvalidAccessKeyId", "the access key ID does not exist", nil)
+	}
+	if s.payloadHash == "" {
+		p, err := io.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		r.Body = io.NopCloser(bytes.NewReader(p))
+		s.payloadHash = sha256Hex(p)
+	}
+	if !hmac.Equal([]byte(s.sign(r, secretAccessKey)), []byte(s.signature)) {
+		return awserr.New("SignatureDoesNotMatch", "the request signature does not match", nil)
+	}
+	return nil
+}
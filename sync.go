@@ -0,0 +1,397 @@
+package s3fs
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/jarxorg/wfs"
+)
+
+const defaultSyncConcurrency = 5
+
+// SyncOptions represents the options of Sync.
+type SyncOptions struct {
+	// Delete specifies whether Sync removes the files of dst that do not exist
+	// in src. The files that are excluded by Include and Exclude are not
+	// removed.
+	Delete bool
+	// Include is the patterns of path.Match of the files to sync. A pattern
+	// is matched against the name, its parent directories and its base name.
+	// If Include is empty then all files are included.
+	Include []string
+	// Exclude is the patterns of path.Match of the files not to sync. Exclude
+	// is applied after Include.
+	Exclude []string
+	// Checksum specifies whether Sync compares the MD5 of the files whose
+	// modification time of src is newer than dst but the sizes are the same.
+	// The ETags of S3 are used as the MD5 unless they are of multipart
+	// uploads.
+	Checksum bool
+	// DryRun specifies whether Sync only reports the changes without
+	// copying and removing the files.
+	DryRun bool
+	// Concurrency is the number of the files that are copied or removed
+	// concurrently. (Default 5)
+	Concurrency int
+}
+
+// SyncAction is the action of Sync on a file.
+type SyncAction int
+
+const (
+	// SyncCreate is the action that copies the file that does not exist in
+	// dst.
+	SyncCreate SyncAction = iota + 1
+	// SyncUpdate is the action that copies the file that is changed.
+	SyncUpdate
+	// SyncDelete is the action that removes the file that does not exist in
+	// src.
+	SyncDelete
+)
+
+// String returns the name of the action.
+func (a SyncAction) String() string {
+	switch a {
+	case SyncCreate:
+		return "create"
+	case SyncUpdate:
+		return "update"
+	case SyncDelete:
+		return "delete"
+	}
+	return fmt.Sprintf("SyncAction(%d)", int(a))
+}
+
+// SyncChange is the change of a file by Sync.
+type SyncChange struct {
+	Name   string
+	Action SyncAction
+	// Size is the size of the file of src, or of dst on SyncDelete.
+	Size int64
+	// Err is the error that occurred on the change.
+	Err error
+}
+
+// SyncSummary is the summary of the changes by Sync.
+type SyncSummary struct {
+	// Changes is the changes that are sorted by the names.
+	Changes []*SyncChange
+	// Created, Updated and Deleted are the numbers of the succeeded changes.
+	// On DryRun they are the numbers of the changes that would be made.
+	Created int
+	Updated int
+	Deleted int
+	// Failed is the number of the failed changes.
+	Failed int
+	// Unchanged is the number of the files that are not changed.
+	Unchanged int
+	// Bytes is the total size of the files that are created and updated.
+	Bytes int64
+}
+
+// syncEntry is a file that is listed by Sync.
+type syncEntry struct {
+	size    int64
+	modTime time.Time
+	etag    string
+}
+
+// Sync synchronizes the files of dst with src one way. Only the files that do
+// not exist in dst or are changed are copied in parallel. The files are
+// compared by the sizes, the ETags if both are on S3, and the modification
+// times, optionally by the MD5. If dst or src is *S3FS then its objects are
+// listed by the flat listing instead of reading each directory. Sync reports
+// the changes as the summary, and returns the joined errors of the failed
+// changes.
+func Sync(dst wfs.WriteFileFS, src fs.FS, opts *SyncOptions) (*SyncSummary, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+	srcEntries, err := listSyncEntries(src, opts)
+	if err != nil {
+		return nil, err
+	}
+	dstEntries, err := listSyncEntries(dst, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &syncer{dst: dst, src: src, opts: opts, summary: &SyncSummary{}}
+	for name, srcEntry := range srcEntries {
+		dstEntry, ok := dstEntries[name]
+		if !ok {
+			s.summary.Changes = append(s.summary.Changes, &SyncChange{Name: name, Action: SyncCreate, Size: srcEntry.size})
+			continue
+		}
+		same, err := s.same(name, srcEntry, dstEntry)
+		if err != nil {
+			s.summary.Changes = append(s.summary.Changes, &SyncChange{Name: name, Action: SyncUpdate, Size: srcEntry.size, Err: err})
+			continue
+		}
+		if same {
+			s.summary.Unchanged++
+			continue
+		}
+		s.summary.Changes = append(s.summary.Changes, &SyncChange{Name: name, Action: SyncUpdate, Size: srcEntry.size})
+	}
+	if opts.Delete {
+		for name, dstEntry := range dstEntries {
+			if _, ok := srcEntries[name]; !ok {
+				s.summary.Changes = append(s.summary.Changes, &SyncChange{Name: name, Action: SyncDelete, Size: dstEntry.size})
+			}
+		}
+	}
+	sort.Slice(s.summary.Changes, func(i, j int) bool {
+		return s.summary.Changes[i].Name < s.summary.Changes[j].Name
+	})
+	if !opts.DryRun {
+		s.apply()
+	}
+	return s.summary, s.summarize()
+}
+
+// listSyncEntries lists the files of the filesystem that are matched by the
+// options.
+func listSyncEntries(fsys fs.FS, opts *SyncOptions) (map[string]*syncEntry, error) {
+	entries := map[string]*syncEntry{}
+	if s3fsys, ok := fsys.(*S3FS); ok {
+		return entries, s3fsys.listSyncEntries(opts, entries)
+	}
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !opts.match(name) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		e := &syncEntry{size: info.Size(), modTime: info.ModTime()}
+		if o, ok := info.Sys().(*ObjectInfo); ok {
+			e.etag = o.ETag
+		}
+		entries[name] = e
+		return nil
+	})
+	return entries, err
+}
+
+// listSyncEntries lists the objects under the directory of the filesystem by
+// the flat listing. The directory markers are skipped and the invalid keys
+// are handled by InvalidKeys.
+func (fsys *S3FS) listSyncEntries(opts *SyncOptions, entries map[string]*syncEntry) error {
+	prefix := fsys.prefix(".")
+	return fsys.listObjects(prefix, func(objects []*s3.Object) error {
+		for _, o := range objects {
+			key := aws.StringValue(o.Key)
+			rel := strings.TrimPrefix(key, prefix)
+			if rel == "" || strings.HasSuffix(rel, "/") {
+				continue
+			}
+			ok, err := fsys.checkKey(key, rel)
+			if err != nil {
+				return err
+			}
+			name := fsys.toName(rel)
+			if !ok || !opts.match(name) {
+				continue
+			}
+			entries[name] = &syncEntry{
+				size:    aws.Int64Value(o.Size),
+				modTime: aws.TimeValue(o.LastModified),
+				etag:    aws.StringValue(o.ETag),
+			}
+		}
+		return nil
+	})
+}
+
+// match reports whether the name is included and not excluded.
+func (opts *SyncOptions) match(name string) bool {
+	if len(opts.Include) > 0 && !matchAny(opts.Include, name) {
+		return false
+	}
+	return !matchAny(opts.Exclude, name)
+}
+
+// matchAny reports whether any pattern matches the name, its parent
+// directories or its base name.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, path.Base(name)); ok {
+			return true
+		}
+		for n := name; n != "."; n = path.Dir(n) {
+			if ok, _ := path.Match(pattern, n); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+type syncer struct {
+	dst     wfs.WriteFileFS
+	src     fs.FS
+	opts    *SyncOptions
+	summary *SyncSummary
+	mutex   sync.Mutex
+	dirs    map[string]bool
+}
+
+// same reports whether the file of src is the same as dst.
+func (s *syncer) same(name string, srcEntry, dstEntry *syncEntry) (bool, error) {
+	if srcEntry.size != dstEntry.size {
+		return false, nil
+	}
+	if srcEntry.etag != "" && dstEntry.etag != "" {
+		return srcEntry.etag == dstEntry.etag, nil
+	}
+	if !srcEntry.modTime.After(dstEntry.modTime) {
+		return true, nil
+	}
+	if !s.opts.Checksum {
+		return false, nil
+	}
+	srcSum, err := contentMD5(s.src, name, srcEntry.etag)
+	if err != nil || srcSum == "" {
+		return false, err
+	}
+	dstSum, err := contentMD5(s.dst, name, dstEntry.etag)
+	if err != nil || dstSum == "" {
+		return false, err
+	}
+	return srcSum == dstSum, nil
+}
+
+// contentMD5 returns the hex MD5 of the named file. If the ETag is specified
+// then it is used as the MD5, and if the ETag is of the multipart upload then
+// contentMD5 returns the empty string.
+func contentMD5(fsys fs.FS, name, etag string) (string, error) {
+	if etag != "" {
+		if strings.Contains(etag, "-") {
+			return "", nil
+		}
+		return strings.Trim(etag, `"`), nil
+	}
+	f, err := fsys.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// apply applies the changes concurrently.
+func (s *syncer) apply() {
+	concurrency := s.opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultSyncConcurrency
+	}
+	s.dirs = map[string]bool{}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, c := range s.summary.Changes {
+		if c.Err != nil {
+			continue
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(c *SyncChange) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if c.Action == SyncDelete {
+				c.Err = wfs.RemoveFile(s.dst, c.Name)
+				return
+			}
+			c.Err = s.copy(c.Name)
+		}(c)
+	}
+	wg.Wait()
+}
+
+// copy copies the named file from src to dst.
+func (s *syncer) copy(name string) error {
+	if err := s.mkdirAll(path.Dir(name)); err != nil {
+		return err
+	}
+	srcFile, err := s.src.Open(name)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+	dstFile, err := s.dst.CreateFile(name, fs.ModePerm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return &fs.PathError{Op: "Sync", Path: name, Err: err}
+	}
+	return dstFile.Close()
+}
+
+// mkdirAll creates the directory of dst once.
+func (s *syncer) mkdirAll(dir string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if dir == "." || s.dirs[dir] {
+		return nil
+	}
+	if err := s.dst.MkdirAll(dir, fs.ModePerm); err != nil {
+		return err
+	}
+	s.dirs[dir] = true
+	return nil
+}
+
+// summarize counts the changes and returns the joined errors of the failed
+// changes.
+func (s *syncer) summarize() error {
+	var errs []error
+	for _, c := range s.summary.Changes {
+		if c.Err != nil {
+			s.summary.Failed++
+			errs = append(errs, c.Err)
+			continue
+		}
+		switch c.Action {
+		case SyncCreate:
+			s.summary.Created++
+			s.summary.Bytes += c.Size
+		case SyncUpdate:
+			s.summary.Updated++
+			s.summary.Bytes += c.Size
+		case SyncDelete:
+			s.summary.Deleted++
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,246 @@
+package s3fs
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/jarxorg/s3fs/s3fake"
+	"github.com/jarxorg/wfs"
+	"github.com/jarxorg/wfs/memfs"
+	"github.com/jarxorg/wfs/osfs"
+)
+
+func newSyncSrcTesting(t *testing.T) *memfs.MemFS {
+	src := memfs.New()
+	files := map[string]string{
+		"a.txt":         "a",
+		"dir/b.txt":     "bb",
+		"dir/sub/c.log": "ccc",
+		"tmp/d.txt":     "dddd",
+	}
+	for name, data := range files {
+		if _, err := wfs.WriteFile(src, name, []byte(data), fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func newSyncDstTesting(t *testing.T) (*S3FS, *countAPI) {
+	return newCountFSTesting(t, nil)
+}
+
+func syncChanges(summary *SyncSummary) map[string]SyncAction {
+	changes := map[string]SyncAction{}
+	for _, c := range summary.Changes {
+		changes[c.Name] = c.Action
+	}
+	return changes
+}
+
+func TestSync(t *testing.T) {
+	src := newSyncSrcTesting(t)
+	dst, api := newSyncDstTesting(t)
+
+	summary, err := Sync(dst, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &SyncSummary{
+		Changes: []*SyncChange{
+			{Name: "a.txt", Action: SyncCreate, Size: 1},
+			{Name: "dir/b.txt", Action: SyncCreate, Size: 2},
+			{Name: "dir/sub/c.log", Action: SyncCreate, Size: 3},
+			{Name: "tmp/d.txt", Action: SyncCreate, Size: 4},
+		},
+		Created: 4,
+		Bytes:   10,
+	}
+	if !reflect.DeepEqual(summary, want) {
+		t.Errorf("Error Sync got %+v; want %+v", summary, want)
+	}
+	if got, err := dst.ReadFile("dir/sub/c.log"); err != nil || string(got) != "ccc" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "ccc")
+	}
+
+	// NOTE: The objects are compared by the flat listing.
+	api.reset()
+	summary, err = Sync(dst, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Changes) != 0 || summary.Unchanged != 4 {
+		t.Errorf("Error Sync changes %v unchanged %d; want no changes", syncChanges(summary), summary.Unchanged)
+	}
+	if heads, lists := api.count("HeadObject"), api.count("ListObjectsV2"); heads != 0 || lists != 1 {
+		t.Errorf("Error Sync requests HeadObject %d ListObjectsV2 %d; want 0 and 1", heads, lists)
+	}
+
+	if _, err := wfs.WriteFile(src, "dir/b.txt", []byte("updated"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.WriteFile("extra.txt", []byte("extra"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	summary, err = Sync(dst, src, &SyncOptions{Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges := map[string]SyncAction{"dir/b.txt": SyncUpdate, "extra.txt": SyncDelete}
+	if got := syncChanges(summary); !reflect.DeepEqual(got, wantChanges) {
+		t.Errorf("Error Sync changes got %v; want %v", got, wantChanges)
+	}
+	if summary.Updated != 1 || summary.Deleted != 1 || summary.Unchanged != 3 || summary.Bytes != 7 {
+		t.Errorf("Error Sync summary got %+v", summary)
+	}
+	if _, err := dst.Stat("extra.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+	if got, err := dst.ReadFile("dir/b.txt"); err != nil || string(got) != "updated" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "updated")
+	}
+}
+
+func TestSync_Filters(t *testing.T) {
+	src := newSyncSrcTesting(t)
+	dst, _ := newSyncDstTesting(t)
+	if _, err := dst.WriteFile("tmp/keep.txt", []byte("keep"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	opts := &SyncOptions{
+		Include: []string{"*.txt"},
+		Exclude: []string{"tmp"},
+		Delete:  true,
+	}
+	summary, err := Sync(dst, src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges := map[string]SyncAction{"a.txt": SyncCreate, "dir/b.txt": SyncCreate}
+	if got := syncChanges(summary); !reflect.DeepEqual(got, wantChanges) {
+		t.Errorf("Error Sync changes got %v; want %v", got, wantChanges)
+	}
+	// NOTE: The excluded files are not deleted.
+	if _, err := dst.Stat("tmp/keep.txt"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Sync(dst, src, &SyncOptions{Include: []string{"["}}); !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Error Sync error got %v; want %v", err, path.ErrBadPattern)
+	}
+}
+
+func TestSync_DryRun(t *testing.T) {
+	src := newSyncSrcTesting(t)
+	dst, _ := newSyncDstTesting(t)
+	summary, err := Sync(dst, src, &SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if summary.Created != 4 || summary.Bytes != 10 {
+		t.Errorf("Error Sync summary got %+v; want Created 4 Bytes 10", summary)
+	}
+	entries, err := dst.ReadDir(".")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("Error ReadDir got %d entries; want 0", len(entries))
+	}
+}
+
+func TestSync_Checksum(t *testing.T) {
+	dir := t.TempDir()
+	src := osfs.New(dir)
+	if _, err := wfs.WriteFile(src, "a.txt", []byte("a"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	dst, _ := newSyncDstTesting(t)
+	if _, err := Sync(dst, src, nil); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: The file of src is newer than dst but has the same content.
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(filepath.Join(dir, "a.txt"), future, future); err != nil {
+		t.Fatal(err)
+	}
+	summary, err := Sync(dst, src, &SyncOptions{Checksum: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary.Changes) != 0 || summary.Unchanged != 1 {
+		t.Errorf("Error Sync with Checksum changes got %v; want no changes", syncChanges(summary))
+	}
+	summary, err = Sync(dst, src, &SyncOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges := map[string]SyncAction{"a.txt": SyncUpdate}
+	if got := syncChanges(summary); !reflect.DeepEqual(got, wantChanges) {
+		t.Errorf("Error Sync changes got %v; want %v", got, wantChanges)
+	}
+}
+
+func TestSync_S3ToS3(t *testing.T) {
+	memFsys := memfs.New()
+	for _, bucket := range []string{"src", "dst"} {
+		if err := memFsys.MkdirAll(bucket, fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	api := newCountAPI(memFsys)
+	src, dst := NewWithAPI("src", api), NewWithAPI("dst", api)
+	if err := wfs.CopyFS(src, newSyncSrcTesting(t), "."); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Sync(dst, src, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// NOTE: The ETags are compared even if the files of src are newer.
+	if _, err := src.WriteFile("a.txt", []byte("a"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := src.WriteFile("dir/b.txt", []byte("BB"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	api.reset()
+	summary, err := Sync(dst, src, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantChanges := map[string]SyncAction{"dir/b.txt": SyncUpdate}
+	if got := syncChanges(summary); !reflect.DeepEqual(got, wantChanges) {
+		t.Errorf("Error Sync changes got %v; want %v", got, wantChanges)
+	}
+	if got, err := dst.ReadFile("dir/b.txt"); err != nil || string(got) != "BB" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "BB")
+	}
+}
+
+func TestSync_Errors(t *testing.T) {
+	src := newSyncSrcTesting(t)
+	dst, api := newSyncDstTesting(t)
+	errAccessDenied := awserr.New("AccessDenied", "access denied", nil)
+	api.InjectFault(s3fake.Fault{Op: "PutObject", Key: "dir/b.txt", Err: errAccessDenied})
+
+	summary, err := Sync(dst, src, nil)
+	if !errors.Is(err, errAccessDenied) {
+		t.Errorf("Error Sync error got %v; want %v", err, errAccessDenied)
+	}
+	if summary.Created != 3 || summary.Failed != 1 {
+		t.Errorf("Error Sync summary got %+v; want Created 3 Failed 1", summary)
+	}
+	for _, c := range summary.Changes {
+		if (c.Name == "dir/b.txt") != (c.Err != nil) {
+			t.Errorf("Error Sync change %s error %v", c.Name, c.Err)
+		}
+	}
+}
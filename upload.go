@@ -0,0 +1,203 @@
+package s3fs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+const (
+	// minPartSize is the minimum size of each part of multipart uploads except
+	// the last part.
+	minPartSize = int64(5 * 1024 * 1024)
+	// maxPartSize is the maximum size of each part of multipart uploads.
+	maxPartSize = int64(5 * 1024 * 1024 * 1024)
+	// maxUploadParts is the maximum number of the parts of multipart uploads.
+	maxUploadParts = int64(10000)
+)
+
+// ErrTooManyParts is returned by Write if the written bytes need more than
+// 10,000 parts of multipart upload. Increase S3FS.PartSize to write larger
+// files.
+var ErrTooManyParts = errors.New("too many parts")
+
+// multipartUpload uploads parts of an object concurrently.
+type multipartUpload struct {
+	fsys     *S3FS
+	key      string
+	opts     *WriteOptions
+	uploadID *string
+	sem      chan struct{}
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	parts    []*s3.CompletedPart
+	number   int64
+	err      error
+	done     bool
+}
+
+func newMultipartUpload(fsys *S3FS, key string, opts *WriteOptions) (*multipartUpload, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(fsys.bucket),
+		Key:    aws.String(key),
+	}
+	if opts != nil {
+		opts.applyCreateMultipartUpload(input)
+	}
+	output, err := fsys.client().CreateMultipartUploadWithContext(fsys.context(), input)
+	if err != nil {
+		return nil, err
+	}
+	concurrency := fsys.UploadConcurrency
+	if concurrency <= 0 {
+		concurrency = defaultUploadConcurrency
+	}
+	return &multipartUpload{
+		fsys:     fsys,
+		key:      key,
+		opts:     opts,
+		uploadID: output.UploadId,
+		sem:      make(chan struct{}, concurrency),
+	}, nil
+}
+
+// firstErr returns the first error that occurred on uploading parts.
+func (u *multipartUpload) firstErr() error {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	return u.err
+}
+
+func (u *multipartUpload) setErr(err error) {
+	u.mutex.Lock()
+	defer u.mutex.Unlock()
+	if u.err == nil {
+		u.err = err
+	}
+}
+
+// upload uploads the specified bytes as the next part in the background.
+// upload blocks while the number of uploading parts reaches the concurrency.
+func (u *multipartUpload) upload(p []byte) {
+	u.run(func(number int64) (*string, error) {
+		input := &s3.UploadPartInput{
+			Bucket:        aws.String(u.fsys.bucket),
+			Key:           aws.String(u.key),
+			UploadId:      u.uploadID,
+			PartNumber:    aws.Int64(number),
+			Body:          bytes.NewReader(p),
+			ContentLength: aws.Int64(int64(len(p))),
+		}
+		output, err := u.fsys.client().UploadPartWithContext(u.fsys.context(), input)
+		if err != nil {
+			return nil, err
+		}
+		return output.ETag, nil
+	})
+}
+
+// uploadCopy copies the specified range of the source object as the next part
+// in the background.
+func (u *multipartUpload) uploadCopy(source string, start, end int64) {
+	u.run(func(number int64) (*string, error) {
+		input := &s3.UploadPartCopyInput{
+			Bucket:          aws.String(u.fsys.bucket),
+			Key:             aws.String(u.key),
+			UploadId:        u.uploadID,
+			PartNumber:      aws.Int64(number),
+			CopySource:      aws.String(source),
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+		}
+		output, err := u.fsys.client().UploadPartCopyWithContext(u.fsys.context(), input)
+		if err != nil {
+			return nil, err
+		}
+		return output.CopyPartResult.ETag, nil
+	})
+}
+
+// run runs the specified function with the next part number in the background.
+func (u *multipartUpload) run(fn func(number int64) (*string, error)) {
+	u.number++
+	number := u.number
+	u.sem <- struct{}{}
+	u.wg.Add(1)
+	go func() {
+		defer func() {
+			<-u.sem
+			u.wg.Done()
+		}()
+		if u.firstErr() != nil {
+			return
+		}
+		etag, err := fn(number)
+		if err != nil {
+			u.setErr(err)
+			return
+		}
+		u.mutex.Lock()
+		defer u.mutex.Unlock()
+		u.parts = append(u.parts, &s3.CompletedPart{
+			ETag:       etag,
+			PartNumber: aws.Int64(number),
+		})
+	}()
+}
+
+// complete waits for all parts and completes the upload with the
+// preconditions of the options. If an error occurred then the upload is
+// aborted.
+func (u *multipartUpload) complete() (*s3.CompleteMultipartUploadOutput, error) {
+	u.wg.Wait()
+	if err := u.firstErr(); err != nil {
+		u.abort()
+		return nil, err
+	}
+	sort.Slice(u.parts, func(i, j int) bool {
+		return aws.Int64Value(u.parts[i].PartNumber) < aws.Int64Value(u.parts[j].PartNumber)
+	})
+	input := &s3.CompleteMultipartUploadInput{
+		Bucket:   aws.String(u.fsys.bucket),
+		Key:      aws.String(u.key),
+		UploadId: u.uploadID,
+		MultipartUpload: &s3.CompletedMultipartUpload{
+			Parts: u.parts,
+		},
+	}
+	var opts []request.Option
+	if u.opts != nil {
+		opts = u.opts.requestOptions()
+	}
+	output, err := u.fsys.client().CompleteMultipartUploadWithContext(u.fsys.context(), input, opts...)
+	if err != nil {
+		u.abort()
+		return nil, err
+	}
+	u.done = true
+	return output, nil
+}
+
+// abort waits for all parts and aborts the upload.
+// abort does not use the context of the filesystem so that the uploaded parts
+// are cleaned up even if the context is canceled.
+func (u *multipartUpload) abort() error {
+	u.wg.Wait()
+	if u.done {
+		return nil
+	}
+	u.done = true
+	input := &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(u.fsys.bucket),
+		Key:      aws.String(u.key),
+		UploadId: u.uploadID,
+	}
+	_, err := u.fsys.client().AbortMultipartUploadWithContext(context.Background(), input)
+	return err
+}
@@ -0,0 +1,136 @@
+package s3fs
+
+import (
+	"errors"
+	"io/fs"
+	"strings"
+	"testing"
+)
+
+func TestWriteFile_Multipart(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	fsys := NewWithAPI("testdata", api)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+	fsys.UploadConcurrency = 2
+
+	want := strings.Repeat("0123456789", 10)
+	f, err := fsys.CreateFile("multipart.txt", fs.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{want[:3], want[3:50], want[50:]} {
+		if _, err := f.Write([]byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if f.(*s3WriterFile).upload == nil {
+		t.Fatalf("Error multipart upload is not started")
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := fsys.ReadFile("multipart.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Error ReadFile got %s; want %s", got, want)
+	}
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+}
+
+func TestWriteFile_MultipartUploadPartError(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	fsys := NewWithAPI("testdata", api)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+
+	f, err := fsys.CreateFile("multipart.txt", fs.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantErr := errors.New("test")
+	api.err = wantErr
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); !errors.Is(err, wantErr) {
+		t.Errorf("Error Close got %v; want %v", err, wantErr)
+	}
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+	api.err = nil
+	if _, err := fsys.Stat("multipart.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestWriteFile_MultipartDiscard(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	fsys := NewWithAPI("testdata", api)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+
+	f, err := fsys.CreateFile("multipart.txt", fs.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("0123456789")); err != nil {
+		t.Fatal(err)
+	}
+	f.(*s3WriterFile).discard()
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+}
+
+func TestPartSize(t *testing.T) {
+	tests := []struct {
+		partSize    int64
+		minPartSize int64
+		want        int64
+	}{
+		{partSize: 0, want: defaultPartSize},
+		{partSize: 4, want: 5 * 1024 * 1024},
+		{partSize: 4, minPartSize: 1, want: 4},
+		{partSize: 8 * 1024 * 1024, want: 8 * 1024 * 1024},
+		{partSize: 6 * 1024 * 1024 * 1024, want: 5 * 1024 * 1024 * 1024},
+	}
+	for _, test := range tests {
+		fsys := &S3FS{PartSize: test.partSize, minPartSize: test.minPartSize}
+		if got := fsys.partSize(); got != test.want {
+			t.Errorf("Error partSize of PartSize %d got %d; want %d", test.partSize, got, test.want)
+		}
+	}
+}
+
+func TestWriteFile_MultipartTooManyParts(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	fsys := NewWithAPI("testdata", api)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+
+	f, err := fsys.CreateFile("multipart.txt", fs.ModePerm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Write([]byte("01234")); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: Pretend that the parts except the last one have been uploaded.
+	f.(*s3WriterFile).upload.number = maxUploadParts - 1
+	if _, err := f.Write([]byte("5678")); !errors.Is(err, ErrTooManyParts) {
+		t.Errorf("Error Write got %v; want %v", err, ErrTooManyParts)
+	}
+	if err := f.Close(); !errors.Is(err, ErrTooManyParts) {
+		t.Errorf("Error Close got %v; want %v", err, ErrTooManyParts)
+	}
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+}
@@ -3,6 +3,7 @@ package s3fs
 import (
 	"errors"
 	"io/fs"
+	"net/http"
 	"path"
 	"strings"
 
@@ -11,16 +12,19 @@ import (
 )
 
 func isNotExist(err error) bool {
-	if err == fs.ErrNotExist {
-		return true
-	}
-	var pathErr *fs.PathError
-	return errors.As(err, &pathErr) && pathErr.Err == fs.ErrNotExist
+	return errors.Is(err, fs.ErrNotExist)
 }
 
+// errCodeNotFound is the error code that HeadObject returns if the key does not exist.
+const errCodeNotFound = "NotFound"
+
 func isS3NoSuchKey(err error) bool {
 	var awsErr awserr.Error
-	return errors.As(err, &awsErr) && awsErr.Code() == s3.ErrCodeNoSuchKey
+	if !errors.As(err, &awsErr) {
+		return false
+	}
+	code := awsErr.Code()
+	return code == s3.ErrCodeNoSuchKey || code == errCodeNotFound
 }
 
 func toPathError(err error, op, name string) error {
@@ -30,13 +34,6 @@ func toPathError(err error, op, name string) error {
 	return &fs.PathError{Op: op, Path: name, Err: err}
 }
 
-func toS3NoSuckKeyIfNoExist(err error) error {
-	if isNotExist(err) {
-		return awserr.New(s3.ErrCodeNoSuchKey, "", nil)
-	}
-	return err
-}
-
 func normalizePrefix(prefix string) string {
 	prefix = path.Clean(prefix)
 	if prefix == "." || prefix == "/" {
@@ -65,18 +62,31 @@ LOOP:
 	return joined
 }
 
-func contains(keys []string, key string) bool {
-	for _, k := range keys {
-		if k == key {
-			return true
-		}
+// isNotModified reports whether the error is the response of the conditional
+// GET that the object is not modified.
+func isNotModified(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotModified {
+		return true
 	}
-	return false
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "NotModified"
 }
 
-func appendIfMatch(keys []string, key, pattern string) []string {
-	if ok, _ := path.Match(pattern, key); ok && !contains(keys, key) {
-		keys = append(keys, key)
+// isPreconditionFailed reports whether the error is the response of the
+// conditional request that the precondition does not hold.
+func isPreconditionFailed(err error) bool {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusPreconditionFailed {
+		return true
 	}
-	return keys
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "PreconditionFailed"
+}
+
+// isConditionalRequestConflict reports whether the error is the response of
+// the conditional write that conflicts with another write in progress.
+func isConditionalRequestConflict(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "ConditionalRequestConflict"
 }
@@ -3,6 +3,7 @@ package s3fs
 import (
 	"io/fs"
 	"reflect"
+	"syscall"
 	"testing"
 
 	"github.com/aws/aws-sdk-go/aws/awserr"
@@ -20,6 +21,9 @@ func TestIsNotExist(t *testing.T) {
 		}, {
 			err:  &fs.PathError{Err: fs.ErrNotExist},
 			want: true,
+		}, {
+			err:  &fs.PathError{Op: "stat", Path: "not-found.txt", Err: syscall.ENOENT},
+			want: true,
 		}, {
 			err:  fs.ErrExist,
 			want: false,
@@ -41,6 +45,9 @@ func TestIsS3NoSuchKey(t *testing.T) {
 		{
 			err:  awserr.New(s3.ErrCodeNoSuchKey, "", nil),
 			want: true,
+		}, {
+			err:  awserr.New(errCodeNotFound, "", nil),
+			want: true,
 		}, {
 			err:  fs.ErrNotExist,
 			want: false,
@@ -81,30 +88,6 @@ func TestToPathError(t *testing.T) {
 	}
 }
 
-func TestToS3NoSuckKeyIfNoExist(t *testing.T) {
-	tests := []struct {
-		err  error
-		want error
-	}{
-		{
-			err:  fs.ErrNotExist,
-			want: awserr.New(s3.ErrCodeNoSuchKey, "", nil),
-		}, {
-			err:  &fs.PathError{Err: fs.ErrNotExist},
-			want: awserr.New(s3.ErrCodeNoSuchKey, "", nil),
-		}, {
-			err:  fs.ErrExist,
-			want: fs.ErrExist,
-		},
-	}
-	for _, test := range tests {
-		got := toS3NoSuckKeyIfNoExist(test.err)
-		if got.Error() != test.want.Error() {
-			t.Errorf(`Error toS3NoSuckKeyIfNoExist(%v) returns %v; want %v`, test.err, got, test.want)
-		}
-	}
-}
-
 func TestNormalizePrefix(t *testing.T) {
 	tests := []struct {
 		prefix string
@@ -162,27 +145,3 @@ func TestNormalizePrefixPattern(t *testing.T) {
 		}
 	}
 }
-
-func TestContains(t *testing.T) {
-	tests := []struct {
-		keys []string
-		key  string
-		want bool
-	}{
-		{
-			keys: []string{"abc", "def", "ghi"},
-			key:  "def",
-			want: true,
-		}, {
-			keys: []string{"abc", "def", "ghi"},
-			key:  "xyz",
-			want: false,
-		},
-	}
-	for _, test := range tests {
-		got := contains(test.keys, test.key)
-		if got != test.want {
-			t.Errorf(`Error contains(%v, %v) returns %v; want %v`, test.keys, test.key, got, test.want)
-		}
-	}
-}
@@ -0,0 +1,527 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// S3Client is the subset of the operations of the S3 client of aws-sdk-go-v2
+// that S3FS uses. *s3.Client of aws-sdk-go-v2 satisfies S3Client.
+type S3Client interface {
+	GetObject(ctx context.Context, input *s3v2.GetObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.GetObjectOutput, error)
+	HeadObject(ctx context.Context, input *s3v2.HeadObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.HeadObjectOutput, error)
+	PutObject(ctx context.Context, input *s3v2.PutObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.PutObjectOutput, error)
+	ListObjectsV2(ctx context.Context, input *s3v2.ListObjectsV2Input, optFns ...func(*s3v2.Options)) (*s3v2.ListObjectsV2Output, error)
+	ListObjectVersions(ctx context.Context, input *s3v2.ListObjectVersionsInput, optFns ...func(*s3v2.Options)) (*s3v2.ListObjectVersionsOutput, error)
+	DeleteObject(ctx context.Context, input *s3v2.DeleteObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.DeleteObjectOutput, error)
+	DeleteObjects(ctx context.Context, input *s3v2.DeleteObjectsInput, optFns ...func(*s3v2.Options)) (*s3v2.DeleteObjectsOutput, error)
+	CreateMultipartUpload(ctx context.Context, input *s3v2.CreateMultipartUploadInput, optFns ...func(*s3v2.Options)) (*s3v2.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, input *s3v2.UploadPartInput, optFns ...func(*s3v2.Options)) (*s3v2.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, input *s3v2.CompleteMultipartUploadInput, optFns ...func(*s3v2.Options)) (*s3v2.CompleteMultipartUploadOutput, error)
+	CopyObject(ctx context.Context, input *s3v2.CopyObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.CopyObjectOutput, error)
+	UploadPartCopy(ctx context.Context, input *s3v2.UploadPartCopyInput, optFns ...func(*s3v2.Options)) (*s3v2.UploadPartCopyOutput, error)
+	AbortMultipartUpload(ctx context.Context, input *s3v2.AbortMultipartUploadInput, optFns ...func(*s3v2.Options)) (*s3v2.AbortMultipartUploadOutput, error)
+}
+
+var _ S3Client = (*s3v2.Client)(nil)
+
+// NewWithConfig returns a filesystem for the tree of objects rooted at the
+// specified bucket with the config of aws-sdk-go-v2.
+func NewWithConfig(bucket string, cfg awsv2.Config) *S3FS {
+	return NewWithClient(bucket, s3v2.NewFromConfig(cfg))
+}
+
+// NewWithClient returns a filesystem for the tree of objects rooted at the
+// specified bucket with the S3 client of aws-sdk-go-v2.
+func NewWithClient(bucket string, client S3Client) *S3FS {
+	return NewWithAPI(bucket, &v2API{client: client})
+}
+
+// v2API implements S3API on the S3 client of aws-sdk-go-v2.
+type v2API struct {
+	client S3Client
+}
+
+var _ S3API = (*v2API)(nil)
+
+// fromV2Error converts the API error of aws-sdk-go-v2 to awserr.Error. The
+// error of the HTTP response is converted to awserr.RequestFailure to keep
+// the status code.
+func fromV2Error(err error) error {
+	var apiErr smithy.APIError
+	if !errors.As(err, &apiErr) {
+		return err
+	}
+	awsErr := awserr.New(apiErr.ErrorCode(), apiErr.ErrorMessage(), err)
+	var respErr *awshttp.ResponseError
+	if errors.As(err, &respErr) {
+		return awserr.NewRequestFailure(awsErr, respErr.HTTPStatusCode(), respErr.ServiceRequestID())
+	}
+	return awsErr
+}
+
+// requestHeader returns the headers that are set by the request options of
+// aws-sdk-go such as request.WithSetRequestHeaders.
+func requestHeader(opts []request.Option) http.Header {
+	r := &request.Request{HTTPRequest: &http.Request{Header: http.Header{}}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r.HTTPRequest.Header
+}
+
+func int32Ptr(n *int64) *int32 {
+	if n == nil {
+		return nil
+	}
+	i := int32(*n)
+	return &i
+}
+
+func int64Ptr(n *int32) *int64 {
+	if n == nil {
+		return nil
+	}
+	i := int64(*n)
+	return &i
+}
+
+func stringPtr(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
+func toV2Metadata(m map[string]*string) map[string]string {
+	if m == nil {
+		return nil
+	}
+	return aws.StringValueMap(m)
+}
+
+func fromV2Metadata(m map[string]string) map[string]*string {
+	if m == nil {
+		return nil
+	}
+	return aws.StringMap(m)
+}
+
+// GetObjectWithContext calls GetObject of aws-sdk-go-v2.
+func (api *v2API) GetObjectWithContext(ctx aws.Context, input *s3.GetObjectInput, opts ...request.Option) (*s3.GetObjectOutput, error) {
+	output, err := api.client.GetObject(ctx, &s3v2.GetObjectInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		IfMatch:           input.IfMatch,
+		IfModifiedSince:   input.IfModifiedSince,
+		IfNoneMatch:       input.IfNoneMatch,
+		IfUnmodifiedSince: input.IfUnmodifiedSince,
+		PartNumber:        int32Ptr(input.PartNumber),
+		Range:             input.Range,
+		VersionId:         input.VersionId,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.GetObjectOutput{
+		Body:                 output.Body,
+		CacheControl:         output.CacheControl,
+		ContentDisposition:   output.ContentDisposition,
+		ContentEncoding:      output.ContentEncoding,
+		ContentLanguage:      output.ContentLanguage,
+		ContentLength:        output.ContentLength,
+		ContentRange:         output.ContentRange,
+		ContentType:          output.ContentType,
+		DeleteMarker:         output.DeleteMarker,
+		ETag:                 output.ETag,
+		LastModified:         output.LastModified,
+		Metadata:             fromV2Metadata(output.Metadata),
+		SSEKMSKeyId:          output.SSEKMSKeyId,
+		ServerSideEncryption: stringPtr(string(output.ServerSideEncryption)),
+		StorageClass:         stringPtr(string(output.StorageClass)),
+		TagCount:             int64Ptr(output.TagCount),
+		VersionId:            output.VersionId,
+	}, nil
+}
+
+// HeadObjectWithContext calls HeadObject of aws-sdk-go-v2.
+func (api *v2API) HeadObjectWithContext(ctx aws.Context, input *s3.HeadObjectInput, opts ...request.Option) (*s3.HeadObjectOutput, error) {
+	output, err := api.client.HeadObject(ctx, &s3v2.HeadObjectInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		IfMatch:           input.IfMatch,
+		IfModifiedSince:   input.IfModifiedSince,
+		IfNoneMatch:       input.IfNoneMatch,
+		IfUnmodifiedSince: input.IfUnmodifiedSince,
+		PartNumber:        int32Ptr(input.PartNumber),
+		Range:             input.Range,
+		VersionId:         input.VersionId,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.HeadObjectOutput{
+		CacheControl:         output.CacheControl,
+		ContentDisposition:   output.ContentDisposition,
+		ContentEncoding:      output.ContentEncoding,
+		ContentLanguage:      output.ContentLanguage,
+		ContentLength:        output.ContentLength,
+		ContentType:          output.ContentType,
+		DeleteMarker:         output.DeleteMarker,
+		ETag:                 output.ETag,
+		LastModified:         output.LastModified,
+		Metadata:             fromV2Metadata(output.Metadata),
+		SSEKMSKeyId:          output.SSEKMSKeyId,
+		ServerSideEncryption: stringPtr(string(output.ServerSideEncryption)),
+		StorageClass:         stringPtr(string(output.StorageClass)),
+		VersionId:            output.VersionId,
+	}, nil
+}
+
+// PutObjectWithContext calls PutObject of aws-sdk-go-v2.
+func (api *v2API) PutObjectWithContext(ctx aws.Context, input *s3.PutObjectInput, opts ...request.Option) (*s3.PutObjectOutput, error) {
+	header := requestHeader(opts)
+	output, err := api.client.PutObject(ctx, &s3v2.PutObjectInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ACL:                  types.ObjectCannedACL(aws.StringValue(input.ACL)),
+		Body:                 input.Body,
+		CacheControl:         input.CacheControl,
+		ContentDisposition:   input.ContentDisposition,
+		ContentEncoding:      input.ContentEncoding,
+		ContentLanguage:      input.ContentLanguage,
+		ContentLength:        input.ContentLength,
+		ContentMD5:           input.ContentMD5,
+		ContentType:          input.ContentType,
+		Metadata:             toV2Metadata(input.Metadata),
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		ServerSideEncryption: types.ServerSideEncryption(aws.StringValue(input.ServerSideEncryption)),
+		StorageClass:         types.StorageClass(aws.StringValue(input.StorageClass)),
+		Tagging:              input.Tagging,
+		IfMatch:              stringPtr(header.Get("If-Match")),
+		IfNoneMatch:          stringPtr(header.Get("If-None-Match")),
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.PutObjectOutput{
+		ETag:                 output.ETag,
+		SSEKMSKeyId:          output.SSEKMSKeyId,
+		ServerSideEncryption: stringPtr(string(output.ServerSideEncryption)),
+		VersionId:            output.VersionId,
+	}, nil
+}
+
+// ListObjectsV2WithContext calls ListObjectsV2 of aws-sdk-go-v2.
+func (api *v2API) ListObjectsV2WithContext(ctx aws.Context, input *s3.ListObjectsV2Input, opts ...request.Option) (*s3.ListObjectsV2Output, error) {
+	output, err := api.client.ListObjectsV2(ctx, &s3v2.ListObjectsV2Input{
+		Bucket:            input.Bucket,
+		ContinuationToken: input.ContinuationToken,
+		Delimiter:         input.Delimiter,
+		EncodingType:      types.EncodingType(aws.StringValue(input.EncodingType)),
+		MaxKeys:           int32Ptr(input.MaxKeys),
+		Prefix:            input.Prefix,
+		StartAfter:        input.StartAfter,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	v1Output := &s3.ListObjectsV2Output{
+		ContinuationToken:     output.ContinuationToken,
+		Delimiter:             output.Delimiter,
+		EncodingType:          stringPtr(string(output.EncodingType)),
+		IsTruncated:           aws.Bool(awsv2.ToBool(output.IsTruncated)),
+		KeyCount:              int64Ptr(output.KeyCount),
+		MaxKeys:               int64Ptr(output.MaxKeys),
+		Name:                  output.Name,
+		NextContinuationToken: output.NextContinuationToken,
+		Prefix:                output.Prefix,
+		StartAfter:            output.StartAfter,
+	}
+	for _, p := range output.CommonPrefixes {
+		v1Output.CommonPrefixes = append(v1Output.CommonPrefixes, &s3.CommonPrefix{
+			Prefix: p.Prefix,
+		})
+	}
+	for _, o := range output.Contents {
+		v1Output.Contents = append(v1Output.Contents, &s3.Object{
+			ETag:         o.ETag,
+			Key:          o.Key,
+			LastModified: o.LastModified,
+			Size:         o.Size,
+			StorageClass: stringPtr(string(o.StorageClass)),
+		})
+	}
+	return v1Output, nil
+}
+
+// ListObjectVersionsWithContext calls ListObjectVersions of aws-sdk-go-v2.
+func (api *v2API) ListObjectVersionsWithContext(ctx aws.Context, input *s3.ListObjectVersionsInput, opts ...request.Option) (*s3.ListObjectVersionsOutput, error) {
+	output, err := api.client.ListObjectVersions(ctx, &s3v2.ListObjectVersionsInput{
+		Bucket:          input.Bucket,
+		Delimiter:       input.Delimiter,
+		EncodingType:    types.EncodingType(aws.StringValue(input.EncodingType)),
+		KeyMarker:       input.KeyMarker,
+		MaxKeys:         int32Ptr(input.MaxKeys),
+		Prefix:          input.Prefix,
+		VersionIdMarker: input.VersionIdMarker,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	v1Output := &s3.ListObjectVersionsOutput{
+		Delimiter:           output.Delimiter,
+		EncodingType:        stringPtr(string(output.EncodingType)),
+		IsTruncated:         aws.Bool(awsv2.ToBool(output.IsTruncated)),
+		KeyMarker:           output.KeyMarker,
+		MaxKeys:             int64Ptr(output.MaxKeys),
+		Name:                output.Name,
+		NextKeyMarker:       output.NextKeyMarker,
+		NextVersionIdMarker: output.NextVersionIdMarker,
+		Prefix:              output.Prefix,
+		VersionIdMarker:     output.VersionIdMarker,
+	}
+	for _, p := range output.CommonPrefixes {
+		v1Output.CommonPrefixes = append(v1Output.CommonPrefixes, &s3.CommonPrefix{
+			Prefix: p.Prefix,
+		})
+	}
+	for _, v := range output.Versions {
+		v1Output.Versions = append(v1Output.Versions, &s3.ObjectVersion{
+			ETag:         v.ETag,
+			IsLatest:     v.IsLatest,
+			Key:          v.Key,
+			LastModified: v.LastModified,
+			Size:         v.Size,
+			StorageClass: stringPtr(string(v.StorageClass)),
+			VersionId:    v.VersionId,
+		})
+	}
+	for _, m := range output.DeleteMarkers {
+		v1Output.DeleteMarkers = append(v1Output.DeleteMarkers, &s3.DeleteMarkerEntry{
+			IsLatest:     m.IsLatest,
+			Key:          m.Key,
+			LastModified: m.LastModified,
+			VersionId:    m.VersionId,
+		})
+	}
+	return v1Output, nil
+}
+
+// DeleteObjectWithContext calls DeleteObject of aws-sdk-go-v2.
+func (api *v2API) DeleteObjectWithContext(ctx aws.Context, input *s3.DeleteObjectInput, opts ...request.Option) (*s3.DeleteObjectOutput, error) {
+	output, err := api.client.DeleteObject(ctx, &s3v2.DeleteObjectInput{
+		Bucket:    input.Bucket,
+		Key:       input.Key,
+		VersionId: input.VersionId,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.DeleteObjectOutput{
+		DeleteMarker: output.DeleteMarker,
+		VersionId:    output.VersionId,
+	}, nil
+}
+
+// DeleteObjectsWithContext calls DeleteObjects of aws-sdk-go-v2.
+func (api *v2API) DeleteObjectsWithContext(ctx aws.Context, input *s3.DeleteObjectsInput, opts ...request.Option) (*s3.DeleteObjectsOutput, error) {
+	v2Input := &s3v2.DeleteObjectsInput{
+		Bucket: input.Bucket,
+	}
+	if input.Delete != nil {
+		v2Input.Delete = &types.Delete{Quiet: input.Delete.Quiet}
+		for _, id := range input.Delete.Objects {
+			v2Input.Delete.Objects = append(v2Input.Delete.Objects, types.ObjectIdentifier{
+				Key:       id.Key,
+				VersionId: id.VersionId,
+			})
+		}
+	}
+	output, err := api.client.DeleteObjects(ctx, v2Input)
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	v1Output := &s3.DeleteObjectsOutput{}
+	for _, d := range output.Deleted {
+		v1Output.Deleted = append(v1Output.Deleted, &s3.DeletedObject{
+			DeleteMarker:          d.DeleteMarker,
+			DeleteMarkerVersionId: d.DeleteMarkerVersionId,
+			Key:                   d.Key,
+			VersionId:             d.VersionId,
+		})
+	}
+	for _, e := range output.Errors {
+		v1Output.Errors = append(v1Output.Errors, &s3.Error{
+			Code:      e.Code,
+			Key:       e.Key,
+			Message:   e.Message,
+			VersionId: e.VersionId,
+		})
+	}
+	return v1Output, nil
+}
+
+// CreateMultipartUploadWithContext calls CreateMultipartUpload of aws-sdk-go-v2.
+func (api *v2API) CreateMultipartUploadWithContext(ctx aws.Context, input *s3.CreateMultipartUploadInput, opts ...request.Option) (*s3.CreateMultipartUploadOutput, error) {
+	output, err := api.client.CreateMultipartUpload(ctx, &s3v2.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ACL:                  types.ObjectCannedACL(aws.StringValue(input.ACL)),
+		CacheControl:         input.CacheControl,
+		ContentDisposition:   input.ContentDisposition,
+		ContentEncoding:      input.ContentEncoding,
+		ContentLanguage:      input.ContentLanguage,
+		ContentType:          input.ContentType,
+		Metadata:             toV2Metadata(input.Metadata),
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		ServerSideEncryption: types.ServerSideEncryption(aws.StringValue(input.ServerSideEncryption)),
+		StorageClass:         types.StorageClass(aws.StringValue(input.StorageClass)),
+		Tagging:              input.Tagging,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.CreateMultipartUploadOutput{
+		Bucket:   output.Bucket,
+		Key:      output.Key,
+		UploadId: output.UploadId,
+	}, nil
+}
+
+// UploadPartWithContext calls UploadPart of aws-sdk-go-v2.
+func (api *v2API) UploadPartWithContext(ctx aws.Context, input *s3.UploadPartInput, opts ...request.Option) (*s3.UploadPartOutput, error) {
+	output, err := api.client.UploadPart(ctx, &s3v2.UploadPartInput{
+		Bucket:        input.Bucket,
+		Key:           input.Key,
+		Body:          input.Body,
+		ContentLength: input.ContentLength,
+		ContentMD5:    input.ContentMD5,
+		PartNumber:    int32Ptr(input.PartNumber),
+		UploadId:      input.UploadId,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.UploadPartOutput{
+		ETag: output.ETag,
+	}, nil
+}
+
+// CompleteMultipartUploadWithContext calls CompleteMultipartUpload of aws-sdk-go-v2.
+func (api *v2API) CompleteMultipartUploadWithContext(ctx aws.Context, input *s3.CompleteMultipartUploadInput, opts ...request.Option) (*s3.CompleteMultipartUploadOutput, error) {
+	header := requestHeader(opts)
+	v2Input := &s3v2.CompleteMultipartUploadInput{
+		Bucket:      input.Bucket,
+		Key:         input.Key,
+		UploadId:    input.UploadId,
+		IfMatch:     stringPtr(header.Get("If-Match")),
+		IfNoneMatch: stringPtr(header.Get("If-None-Match")),
+	}
+	if input.MultipartUpload != nil {
+		v2Input.MultipartUpload = &types.CompletedMultipartUpload{}
+		for _, p := range input.MultipartUpload.Parts {
+			v2Input.MultipartUpload.Parts = append(v2Input.MultipartUpload.Parts, types.CompletedPart{
+				ETag:       p.ETag,
+				PartNumber: int32Ptr(p.PartNumber),
+			})
+		}
+	}
+	output, err := api.client.CompleteMultipartUpload(ctx, v2Input)
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.CompleteMultipartUploadOutput{
+		Bucket:    output.Bucket,
+		ETag:      output.ETag,
+		Key:       output.Key,
+		VersionId: output.VersionId,
+	}, nil
+}
+
+// CopyObjectWithContext calls CopyObject of aws-sdk-go-v2.
+func (api *v2API) CopyObjectWithContext(ctx aws.Context, input *s3.CopyObjectInput, opts ...request.Option) (*s3.CopyObjectOutput, error) {
+	output, err := api.client.CopyObject(ctx, &s3v2.CopyObjectInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		CopySource:           input.CopySource,
+		ACL:                  types.ObjectCannedACL(aws.StringValue(input.ACL)),
+		CacheControl:         input.CacheControl,
+		ContentDisposition:   input.ContentDisposition,
+		ContentEncoding:      input.ContentEncoding,
+		ContentLanguage:      input.ContentLanguage,
+		ContentType:          input.ContentType,
+		CopySourceIfMatch:    input.CopySourceIfMatch,
+		Metadata:             toV2Metadata(input.Metadata),
+		MetadataDirective:    types.MetadataDirective(aws.StringValue(input.MetadataDirective)),
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		ServerSideEncryption: types.ServerSideEncryption(aws.StringValue(input.ServerSideEncryption)),
+		StorageClass:         types.StorageClass(aws.StringValue(input.StorageClass)),
+		Tagging:              input.Tagging,
+		TaggingDirective:     types.TaggingDirective(aws.StringValue(input.TaggingDirective)),
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	v1Output := &s3.CopyObjectOutput{
+		CopySourceVersionId: output.CopySourceVersionId,
+		VersionId:           output.VersionId,
+	}
+	if output.CopyObjectResult != nil {
+		v1Output.CopyObjectResult = &s3.CopyObjectResult{
+			ETag:         output.CopyObjectResult.ETag,
+			LastModified: output.CopyObjectResult.LastModified,
+		}
+	}
+	return v1Output, nil
+}
+
+// UploadPartCopyWithContext calls UploadPartCopy of aws-sdk-go-v2.
+func (api *v2API) UploadPartCopyWithContext(ctx aws.Context, input *s3.UploadPartCopyInput, opts ...request.Option) (*s3.UploadPartCopyOutput, error) {
+	output, err := api.client.UploadPartCopy(ctx, &s3v2.UploadPartCopyInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		CopySource:        input.CopySource,
+		CopySourceIfMatch: input.CopySourceIfMatch,
+		CopySourceRange:   input.CopySourceRange,
+		PartNumber:        int32Ptr(input.PartNumber),
+		UploadId:          input.UploadId,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	v1Output := &s3.UploadPartCopyOutput{
+		CopySourceVersionId: output.CopySourceVersionId,
+	}
+	if output.CopyPartResult != nil {
+		v1Output.CopyPartResult = &s3.CopyPartResult{
+			ETag:         output.CopyPartResult.ETag,
+			LastModified: output.CopyPartResult.LastModified,
+		}
+	}
+	return v1Output, nil
+}
+
+// AbortMultipartUploadWithContext calls AbortMultipartUpload of aws-sdk-go-v2.
+func (api *v2API) AbortMultipartUploadWithContext(ctx aws.Context, input *s3.AbortMultipartUploadInput, opts ...request.Option) (*s3.AbortMultipartUploadOutput, error) {
+	_, err := api.client.AbortMultipartUpload(ctx, &s3v2.AbortMultipartUploadInput{
+		Bucket:   input.Bucket,
+		Key:      input.Key,
+		UploadId: input.UploadId,
+	})
+	if err != nil {
+		return nil, fromV2Error(err)
+	}
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
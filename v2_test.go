@@ -0,0 +1,653 @@
+package s3fs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	awsv2 "github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
+	s3v2 "github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/jarxorg/s3fs/s3fake"
+	"github.com/jarxorg/wfs"
+	"github.com/jarxorg/wfs/wfstest"
+)
+
+// fakeClientV2 implements S3Client of aws-sdk-go-v2 on S3API for testing.
+type fakeClientV2 struct {
+	api S3API
+}
+
+var _ S3Client = (*fakeClientV2)(nil)
+
+func toV2Error(err error) error {
+	var awsErr awserr.Error
+	if !errors.As(err, &awsErr) {
+		return err
+	}
+	apiErr := &smithy.GenericAPIError{Code: awsErr.Code(), Message: awsErr.Message()}
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) {
+		return apiErr
+	}
+	// NOTE: The client of aws-sdk-go-v2 wraps the API error with the HTTP
+	// response.
+	return &awshttp.ResponseError{
+		ResponseError: &smithyhttp.ResponseError{
+			Response: &smithyhttp.Response{
+				Response: &http.Response{StatusCode: reqErr.StatusCode()},
+			},
+			Err: apiErr,
+		},
+		RequestID: reqErr.RequestID(),
+	}
+}
+
+// conditionOptions returns the request options that set the preconditions as
+// the headers.
+func conditionOptions(ifMatch, ifNoneMatch *string) []request.Option {
+	header := map[string]string{}
+	if ifMatch != nil {
+		header["If-Match"] = *ifMatch
+	}
+	if ifNoneMatch != nil {
+		header["If-None-Match"] = *ifNoneMatch
+	}
+	return []request.Option{request.WithSetRequestHeaders(header)}
+}
+
+func (c *fakeClientV2) GetObject(ctx context.Context, input *s3v2.GetObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.GetObjectOutput, error) {
+	output, err := c.api.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		IfMatch:           input.IfMatch,
+		IfModifiedSince:   input.IfModifiedSince,
+		IfNoneMatch:       input.IfNoneMatch,
+		IfUnmodifiedSince: input.IfUnmodifiedSince,
+		PartNumber:        int64Ptr(input.PartNumber),
+		Range:             input.Range,
+		VersionId:         input.VersionId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.GetObjectOutput{
+		Body:                 output.Body,
+		CacheControl:         output.CacheControl,
+		ContentEncoding:      output.ContentEncoding,
+		ContentLength:        output.ContentLength,
+		ContentRange:         output.ContentRange,
+		ContentType:          output.ContentType,
+		ETag:                 output.ETag,
+		LastModified:         output.LastModified,
+		Metadata:             toV2Metadata(output.Metadata),
+		SSEKMSKeyId:          output.SSEKMSKeyId,
+		ServerSideEncryption: types.ServerSideEncryption(aws.StringValue(output.ServerSideEncryption)),
+		StorageClass:         types.StorageClass(aws.StringValue(output.StorageClass)),
+		VersionId:            output.VersionId,
+	}, nil
+}
+
+func (c *fakeClientV2) HeadObject(ctx context.Context, input *s3v2.HeadObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.HeadObjectOutput, error) {
+	output, err := c.api.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		IfMatch:           input.IfMatch,
+		IfModifiedSince:   input.IfModifiedSince,
+		IfNoneMatch:       input.IfNoneMatch,
+		IfUnmodifiedSince: input.IfUnmodifiedSince,
+		VersionId:         input.VersionId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.HeadObjectOutput{
+		CacheControl:         output.CacheControl,
+		ContentEncoding:      output.ContentEncoding,
+		ContentLength:        output.ContentLength,
+		ContentType:          output.ContentType,
+		ETag:                 output.ETag,
+		LastModified:         output.LastModified,
+		Metadata:             toV2Metadata(output.Metadata),
+		SSEKMSKeyId:          output.SSEKMSKeyId,
+		ServerSideEncryption: types.ServerSideEncryption(aws.StringValue(output.ServerSideEncryption)),
+		StorageClass:         types.StorageClass(aws.StringValue(output.StorageClass)),
+		VersionId:            output.VersionId,
+	}, nil
+}
+
+func (c *fakeClientV2) PutObject(ctx context.Context, input *s3v2.PutObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.PutObjectOutput, error) {
+	output, err := c.api.PutObjectWithContext(ctx, &s3.PutObjectInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ACL:                  stringPtr(string(input.ACL)),
+		Body:                 aws.ReadSeekCloser(input.Body),
+		CacheControl:         input.CacheControl,
+		ContentEncoding:      input.ContentEncoding,
+		ContentType:          input.ContentType,
+		Metadata:             fromV2Metadata(input.Metadata),
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		ServerSideEncryption: stringPtr(string(input.ServerSideEncryption)),
+		StorageClass:         stringPtr(string(input.StorageClass)),
+		Tagging:              input.Tagging,
+	}, conditionOptions(input.IfMatch, input.IfNoneMatch)...)
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.PutObjectOutput{
+		ETag:      output.ETag,
+		VersionId: output.VersionId,
+	}, nil
+}
+
+func (c *fakeClientV2) ListObjectsV2(ctx context.Context, input *s3v2.ListObjectsV2Input, optFns ...func(*s3v2.Options)) (*s3v2.ListObjectsV2Output, error) {
+	output, err := c.api.ListObjectsV2WithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket:            input.Bucket,
+		ContinuationToken: input.ContinuationToken,
+		Delimiter:         input.Delimiter,
+		EncodingType:      stringPtr(string(input.EncodingType)),
+		MaxKeys:           int64Ptr(input.MaxKeys),
+		Prefix:            input.Prefix,
+		StartAfter:        input.StartAfter,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	v2Output := &s3v2.ListObjectsV2Output{
+		IsTruncated:           output.IsTruncated,
+		NextContinuationToken: output.NextContinuationToken,
+	}
+	for _, p := range output.CommonPrefixes {
+		v2Output.CommonPrefixes = append(v2Output.CommonPrefixes, types.CommonPrefix{Prefix: p.Prefix})
+	}
+	for _, o := range output.Contents {
+		v2Output.Contents = append(v2Output.Contents, types.Object{
+			ETag:         o.ETag,
+			Key:          o.Key,
+			LastModified: o.LastModified,
+			Size:         o.Size,
+		})
+	}
+	return v2Output, nil
+}
+
+func (c *fakeClientV2) ListObjectVersions(ctx context.Context, input *s3v2.ListObjectVersionsInput, optFns ...func(*s3v2.Options)) (*s3v2.ListObjectVersionsOutput, error) {
+	output, err := c.api.ListObjectVersionsWithContext(ctx, &s3.ListObjectVersionsInput{
+		Bucket:          input.Bucket,
+		Delimiter:       input.Delimiter,
+		KeyMarker:       input.KeyMarker,
+		MaxKeys:         int64Ptr(input.MaxKeys),
+		Prefix:          input.Prefix,
+		VersionIdMarker: input.VersionIdMarker,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	v2Output := &s3v2.ListObjectVersionsOutput{
+		IsTruncated:         output.IsTruncated,
+		NextKeyMarker:       output.NextKeyMarker,
+		NextVersionIdMarker: output.NextVersionIdMarker,
+	}
+	for _, p := range output.CommonPrefixes {
+		v2Output.CommonPrefixes = append(v2Output.CommonPrefixes, types.CommonPrefix{Prefix: p.Prefix})
+	}
+	for _, v := range output.Versions {
+		v2Output.Versions = append(v2Output.Versions, types.ObjectVersion{
+			ETag:         v.ETag,
+			IsLatest:     v.IsLatest,
+			Key:          v.Key,
+			LastModified: v.LastModified,
+			Size:         v.Size,
+			VersionId:    v.VersionId,
+		})
+	}
+	for _, m := range output.DeleteMarkers {
+		v2Output.DeleteMarkers = append(v2Output.DeleteMarkers, types.DeleteMarkerEntry{
+			IsLatest:     m.IsLatest,
+			Key:          m.Key,
+			LastModified: m.LastModified,
+			VersionId:    m.VersionId,
+		})
+	}
+	return v2Output, nil
+}
+
+func (c *fakeClientV2) DeleteObject(ctx context.Context, input *s3v2.DeleteObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.DeleteObjectOutput, error) {
+	_, err := c.api.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket:    input.Bucket,
+		Key:       input.Key,
+		VersionId: input.VersionId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.DeleteObjectOutput{}, nil
+}
+
+func (c *fakeClientV2) DeleteObjects(ctx context.Context, input *s3v2.DeleteObjectsInput, optFns ...func(*s3v2.Options)) (*s3v2.DeleteObjectsOutput, error) {
+	v1Input := &s3.DeleteObjectsInput{
+		Bucket: input.Bucket,
+		Delete: &s3.Delete{Quiet: input.Delete.Quiet},
+	}
+	for _, id := range input.Delete.Objects {
+		v1Input.Delete.Objects = append(v1Input.Delete.Objects, &s3.ObjectIdentifier{
+			Key:       id.Key,
+			VersionId: id.VersionId,
+		})
+	}
+	output, err := c.api.DeleteObjectsWithContext(ctx, v1Input)
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	v2Output := &s3v2.DeleteObjectsOutput{}
+	for _, e := range output.Errors {
+		v2Output.Errors = append(v2Output.Errors, types.Error{
+			Code:      e.Code,
+			Key:       e.Key,
+			Message:   e.Message,
+			VersionId: e.VersionId,
+		})
+	}
+	return v2Output, nil
+}
+
+func (c *fakeClientV2) CreateMultipartUpload(ctx context.Context, input *s3v2.CreateMultipartUploadInput, optFns ...func(*s3v2.Options)) (*s3v2.CreateMultipartUploadOutput, error) {
+	output, err := c.api.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		ACL:                  stringPtr(string(input.ACL)),
+		CacheControl:         input.CacheControl,
+		ContentEncoding:      input.ContentEncoding,
+		ContentType:          input.ContentType,
+		Metadata:             fromV2Metadata(input.Metadata),
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		ServerSideEncryption: stringPtr(string(input.ServerSideEncryption)),
+		StorageClass:         stringPtr(string(input.StorageClass)),
+		Tagging:              input.Tagging,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.CreateMultipartUploadOutput{
+		Bucket:   output.Bucket,
+		Key:      output.Key,
+		UploadId: output.UploadId,
+	}, nil
+}
+
+func (c *fakeClientV2) UploadPart(ctx context.Context, input *s3v2.UploadPartInput, optFns ...func(*s3v2.Options)) (*s3v2.UploadPartOutput, error) {
+	output, err := c.api.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:     input.Bucket,
+		Key:        input.Key,
+		Body:       aws.ReadSeekCloser(input.Body),
+		PartNumber: int64Ptr(input.PartNumber),
+		UploadId:   input.UploadId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.UploadPartOutput{ETag: output.ETag}, nil
+}
+
+func (c *fakeClientV2) CompleteMultipartUpload(ctx context.Context, input *s3v2.CompleteMultipartUploadInput, optFns ...func(*s3v2.Options)) (*s3v2.CompleteMultipartUploadOutput, error) {
+	upload := &s3.CompletedMultipartUpload{}
+	for _, p := range input.MultipartUpload.Parts {
+		upload.Parts = append(upload.Parts, &s3.CompletedPart{
+			ETag:       p.ETag,
+			PartNumber: int64Ptr(p.PartNumber),
+		})
+	}
+	output, err := c.api.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          input.Bucket,
+		Key:             input.Key,
+		UploadId:        input.UploadId,
+		MultipartUpload: upload,
+	}, conditionOptions(input.IfMatch, input.IfNoneMatch)...)
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.CompleteMultipartUploadOutput{
+		ETag:      output.ETag,
+		VersionId: output.VersionId,
+	}, nil
+}
+
+func (c *fakeClientV2) CopyObject(ctx context.Context, input *s3v2.CopyObjectInput, optFns ...func(*s3v2.Options)) (*s3v2.CopyObjectOutput, error) {
+	output, err := c.api.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+		Bucket:               input.Bucket,
+		Key:                  input.Key,
+		CopySource:           input.CopySource,
+		ACL:                  stringPtr(string(input.ACL)),
+		CacheControl:         input.CacheControl,
+		ContentEncoding:      input.ContentEncoding,
+		ContentType:          input.ContentType,
+		CopySourceIfMatch:    input.CopySourceIfMatch,
+		Metadata:             fromV2Metadata(input.Metadata),
+		MetadataDirective:    stringPtr(string(input.MetadataDirective)),
+		SSEKMSKeyId:          input.SSEKMSKeyId,
+		ServerSideEncryption: stringPtr(string(input.ServerSideEncryption)),
+		StorageClass:         stringPtr(string(input.StorageClass)),
+		Tagging:              input.Tagging,
+		TaggingDirective:     stringPtr(string(input.TaggingDirective)),
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{
+			ETag:         output.CopyObjectResult.ETag,
+			LastModified: output.CopyObjectResult.LastModified,
+		},
+	}, nil
+}
+
+func (c *fakeClientV2) UploadPartCopy(ctx context.Context, input *s3v2.UploadPartCopyInput, optFns ...func(*s3v2.Options)) (*s3v2.UploadPartCopyOutput, error) {
+	output, err := c.api.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+		Bucket:            input.Bucket,
+		Key:               input.Key,
+		CopySource:        input.CopySource,
+		CopySourceIfMatch: input.CopySourceIfMatch,
+		CopySourceRange:   input.CopySourceRange,
+		PartNumber:        int64Ptr(input.PartNumber),
+		UploadId:          input.UploadId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.UploadPartCopyOutput{
+		CopyPartResult: &types.CopyPartResult{ETag: output.CopyPartResult.ETag},
+	}, nil
+}
+
+func (c *fakeClientV2) AbortMultipartUpload(ctx context.Context, input *s3v2.AbortMultipartUploadInput, optFns ...func(*s3v2.Options)) (*s3v2.AbortMultipartUploadOutput, error) {
+	_, err := c.api.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   input.Bucket,
+		Key:      input.Key,
+		UploadId: input.UploadId,
+	})
+	if err != nil {
+		return nil, toV2Error(err)
+	}
+	return &s3v2.AbortMultipartUploadOutput{}, nil
+}
+
+func newV2FSTesting(t *testing.T) (*S3FS, *mockFSS3API) {
+	api := newMockFSS3APITesting(t)
+	return NewWithClient("testdata", &fakeClientV2{api: api}), api
+}
+
+func TestFS_V2(t *testing.T) {
+	fsys, _ := newV2FSTesting(t)
+	if err := fstest.TestFS(fsys, "dir0", "dir0/file01.txt"); err != nil {
+		t.Errorf("Error testing/fstest: %+v", err)
+	}
+}
+
+func TestWriteFileFS_V2(t *testing.T) {
+	fsys, _ := newV2FSTesting(t)
+	tmpDir := "test"
+	if err := wfs.MkdirAll(fsys, tmpDir, fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := wfstest.TestWriteFileFS(fsys, tmpDir); err != nil {
+		t.Errorf("Error wfstest: %+v", err)
+	}
+}
+
+func TestWriteFile_MultipartV2(t *testing.T) {
+	fsys, api := newV2FSTesting(t)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+
+	want := strings.Repeat("0123456789", 3)
+	if _, err := fsys.WriteFile("multipart.txt", []byte(want), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("multipart.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Error ReadFile got %s; want %s", got, want)
+	}
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+}
+
+func TestStat_NotExistV2(t *testing.T) {
+	fsys, _ := newV2FSTesting(t)
+	if _, err := fsys.Stat("not-found.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat error got %v; want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.Open("not-found.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Open error got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestFromV2Error(t *testing.T) {
+	err := fromV2Error(&types.NoSuchKey{Message: awsv2.String("test")})
+	if !isS3NoSuchKey(err) {
+		t.Errorf("Error fromV2Error got %v; want %s", err, s3.ErrCodeNoSuchKey)
+	}
+	err = fromV2Error(&types.NotFound{})
+	if !isS3NoSuchKey(err) {
+		t.Errorf("Error fromV2Error got %v; want %s", err, errCodeNotFound)
+	}
+	err = fromV2Error(toV2Error(awserr.NewRequestFailure(
+		awserr.New("PreconditionFailed", "test", nil), http.StatusPreconditionFailed, "id")))
+	var reqErr awserr.RequestFailure
+	if !errors.As(err, &reqErr) || reqErr.StatusCode() != http.StatusPreconditionFailed || reqErr.RequestID() != "id" {
+		t.Errorf("Error fromV2Error got %v; want %d", err, http.StatusPreconditionFailed)
+	}
+	wantErr := errors.New("test")
+	if err := fromV2Error(wantErr); err != wantErr {
+		t.Errorf("Error fromV2Error got %v; want %v", err, wantErr)
+	}
+}
+
+func TestListObjectVersions_V2(t *testing.T) {
+	fsys, api := newV2FSTesting(t)
+	if err := api.EnableVersioning(); err != nil {
+		t.Fatal(err)
+	}
+	name := "dir0/file01.txt"
+	if _, err := fsys.WriteFile(name, []byte("v1"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveFile(name); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fsys.ListObjectVersions(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || !versions[0].IsDeleteMarker {
+		t.Fatalf("Error ListObjectVersions got %+v", versions)
+	}
+	f, err := fsys.OpenVersion(name, versions[1].VersionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	got, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v1" {
+		t.Errorf("Error OpenVersion read %s; want v1", got)
+	}
+}
+
+func TestCopy_MultipartV2(t *testing.T) {
+	defer func(size int64) { maxCopyObjectSize = size }(maxCopyObjectSize)
+	maxCopyObjectSize = 4
+
+	fsys, api := newV2FSTesting(t)
+	fsys.PartSize = 4
+	fsys.minPartSize = 1
+	opts := &WriteOptions{
+		ContentType: "application/x-test",
+		Metadata:    map[string]string{"k": "v"},
+	}
+	want := strings.Repeat("0123456789", 2)
+	if _, err := fsys.WriteFileWithOptions("large.txt", []byte(want), fs.ModePerm, opts); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Copy("large.txt", "large-copy.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.Rename("large-copy.txt", "large-renamed.txt"); err != nil {
+		t.Fatal(err)
+	}
+	got, err := fsys.ReadFile("large-renamed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != want {
+		t.Errorf("Error Copy got %s; want %s", got, want)
+	}
+	info, err := fsys.Stat("large-renamed.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sys := info.Sys().(*ObjectInfo)
+	if sys.ContentType != opts.ContentType || !reflect.DeepEqual(sys.Metadata, opts.Metadata) {
+		t.Errorf("Error Copy Sys got %+v; want %+v", sys, opts)
+	}
+	if _, err := fsys.Stat("large-copy.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat after Rename got %v; want %v", err, fs.ErrNotExist)
+	}
+	if n := api.numUploads(t, "testdata"); n != 0 {
+		t.Errorf("Error remaining uploads %d; want 0", n)
+	}
+}
+
+func TestRemoveAll_KeyErrorsV2(t *testing.T) {
+	_, api := newDeleteObjectsFSTesting(t, 4)
+	fsys := NewWithClient("bucket", &fakeClientV2{api: api})
+	api.InjectFault(s3fake.Fault{
+		Op:  "DeleteObjects",
+		Key: "dir/file0001.txt",
+		Err: awserr.New("AccessDenied", "Access Denied", nil),
+	})
+
+	err := fsys.RemoveAll("dir")
+	var removeErr *RemoveAllError
+	if !errors.As(err, &removeErr) {
+		t.Fatalf("Error RemoveAll error got %v; want *RemoveAllError", err)
+	}
+	if len(removeErr.Errors) != 1 {
+		t.Fatalf("Error RemoveAllError has %d errors; want 1", len(removeErr.Errors))
+	}
+	if e := removeErr.Errors[0]; e.Key != "dir/file0001.txt" || e.Code != "AccessDenied" {
+		t.Errorf("Error unexpected DeleteError %v", e)
+	}
+	entries, err := fsys.ReadDir("dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("Error remaining entries %d; want 1", len(entries))
+	}
+}
+
+func TestS3File_ReadAtV2(t *testing.T) {
+	_, api := newCountFSTesting(t, map[string][]byte{"a.txt": []byte("0123456789")})
+	fsys := NewWithClient("bucket", &fakeClientV2{api: api})
+	var ranges []string
+	api.before = func(op string, input interface{}) error {
+		if input, ok := input.(*s3.GetObjectInput); ok && input.Range != nil {
+			ranges = append(ranges, *input.Range)
+		}
+		return nil
+	}
+
+	f, err := fsys.Open("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	readerAt := f.(io.ReaderAt)
+
+	p := make([]byte, 3)
+	if n, err := readerAt.ReadAt(p, 2); err != nil || string(p[:n]) != "234" {
+		t.Errorf("Error ReadAt got %q, %v; want %q", p[:n], err, "234")
+	}
+	p = make([]byte, 10)
+	if n, err := readerAt.ReadAt(p, 5); err != io.EOF || string(p[:n]) != "56789" {
+		t.Errorf("Error ReadAt got %q, %v; want %q, %v", p[:n], err, "56789", io.EOF)
+	}
+	if _, err := f.(io.Seeker).Seek(7, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := io.ReadAll(f); err != nil || string(got) != "789" {
+		t.Errorf("Error Read after Seek got %q, %v; want %q", got, err, "789")
+	}
+	if len(ranges) == 0 {
+		t.Errorf("Error ranged GetObject requests got none")
+	}
+}
+
+func TestConditionalErrors_V2(t *testing.T) {
+	_, api := newCountFSTesting(t, map[string][]byte{"a.txt": []byte("aaaa")})
+	fsys := NewWithClient("bucket", &fakeClientV2{api: api})
+	info, err := fsys.Stat("a.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	etag := info.Sys().(*ObjectInfo).ETag
+
+	_, err = fsys.client().GetObjectWithContext(fsys.context(), &s3.GetObjectInput{
+		Bucket:      aws.String("bucket"),
+		Key:         aws.String("a.txt"),
+		IfNoneMatch: aws.String(etag),
+	})
+	var reqErr awserr.RequestFailure
+	if !isNotModified(err) || !errors.As(err, &reqErr) || reqErr.StatusCode() != http.StatusNotModified {
+		t.Errorf("Error GetObject error got %v; want %d", err, http.StatusNotModified)
+	}
+	_, err = fsys.client().GetObjectWithContext(fsys.context(), &s3.GetObjectInput{
+		Bucket:  aws.String("bucket"),
+		Key:     aws.String("a.txt"),
+		IfMatch: aws.String(`"other"`),
+	})
+	if !isPreconditionFailed(err) || !errors.As(err, &reqErr) || reqErr.StatusCode() != http.StatusPreconditionFailed {
+		t.Errorf("Error GetObject error got %v; want %d", err, http.StatusPreconditionFailed)
+	}
+}
+
+func TestDiskCache_V2(t *testing.T) {
+	cached, api := newDiskCacheFSTesting(t, 0)
+	fsys := NewWithClient("bucket", &fakeClientV2{api: api})
+	fsys.DiskCache = cached.DiskCache
+
+	for i := 0; i < 3; i++ {
+		got, err := fsys.ReadFile("a.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "aaaa" {
+			t.Errorf("Error ReadFile got %s; want %s", got, "aaaa")
+		}
+	}
+	if n := api.count("GetObject"); n != 3 {
+		t.Errorf("Error GetObject requests %d; want %d", n, 3)
+	}
+	if n := api.countSucceeded("GetObject"); n != 1 {
+		t.Errorf("Error downloads %d; want %d", n, 1)
+	}
+}
@@ -0,0 +1,362 @@
+package s3fs
+
+import (
+	"errors"
+	"io/fs"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// ObjectVersion represents a version or a delete marker of an object on a
+// versioned bucket.
+type ObjectVersion struct {
+	Key            string
+	VersionID      string
+	ETag           string
+	Size           int64
+	LastModified   time.Time
+	StorageClass   string
+	IsLatest       bool
+	IsDeleteMarker bool
+}
+
+func newObjectVersion(v *s3.ObjectVersion) *ObjectVersion {
+	return &ObjectVersion{
+		Key:          aws.StringValue(v.Key),
+		VersionID:    aws.StringValue(v.VersionId),
+		ETag:         aws.StringValue(v.ETag),
+		Size:         aws.Int64Value(v.Size),
+		LastModified: aws.TimeValue(v.LastModified),
+		StorageClass: storageClass(v.StorageClass),
+		IsLatest:     aws.BoolValue(v.IsLatest),
+	}
+}
+
+func newDeleteMarkerVersion(m *s3.DeleteMarkerEntry) *ObjectVersion {
+	return &ObjectVersion{
+		Key:            aws.StringValue(m.Key),
+		VersionID:      aws.StringValue(m.VersionId),
+		LastModified:   aws.TimeValue(m.LastModified),
+		IsLatest:       aws.BoolValue(m.IsLatest),
+		IsDeleteMarker: true,
+	}
+}
+
+// sortVersions sorts the versions of each key in the order of newest first.
+func sortVersions(versions []*ObjectVersion) {
+	sort.SliceStable(versions, func(i, j int) bool {
+		vi, vj := versions[i], versions[j]
+		if vi.Key != vj.Key {
+			return vi.Key < vj.Key
+		}
+		return newerVersion(vi, vj)
+	})
+}
+
+// newerVersion reports whether v is newer than r of the same key. The versions
+// and the delete markers are listed separately, so on the same LastModified
+// the latest one is newer, otherwise the delete marker is newer.
+func newerVersion(v, r *ObjectVersion) bool {
+	if v.IsLatest != r.IsLatest {
+		return v.IsLatest
+	}
+	if !v.LastModified.Equal(r.LastModified) {
+		return v.LastModified.After(r.LastModified)
+	}
+	return v.IsDeleteMarker && !r.IsDeleteMarker
+}
+
+// errStopListing is returned by the function of listObjectVersions to stop the
+// listing.
+var errStopListing = errors.New("stop listing")
+
+// listObjectVersions calls fn with each page of the versions and the delete
+// markers under the prefix.
+func (fsys *S3FS) listObjectVersions(prefix string, fn func(versions []*ObjectVersion) error) error {
+	input := &s3.ListObjectVersionsInput{
+		Bucket:  aws.String(fsys.bucket),
+		Prefix:  aws.String(prefix),
+		MaxKeys: aws.Int64(int64(fsys.ListBufferSize)),
+	}
+	for {
+		if err := fsys.context().Err(); err != nil {
+			return err
+		}
+		output, err := fsys.listObjectVersionsPage(input)
+		if err != nil {
+			return err
+		}
+		var versions []*ObjectVersion
+		for _, v := range output.Versions {
+			versions = append(versions, newObjectVersion(v))
+		}
+		for _, m := range output.DeleteMarkers {
+			versions = append(versions, newDeleteMarkerVersion(m))
+		}
+		if len(versions) > 0 {
+			if err := fn(versions); err != nil {
+				return err
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) {
+			return nil
+		}
+		input.KeyMarker = output.NextKeyMarker
+		input.VersionIdMarker = output.NextVersionIdMarker
+	}
+}
+
+// ListObjectVersions returns the versions and the delete markers of the named
+// file in the order of newest first.
+func (fsys *S3FS) ListObjectVersions(name string) ([]*ObjectVersion, error) {
+	if !fs.ValidPath(name) || name == "." {
+		return nil, toPathError(fs.ErrInvalid, "ListObjectVersions", name)
+	}
+	key := fsys.key(name)
+	var versions []*ObjectVersion
+	err := fsys.listObjectVersions(key, func(page []*ObjectVersion) error {
+		for _, v := range page {
+			if v.Key == key {
+				versions = append(versions, v)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, toPathError(err, "ListObjectVersions", name)
+	}
+	if len(versions) == 0 {
+		return nil, toPathError(fs.ErrNotExist, "ListObjectVersions", name)
+	}
+	sortVersions(versions)
+	return versions, nil
+}
+
+// OpenVersion opens the specified version of the named file. The reads of the
+// returned file are pinned to the version.
+func (fsys *S3FS) OpenVersion(name, versionID string) (fs.File, error) {
+	if !fs.ValidPath(name) || versionID == "" {
+		return nil, toPathError(fs.ErrInvalid, "OpenVersion", name)
+	}
+	input := &s3.GetObjectInput{
+		Bucket:    aws.String(fsys.bucket),
+		Key:       aws.String(fsys.key(name)),
+		VersionId: aws.String(versionID),
+	}
+	output, err := fsys.client().GetObjectWithContext(fsys.context(), input)
+	if err != nil {
+		return nil, toPathError(err, "OpenVersion", name)
+	}
+	f := newS3File(fsys, name, output)
+	f.versionID = versionID
+	return f, nil
+}
+
+// StatVersion returns a FileInfo describing the specified version of the
+// named file.
+func (fsys *S3FS) StatVersion(name, versionID string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) || versionID == "" {
+		return nil, toPathError(fs.ErrInvalid, "StatVersion", name)
+	}
+	key := fsys.key(name)
+	input := &s3.HeadObjectInput{
+		Bucket:    aws.String(fsys.bucket),
+		Key:       aws.String(key),
+		VersionId: aws.String(versionID),
+	}
+	output, err := fsys.client().HeadObjectWithContext(fsys.context(), input)
+	if err != nil {
+		return nil, toPathError(err, "StatVersion", name)
+	}
+	return newHeadContent(fsys.bucket, key, output), nil
+}
+
+// RestoreVersion restores the specified version of the named file as the
+// latest version by copying it on the server side. The other versions are
+// kept.
+func (fsys *S3FS) RestoreVersion(name, versionID string) error {
+	info, err := fsys.StatVersion(name, versionID)
+	if err != nil {
+		return toPathError(err, "RestoreVersion", name)
+	}
+	key := fsys.key(name)
+	if err := fsys.copyObjectVersion(key, versionID, key, info.Size()); err != nil {
+		return toPathError(err, "RestoreVersion", name)
+	}
+	return nil
+}
+
+// copySourceVersion returns the URL-encoded CopySource of the specified
+// version.
+func copySourceVersion(bucket, key, versionID string) string {
+	source := copySource(bucket, key)
+	if versionID == "" {
+		return source
+	}
+	return source + "?versionId=" + url.QueryEscape(versionID)
+}
+
+// AsOf returns a read-only filesystem that shows the files as they were at the
+// specified time. Each file is resolved to the newest version that was last
+// modified at or before t. Opening a directory lists all versions under the
+// directory, so the returned filesystem is intended for the buckets with
+// versioning enabled and is expensive for large trees.
+func (fsys *S3FS) AsOf(t time.Time) fs.FS {
+	return &asOfFS{fsys: fsys, t: t}
+}
+
+// asOfFS represents the filesystem at a point in time.
+type asOfFS struct {
+	fsys *S3FS
+	t    time.Time
+}
+
+var (
+	_ fs.FS        = (*asOfFS)(nil)
+	_ fs.ReadDirFS = (*asOfFS)(nil)
+	_ fs.StatFS    = (*asOfFS)(nil)
+)
+
+// resolve returns the versions of the keys under the prefix that were the
+// latest at the time. The deleted keys are not returned. If exact is true then
+// only the key of the prefix is resolved, and the listing stops at the page
+// that has the next key.
+func (a *asOfFS) resolve(prefix string, exact bool) (map[string]*ObjectVersion, error) {
+	resolved := map[string]*ObjectVersion{}
+	err := a.fsys.listObjectVersions(prefix, func(versions []*ObjectVersion) error {
+		next := false
+		for _, v := range versions {
+			if exact && v.Key != prefix {
+				next = true
+				continue
+			}
+			if v.LastModified.After(a.t) {
+				continue
+			}
+			if r, ok := resolved[v.Key]; !ok || newerVersion(v, r) {
+				resolved[v.Key] = v
+			}
+		}
+		if next {
+			return errStopListing
+		}
+		return nil
+	})
+	if err != nil && err != errStopListing {
+		return nil, err
+	}
+	for key, v := range resolved {
+		if v.IsDeleteMarker {
+			delete(resolved, key)
+		}
+	}
+	return resolved, nil
+}
+
+// fileVersion returns the version of the named file at the time. The keys are
+// listed in order, so the listing stops before the siblings such as "foobar"
+// of "foo" and the files under the directory "foo/".
+func (a *asOfFS) fileVersion(name string) (*ObjectVersion, error) {
+	if name == "." {
+		return nil, nil
+	}
+	key := a.fsys.key(name)
+	resolved, err := a.resolve(key, true)
+	if err != nil {
+		return nil, err
+	}
+	return resolved[key], nil
+}
+
+// readDir returns the entries of the named directory at the time.
+func (a *asOfFS) readDir(name string) ([]fs.DirEntry, error) {
+	prefix := a.fsys.prefix(name)
+	resolved, err := a.resolve(prefix, false)
+	if err != nil {
+		return nil, err
+	}
+	var entries []fs.DirEntry
+	dirs := map[string]bool{}
+	marker := false
+	for key, v := range resolved {
+		rel := strings.TrimPrefix(key, prefix)
+		if rel == "" {
+			// NOTE: The directory marker keeps the directory but is not a file.
+			marker = true
+			continue
+		}
+		if i := strings.Index(rel, "/"); i != -1 {
+			if !dirs[rel[:i]] {
+				dirs[rel[:i]] = true
+				entries = append(entries, newDirContent(prefix+rel[:i]))
+			}
+			continue
+		}
+		entries = append(entries, newVersionContent(a.fsys.bucket, v))
+	}
+	if len(entries) == 0 && !marker && name != "." {
+		return nil, fs.ErrNotExist
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// Open opens the named file or directory as it was at the time.
+func (a *asOfFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, toPathError(fs.ErrInvalid, "Open", name)
+	}
+	v, err := a.fileVersion(name)
+	if err != nil {
+		return nil, toPathError(err, "Open", name)
+	}
+	if v != nil {
+		return a.fsys.OpenVersion(name, v.VersionID)
+	}
+	entries, err := a.readDir(name)
+	if err != nil {
+		return nil, toPathError(err, "Open", name)
+	}
+	d := newS3Dir(a.fsys, name)
+	d.cache = entries
+	d.eof = true
+	return d, nil
+}
+
+// ReadDir reads the named directory as it was at the time.
+func (a *asOfFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if !fs.ValidPath(name) {
+		return nil, toPathError(fs.ErrInvalid, "ReadDir", name)
+	}
+	entries, err := a.readDir(name)
+	if err != nil {
+		return nil, toPathError(err, "ReadDir", name)
+	}
+	return entries, nil
+}
+
+// Stat returns a FileInfo describing the named file or directory as it was at
+// the time.
+func (a *asOfFS) Stat(name string) (fs.FileInfo, error) {
+	if !fs.ValidPath(name) {
+		return nil, toPathError(fs.ErrInvalid, "Stat", name)
+	}
+	v, err := a.fileVersion(name)
+	if err != nil {
+		return nil, toPathError(err, "Stat", name)
+	}
+	if v != nil {
+		return newVersionContent(a.fsys.bucket, v), nil
+	}
+	if _, err := a.readDir(name); err != nil {
+		return nil, toPathError(err, "Stat", name)
+	}
+	return newDirContent(a.fsys.prefix(name)), nil
+}
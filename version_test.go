@@ -0,0 +1,363 @@
+package s3fs
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// newVersionedFSTesting returns the versioned S3FS and the clock of the API
+// that advances a minute every call.
+func newVersionedFSTesting(t *testing.T) (*S3FS, func() time.Time) {
+	api := newMockFSS3APITesting(t)
+	if err := api.EnableVersioning(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().Add(time.Hour).Truncate(time.Second)
+	clock := func() time.Time {
+		now = now.Add(time.Minute)
+		return now
+	}
+	api.SetClock(clock)
+	return NewWithAPI("testdata", api), clock
+}
+
+func TestListObjectVersions(t *testing.T) {
+	fsys, _ := newVersionedFSTesting(t)
+	name := "dir0/file01.txt"
+	for _, p := range []string{"v1", "v2"} {
+		if _, err := fsys.WriteFile(name, []byte(p), fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := fsys.RemoveFile(name); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := fsys.ListObjectVersions(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 4 {
+		t.Fatalf("Error ListObjectVersions got %d versions; want 4", len(versions))
+	}
+	if !versions[0].IsDeleteMarker || !versions[0].IsLatest {
+		t.Errorf("Error versions[0] got %+v; want the latest delete marker", versions[0])
+	}
+	if versions[1].Size != 2 || versions[1].IsDeleteMarker || versions[1].IsLatest {
+		t.Errorf("Error versions[1] got %+v", versions[1])
+	}
+	if versions[3].VersionID != "null" {
+		t.Errorf("Error versions[3] VersionID got %s; want null", versions[3].VersionID)
+	}
+	for i := 1; i < len(versions); i++ {
+		if versions[i].LastModified.After(versions[i-1].LastModified) {
+			t.Errorf("Error versions are not sorted by newest first: %+v", versions)
+		}
+	}
+
+	if _, err := fsys.ListObjectVersions("dir0/not-found.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error ListObjectVersions error got %v; want %v", err, fs.ErrNotExist)
+	}
+}
+
+func TestOpenVersion(t *testing.T) {
+	fsys, _ := newVersionedFSTesting(t)
+	name := "test.txt"
+	if _, err := fsys.WriteFile(name, []byte("version1"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := fsys.ListObjectVersions(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	versionID := versions[0].VersionID
+	if _, err := fsys.WriteFile(name, []byte("version2"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fsys.OpenVersion(name, versionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	p := make([]byte, 4)
+	if _, err := io.ReadFull(f, p); err != nil {
+		t.Fatal(err)
+	}
+	// NOTE: Seek reopens the body by a ranged request that is pinned to the version.
+	if _, err := f.(io.Seeker).Seek(2, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	rest, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(p) != "vers" || string(rest) != "rsion1" {
+		t.Errorf("Error OpenVersion read %q and %q; want %q and %q", p, rest, "vers", "rsion1")
+	}
+
+	info, err := fsys.StatVersion(name, versionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := info.Sys().(*ObjectInfo).VersionID; got != versionID {
+		t.Errorf("Error StatVersion VersionID got %s; want %s", got, versionID)
+	}
+	if _, err := fsys.StatVersion(name, "unknown"); err == nil {
+		t.Errorf("Error StatVersion unknown version returns no error")
+	}
+	if _, err := fsys.OpenVersion(name, ""); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Error OpenVersion error got %v; want %v", err, fs.ErrInvalid)
+	}
+}
+
+func TestRestoreVersion(t *testing.T) {
+	orig := maxCopyObjectSize
+	defer func() { maxCopyObjectSize = orig }()
+
+	for _, maxSize := range []int64{orig, 4} {
+		maxCopyObjectSize = maxSize
+		fsys, _ := newVersionedFSTesting(t)
+		fsys.PartSize = 4
+		fsys.minPartSize = 1
+		name := "test.txt"
+		if _, err := fsys.WriteFile(name, []byte("version1"), fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		versions, err := fsys.ListObjectVersions(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fsys.WriteFile(name, []byte("version2"), fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+		if err := fsys.RestoreVersion(name, versions[0].VersionID); err != nil {
+			t.Fatal(err)
+		}
+		got, err := fsys.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != "version1" {
+			t.Errorf("Error RestoreVersion got %s; want version1", got)
+		}
+		versions, err = fsys.ListObjectVersions(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(versions) != 3 {
+			t.Errorf("Error ListObjectVersions got %d versions; want 3", len(versions))
+		}
+	}
+}
+
+func TestAsOf(t *testing.T) {
+	fsys, now := newVersionedFSTesting(t)
+	if _, err := fsys.WriteFile("dir0/file01.txt", []byte("v1"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.WriteFile("dir1/file11.txt", []byte("v1"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	t1 := now()
+	if _, err := fsys.WriteFile("dir0/file01.txt", []byte("v2"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveAll("dir1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveFile("file0.txt"); err != nil {
+		t.Fatal(err)
+	}
+	t2 := now()
+
+	asOf1 := fsys.AsOf(t1)
+	if err := fstest.TestFS(asOf1, "file0.txt", "dir0/file01.txt", "dir1/file11.txt"); err != nil {
+		t.Errorf("Error testing/fstest: %+v", err)
+	}
+	got, err := fs.ReadFile(asOf1, "dir0/file01.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "v1" {
+		t.Errorf("Error ReadFile as of t1 got %s; want v1", got)
+	}
+
+	asOf2 := fsys.AsOf(t2)
+	if err := fstest.TestFS(asOf2, "file1.txt", "dir0/file01.txt"); err != nil {
+		t.Errorf("Error testing/fstest: %+v", err)
+	}
+	for _, name := range []string{"file0.txt", "dir1", "dir1/file11.txt"} {
+		if _, err := fs.Stat(asOf2, name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Error Stat %s as of t2 error got %v; want %v", name, err, fs.ErrNotExist)
+		}
+	}
+}
+
+func TestAsOf_SameTime(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	if err := api.EnableVersioning(); err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Now().Add(time.Hour).Truncate(time.Second)
+	now := t1
+	api.SetClock(func() time.Time { return now })
+	fsys := NewWithAPI("testdata", api)
+
+	// NOTE: The version and the delete marker have the same LastModified.
+	if _, err := fsys.WriteFile("tie.txt", []byte("v1"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveFile("tie.txt"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys.AsOf(t1), "tie.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat as of t1 error got %v; want %v", err, fs.ErrNotExist)
+	}
+
+	// NOTE: The delete marker is not the latest.
+	now = t1.Add(time.Minute)
+	if _, err := fsys.WriteFile("tie.txt", []byte("v2"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Stat(fsys.AsOf(t1), "tie.txt"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Error Stat as of t1 error got %v; want %v", err, fs.ErrNotExist)
+	}
+	if got, err := fs.ReadFile(fsys.AsOf(now), "tie.txt"); err != nil || string(got) != "v2" {
+		t.Errorf("Error ReadFile as of t2 got %q, %v; want %q", got, err, "v2")
+	}
+	versions, err := fsys.ListObjectVersions("tie.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 3 || versions[0].IsDeleteMarker || !versions[1].IsDeleteMarker {
+		t.Errorf("Error ListObjectVersions got %+v; want v2, the delete marker and v1", versions)
+	}
+}
+
+func TestAsOf_Listings(t *testing.T) {
+	api := newCountAPI(newMemFSTesting(t))
+	if err := api.EnableVersioning(); err != nil {
+		t.Fatal(err)
+	}
+	fsys := NewWithAPI("testdata", api)
+	fsys.ListBufferSize = 2
+	for _, name := range []string{"foo", "foobar0", "foobar1", "foobar2", "dir/a.txt", "dir/b.txt", "dir/c.txt", "dir/d.txt"} {
+		if _, err := fsys.WriteFile(name, []byte(name), fs.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	asOf := fsys.AsOf(time.Now().Add(time.Hour))
+
+	// NOTE: The siblings of "foo" are not listed after the first page.
+	api.reset()
+	if got, err := fs.ReadFile(asOf, "foo"); err != nil || string(got) != "foo" {
+		t.Errorf("Error ReadFile got %q, %v; want %q", got, err, "foo")
+	}
+	if n := api.count("ListObjectVersions"); n != 1 {
+		t.Errorf("Error ListObjectVersions requests %d; want %d", n, 1)
+	}
+
+	// NOTE: The files under the directory are listed by the 2 pages of the
+	// directory after the first page of the file.
+	api.reset()
+	entries, err := fs.ReadDir(asOf, "dir")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 4 {
+		t.Errorf("Error ReadDir got %d entries; want %d", len(entries), 4)
+	}
+	if _, err := fs.Stat(asOf, "dir"); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.count("ListObjectVersions"); n != 2+1+2 {
+		t.Errorf("Error ListObjectVersions requests %d; want %d", n, 2+1+2)
+	}
+}
+
+func TestAsOf_DirMarkers(t *testing.T) {
+	fsys, api := newCountFSTesting(t, nil)
+	if err := api.EnableVersioning(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fsys.WriteFile("mk/sub/a.txt", []byte("a"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	t1 := time.Now().Add(time.Hour)
+	// NOTE: The markers are versioned on S3 but not on s3fake.
+	api.after = func(op string, input, output interface{}) {
+		prefix := aws.StringValue(input.(*s3.ListObjectVersionsInput).Prefix)
+		for _, key := range []string{"mk/sub/", "mk/empty/"} {
+			if strings.HasPrefix(key, prefix) {
+				o := output.(*s3.ListObjectVersionsOutput)
+				o.Versions = append(o.Versions, &s3.ObjectVersion{
+					Key:          aws.String(key),
+					VersionId:    aws.String("marker"),
+					ETag:         aws.String(`"d41d8cd98f00b204e9800998ecf8427e"`),
+					Size:         aws.Int64(0),
+					IsLatest:     aws.Bool(true),
+					LastModified: aws.Time(time.Now()),
+				})
+			}
+		}
+	}
+	asOf := fsys.AsOf(t1)
+
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{name: "mk", want: []string{"empty", "sub"}},
+		{name: "mk/sub", want: []string{"a.txt"}},
+		{name: "mk/empty", want: nil},
+	}
+	for _, test := range tests {
+		entries, err := fs.ReadDir(asOf, test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, e := range entries {
+			got = append(got, e.Name())
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Error ReadDir %s got %v; want %v", test.name, got, test.want)
+		}
+		info, err := fs.Stat(asOf, test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !info.IsDir() {
+			t.Errorf("Error Stat %s is not a directory", test.name)
+		}
+	}
+}
+
+func TestRemoveAll_VersionedBucket(t *testing.T) {
+	fsys, _ := newVersionedFSTesting(t)
+	if _, err := fsys.WriteFile("dir0/file01.txt", []byte("v1"), fs.ModePerm); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.RemoveFile("dir0/file02.txt"); err != nil {
+		t.Fatal(err)
+	}
+	fsys.RemoveAllVersions = true
+	if err := fsys.RemoveAll("dir0"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dir0/file01.txt", "dir0/file02.txt", "dir0/file03.txt"} {
+		if _, err := fsys.ListObjectVersions(name); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("Error ListObjectVersions %s error got %v; want %v", name, err, fs.ErrNotExist)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package s3fs
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// maxKeyRune is the largest rune in the keys. The listing that starts after
+// a prefix followed by maxKeyRune skips almost all keys under the prefix.
+const maxKeyRune = "\U0010FFFF"
+
+// WalkDir walks the file tree rooted at root like fs.WalkDir. If fsys is an
+// *S3FS then WalkDir calls S3FS.WalkDir, otherwise calls fs.WalkDir.
+func WalkDir(fsys fs.FS, root string, fn fs.WalkDirFunc) error {
+	if s3fsys, ok := fsys.(*S3FS); ok {
+		return s3fsys.WalkDir(root, fn)
+	}
+	return fs.WalkDir(fsys, root, fn)
+}
+
+// WalkDir walks the file tree rooted at root, calling fn for each file or
+// directory in the tree, including root.
+//
+// Unlike fs.WalkDir that lists each directory, WalkDir lists all objects under
+// root without the delimiter and synthesizes the directories from the keys.
+// The files and directories are visited in the lexical order of the keys, so
+// "a-b" is visited before "a/b" unlike fs.WalkDir. fs.SkipDir and fs.SkipAll
+// are handled like fs.WalkDir, and the skipped directory is not listed by
+// starting the listing after it. If the listing fails then fn is called with
+// root and the error, and the walk stops.
+//
+// The invalid keys are handled by InvalidKeys. If the policy is
+// ErrorOnInvalidKeys then fn is called with the directory that contains the
+// invalid key and *InvalidKeyError like the error of reading the directory on
+// fs.WalkDir. If fn returns nil then the key is skipped.
+func (fsys *S3FS) WalkDir(root string, fn fs.WalkDirFunc) error {
+	if !fs.ValidPath(root) {
+		return fn(root, nil, toPathError(fs.ErrInvalid, "WalkDir", root))
+	}
+	if root != "." {
+		info, err := fsys.statFile(root)
+		if err == nil {
+			return skipToNil(fn(root, info, nil))
+		}
+		if !isNotExist(err) {
+			return fn(root, nil, err)
+		}
+	}
+	return skipToNil(newWalker(fsys, root, "", fn).walk())
+}
+
+// skipToNil returns nil if err is fs.SkipDir or fs.SkipAll.
+func skipToNil(err error) error {
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walker walks the objects under the prefix.
+type walker struct {
+	fsys   *S3FS
+	root   string
+	prefix string
+	// listPrefix is the prefix of the listing that starts with prefix.
+	listPrefix string
+	fn         fs.WalkDirFunc
+	// dirs is the stack of the directories that contain the current key,
+	// relative to the prefix with the trailing slash.
+	dirs []string
+	// skip is the directory that is skipped, relative to the prefix with the
+	// trailing slash.
+	skip string
+}
+
+// newWalker returns a walker of root. If listPrefix is not empty then only the
+// keys that start with root joined with listPrefix are listed.
+func newWalker(fsys *S3FS, root, listPrefix string, fn fs.WalkDirFunc) *walker {
+	prefix := fsys.prefix(root)
+	return &walker{
+		fsys:       fsys,
+		root:       root,
+		prefix:     prefix,
+		listPrefix: prefix + fsys.toKeyPrefix(listPrefix),
+		fn:         fn,
+	}
+}
+
+func (w *walker) walk() error {
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(w.fsys.bucket),
+		Prefix:  aws.String(w.listPrefix),
+		MaxKeys: aws.Int64(int64(w.fsys.ListBufferSize)),
+	}
+	rootEntry := newDirContent(w.root)
+	for first := true; ; first = false {
+		if err := w.fsys.context().Err(); err != nil {
+			return w.fn(w.root, rootEntry, toPathError(err, "WalkDir", w.root))
+		}
+		output, err := w.fsys.listObjectsV2(input)
+		if err != nil {
+			return w.fn(w.root, rootEntry, toPathError(err, "WalkDir", w.root))
+		}
+		if first {
+			if len(output.Contents) == 0 && w.root != "." {
+				return w.fn(w.root, nil, toPathError(fs.ErrNotExist, "WalkDir", w.root))
+			}
+			if err := w.fn(w.root, rootEntry, nil); err != nil {
+				return err
+			}
+		}
+		for _, o := range output.Contents {
+			if err := w.visit(o); err != nil {
+				return err
+			}
+		}
+		if !aws.BoolValue(output.IsTruncated) || output.NextContinuationToken == nil {
+			return nil
+		}
+		last := strings.TrimPrefix(aws.StringValue(output.Contents[len(output.Contents)-1].Key), w.prefix)
+		if w.skip != "" && strings.HasPrefix(last, w.skip) {
+			input.ContinuationToken = nil
+			input.StartAfter = aws.String(w.prefix + w.skip + maxKeyRune)
+			continue
+		}
+		input.ContinuationToken = output.NextContinuationToken
+		input.StartAfter = nil
+	}
+}
+
+// visit calls fn with the directories of the object that are not visited yet
+// and the object.
+func (w *walker) visit(o *s3.Object) error {
+	key := aws.StringValue(o.Key)
+	rel := strings.TrimPrefix(key, w.prefix)
+	if w.skip != "" {
+		if strings.HasPrefix(rel, w.skip) {
+			return nil
+		}
+		w.skip = ""
+	}
+	dir, file := path.Split(rel)
+	for len(w.dirs) > 0 && !strings.HasPrefix(dir, w.dirs[len(w.dirs)-1]) {
+		w.dirs = w.dirs[:len(w.dirs)-1]
+	}
+	start := 0
+	if len(w.dirs) > 0 {
+		start = len(w.dirs[len(w.dirs)-1])
+	}
+	for i := start; i < len(dir); i++ {
+		if dir[i] != '/' {
+			continue
+		}
+		d := dir[:i+1]
+		if ok, err := w.check(key, dir[:i]); !ok {
+			return err
+		}
+		name := w.fsys.toName(dir[:i])
+		if err := w.fn(path.Join(w.root, name), newDirContent(name), nil); err != nil {
+			if err == fs.SkipDir {
+				w.skip = d
+				return nil
+			}
+			return err
+		}
+		w.dirs = append(w.dirs, d)
+	}
+	if file == "" {
+		// NOTE: The key that ends with a slash is a directory marker.
+		return nil
+	}
+	if ok, err := w.check(key, rel); !ok {
+		return err
+	}
+	name := w.fsys.toName(rel)
+	err := w.fn(path.Join(w.root, name), newFileContent(name, w.fsys.bucket, o), nil)
+	if err == fs.SkipDir {
+		// NOTE: Skip the remaining files in the containing directory.
+		if len(w.dirs) == 0 {
+			return fs.SkipAll
+		}
+		w.skip = w.dirs[len(w.dirs)-1]
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		return nil
+	}
+	return err
+}
+
+// check checks the last element of the relative key rel by InvalidKeys. The
+// other elements are already checked. check returns false if the key is
+// skipped. If the policy is ErrorOnInvalidKeys then fn is called with the
+// containing directory and the error.
+func (w *walker) check(key, rel string) (bool, error) {
+	i := strings.LastIndex(rel, "/")
+	if ok, err := w.fsys.checkKey(key, rel[i+1:]); ok || err == nil {
+		return ok, nil
+	}
+	dir := ""
+	if i != -1 {
+		dir = rel[:i+1]
+	}
+	name := path.Join(w.root, w.fsys.toName(strings.TrimSuffix(dir, "/")))
+	err := w.fn(name, nil, toPathError(&InvalidKeyError{Key: key}, "WalkDir", name))
+	if err == fs.SkipDir {
+		if dir == "" {
+			return false, fs.SkipAll
+		}
+		w.skip = dir
+		w.dirs = w.dirs[:len(w.dirs)-1]
+		return false, nil
+	}
+	return false, err
+}
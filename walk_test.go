@@ -0,0 +1,148 @@
+package s3fs
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"testing"
+)
+
+// walkPaths returns the visited paths by walk. The directories end with a
+// slash.
+func walkPaths(walk func(root string, fn fs.WalkDirFunc) error, root string, skip func(p string, d fs.DirEntry) error) ([]string, error) {
+	var paths []string
+	err := walk(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			p += "/"
+		}
+		paths = append(paths, p)
+		if skip != nil {
+			return skip(p, d)
+		}
+		return nil
+	})
+	return paths, err
+}
+
+func TestWalkDir(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	fsWalkDir := func(root string, fn fs.WalkDirFunc) error {
+		return fs.WalkDir(fsys, root, fn)
+	}
+	skipFile := errors.New("skip file")
+
+	tests := []struct {
+		root string
+		skip map[string]error
+	}{
+		{root: "."},
+		{root: "dir0"},
+		{root: "file0.txt"},
+		{root: ".", skip: map[string]error{"dir0/": fs.SkipDir}},
+		{root: ".", skip: map[string]error{"dir0/file01.txt": fs.SkipDir}},
+		{root: ".", skip: map[string]error{"file0.txt": fs.SkipDir}},
+		{root: ".", skip: map[string]error{"dir0/file02.txt": fs.SkipAll}},
+		{root: ".", skip: map[string]error{"./": fs.SkipDir}},
+		{root: ".", skip: map[string]error{"file1.txt": skipFile}},
+	}
+	for _, test := range tests {
+		skip := func(p string, d fs.DirEntry) error {
+			return test.skip[p]
+		}
+		want, wantErr := walkPaths(fsWalkDir, test.root, skip)
+		got, gotErr := walkPaths(fsys.WalkDir, test.root, skip)
+		if gotErr != wantErr {
+			t.Errorf("Error WalkDir(%s, %v) error got %v; want %v", test.root, test.skip, gotErr, wantErr)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Error WalkDir(%s, %v) got %v; want %v", test.root, test.skip, got, want)
+		}
+	}
+}
+
+func TestWalkDir_NotExist(t *testing.T) {
+	fsys := NewWithAPI("testdata", newMockFSS3APITesting(t))
+	for _, root := range []string{"not-found", "../invalid"} {
+		err := WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+			if p != root || d != nil {
+				t.Errorf("Error WalkDir(%s) fn(%s, %v)", root, p, d)
+			}
+			return err
+		})
+		var pathErr *fs.PathError
+		if !errors.As(err, &pathErr) {
+			t.Errorf("Error WalkDir(%s) error got %v; want *fs.PathError", root, err)
+		}
+	}
+}
+
+func TestWalkDir_ListError(t *testing.T) {
+	api := newMockFSS3APITesting(t)
+	api.err = errors.New("test")
+	fsys := NewWithAPI("testdata", api)
+	err := fsys.WalkDir(".", func(p string, d fs.DirEntry, err error) error {
+		return err
+	})
+	if !errors.Is(err, api.err) {
+		t.Errorf("Error WalkDir error got %v; want %v", err, api.err)
+	}
+}
+
+func TestWalkDir_Large(t *testing.T) {
+	n := 1500
+	files := map[string][]byte{}
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("large/dir%04d/file.txt", i)] = []byte("test")
+	}
+	fsys, api := newCountFSTesting(t, files)
+	fsys.ListBufferSize = 300
+
+	paths, err := walkPaths(fsys.WalkDir, ".", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(paths), 2+n*2; got != want {
+		t.Errorf("Error WalkDir got %d paths; want %d", got, want)
+	}
+	if got, want := api.count("ListObjectsV2"), n/fsys.ListBufferSize; got != want {
+		t.Errorf("Error WalkDir requests %d; want %d", got, want)
+	}
+
+	// NOTE: Skip the directories except the first and the last.
+	api.reset()
+	paths, err = walkPaths(fsys.WalkDir, "large", func(p string, d fs.DirEntry) error {
+		if d.IsDir() && p != "large/" && p != "large/dir0000/" && p != fmt.Sprintf("large/dir%04d/", n-1) {
+			return fs.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := len(paths), 1+n+2; got != want {
+		t.Errorf("Error WalkDir with SkipDir got %d paths; want %d", got, want)
+	}
+}
+
+func TestWalkDir_Other(t *testing.T) {
+	fsys := newMemFSTesting(t)
+	want, err := walkPaths(func(root string, fn fs.WalkDirFunc) error {
+		return fs.WalkDir(fsys, root, fn)
+	}, "testdata", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := walkPaths(func(root string, fn fs.WalkDirFunc) error {
+		return WalkDir(fsys, root, fn)
+	}, "testdata", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Error WalkDir got %v; want %v", got, want)
+	}
+}